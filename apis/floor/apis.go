@@ -5,6 +5,7 @@ import (
 	"slices"
 	"time"
 	"treehole_next/apis/message"
+	"treehole_next/config"
 	"treehole_next/utils/sensitive"
 
 	"github.com/opentreehole/go-common"
@@ -26,8 +27,10 @@ import (
 // @Produce application/json
 // @Router /holes/{hole_id}/floors [get]
 // @Param hole_id path int true "hole id"
+// @Description If cursor is present in the query (even empty), cursor pagination is used and ListCursorResponse is returned.
 // @Param object query ListModel false "query"
 // @Success 200 {array} Floor
+// @Success 200 {object} ListCursorResponse
 func ListFloorsInAHole(c *fiber.Ctx) error {
 	// validate
 	holeID, err := c.ParamsInt("id")
@@ -43,6 +46,9 @@ func ListFloorsInAHole(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	if c.Context().QueryArgs().Has("cursor") {
+		return listFloorsByCursor(c, holeID, &query)
+	}
 	if *query.Size == 0 {
 		query.Size = nil
 	}
@@ -62,6 +68,53 @@ func ListFloorsInAHole(c *fiber.Ctx) error {
 	return Serialize(c, &floors)
 }
 
+func listFloorsByCursor(c *fiber.Ctx, holeID int, query *ListModel) error {
+	cursor, err := DecodeFloorCursor(query.Cursor)
+	if err != nil {
+		return err
+	}
+	size := *query.Size
+	if size == 0 {
+		size = config.Config.Size
+	} else if size > config.Config.MaxSize {
+		size = config.Config.MaxSize
+	}
+
+	var floors Floors
+	querySet, err := floors.MakeCursorQuerySet(holeID, cursor, size, query.OrderBy, query.Sort, c)
+	if err != nil {
+		return err
+	}
+	err = querySet.Find(&floors).Error
+	if err != nil {
+		return err
+	}
+
+	backward := cursor != nil && cursor.Backward
+	hasMore := len(floors) > size
+	if hasMore {
+		floors = floors[:size]
+	}
+	if backward {
+		slices.Reverse(floors)
+	}
+
+	response := ListCursorResponse{Data: floors}
+	if len(floors) > 0 {
+		// moving backward means there must be floors after this page, and vice versa
+		if hasMore && !backward || backward {
+			next := NewFloorCursor(floors[len(floors)-1], query.OrderBy, false).Encode()
+			response.NextCursor = &next
+		}
+		if hasMore && backward || cursor != nil && !backward {
+			prev := NewFloorCursor(floors[0], query.OrderBy, true).Encode()
+			response.PrevCursor = &prev
+		}
+	}
+
+	return Serialize(c, &response)
+}
+
 // ListFloorsOld
 //
 // @Summary Old API for Listing Floors
@@ -154,6 +207,55 @@ func GetFloor(c *fiber.Ctx) (err error) {
 	return Serialize(c, &floor)
 }
 
+// GetFloorConversation
+//
+// @Summary Get The Conversation Of A Floor
+// @Description Returns the reply_to ancestors of a floor, the floor itself and the floors directly replying to it, ordered by ranking.
+// @Tags Floor
+// @Produce application/json
+// @Router /floors/{id}/conversation [get]
+// @Param id path int true "id"
+// @Success 200 {array} Floor
+// @Failure 404 {object} MessageModel
+func GetFloorConversation(c *fiber.Ctx) (err error) {
+	// validate floor id
+	floorID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	// get floor
+	var floor Floor
+	querySet, err := MakeFloorQuerySet(c)
+	if err != nil {
+		return err
+	}
+	err = querySet.First(&floor, floorID).Error
+	if err != nil {
+		return err
+	}
+
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.IsAdmin {
+		// get hole
+		var hole Hole
+		err = DB.Where("hidden = false").First(&hole, floor.HoleID).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	floors, err := floor.LoadConversation(DB)
+	if err != nil {
+		return err
+	}
+
+	return Serialize(c, &floors)
+}
+
 // CreateFloor
 //
 // @Summary Create A Floor
@@ -422,13 +524,9 @@ func ModifyFloor(c *fiber.Ctx) error {
 
 			// reindex floor
 			if !hole.Hidden && !floor.IsSensitive {
-				go FloorIndex(FloorModel{
-					ID:        floor.ID,
-					UpdatedAt: time.Now(),
-					Content:   floor.Content,
-				})
+				IndexFloors(tx, Floors{&floor})
 			} else {
-				go FloorDelete(floorID)
+				FloorDelete(floorID)
 				if floor.IsSensitive {
 					floor.SendSensitive(tx)
 				}
@@ -578,6 +676,86 @@ func ModifyFloorLike(c *fiber.Ctx) error {
 		return err
 	}
 
+	// likes are indexed for filtering by likes when searching
+	if !floor.Deleted && !floor.Sensitive() {
+		IndexFloors(DB, Floors{&floor})
+	}
+
+	return Serialize(c, &floor)
+}
+
+// AddFloorReaction
+//
+// @Summary Add A Reaction To A Floor
+// @Description 👍 and 👎 are the same as like and dislike, adding one of them replaces the other.
+// @Tags Floor
+// @Accept application/json
+// @Produce application/json
+// @Router /floors/{id}/reactions [post]
+// @Param id path int true "id"
+// @Param json body ReactionModel true "json"
+// @Success 200 {object} Floor
+// @Failure 404 {object} MessageModel
+func AddFloorReaction(c *fiber.Ctx) error {
+	return modifyFloorReaction(c, true)
+}
+
+// DeleteFloorReaction
+//
+// @Summary Delete A Reaction From A Floor
+// @Tags Floor
+// @Accept application/json
+// @Produce application/json
+// @Router /floors/{id}/reactions [delete]
+// @Param id path int true "id"
+// @Param json body ReactionModel true "json"
+// @Success 200 {object} Floor
+// @Failure 404 {object} MessageModel
+func DeleteFloorReaction(c *fiber.Ctx) error {
+	return modifyFloorReaction(c, false)
+}
+
+func modifyFloorReaction(c *fiber.Ctx, add bool) error {
+	var body ReactionModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	floorID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var floor Floor
+	err = DB.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&floor, floorID)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		err = floor.ModifyReaction(tx, userID, body.Emoji, add)
+		if err != nil {
+			return err
+		}
+
+		// save like only
+		return tx.Model(&floor).Select("Like", "Dislike").Updates(&floor).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// likes are indexed for filtering by likes when searching
+	if !floor.Deleted && !floor.Sensitive() {
+		IndexFloors(DB, Floors{&floor})
+	}
+
 	return Serialize(c, &floor)
 }
 
@@ -641,7 +819,7 @@ func DeleteFloor(c *fiber.Ctx) error {
 		return err
 	}
 
-	go FloorDelete(floor.ID)
+	FloorDelete(floor.ID)
 
 	// log
 	if user.ID == floor.UserID {
@@ -750,6 +928,119 @@ func GetFloorHistory(c *fiber.Ctx) error {
 	return c.JSON(&histories)
 }
 
+// GetFloorHistoryDiff
+//
+// @Summary Diff Two Versions Of A Floor, admin only
+// @Description Versions are floor histories and the current content, each history records the change made after it.
+// @Tags Floor
+// @Produce application/json
+// @Router /floors/{id}/history/_diff [get]
+// @Param id path int true "id"
+// @Param object query HistoryDiffModel false "query"
+// @Success 200 {object} HistoryDiffResponse
+// @Failure 404 {object} MessageModel
+func GetFloorHistoryDiff(c *fiber.Ctx) error {
+	var query HistoryDiffModel
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+	floorID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	// get user
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	// permission
+	if !user.IsAdmin {
+		return common.Forbidden()
+	}
+
+	var floor Floor
+	var histories []FloorHistory
+
+	err = DB.Transaction(func(tx *gorm.DB) (err error) {
+		err = tx.First(&floor, floorID).Error
+		if err != nil {
+			return
+		}
+		err = tx.Where("floor_id = ?", floorID).Order("id").Find(&histories).Error
+		return
+	})
+	if err != nil {
+		return err
+	}
+
+	// versions[i] is the content of histories[i], the last one is the current content
+	versions := make([]string, 0, len(histories)+1)
+	for _, history := range histories {
+		versions = append(versions, history.Content)
+	}
+	versions = append(versions, floor.Content)
+
+	position := func(historyID int) (int, error) {
+		if historyID == 0 {
+			return len(histories), nil
+		}
+		for i, history := range histories {
+			if history.ID == historyID {
+				return i, nil
+			}
+		}
+		return 0, common.NotFound("历史记录不存在")
+	}
+
+	if query.From == nil {
+		from := 0
+		if len(histories) > 0 {
+			from = histories[0].ID
+		}
+		query.From = &from
+	}
+	from, err := position(*query.From)
+	if err != nil {
+		return err
+	}
+	to, err := position(query.To)
+	if err != nil {
+		return err
+	}
+
+	response := HistoryDiffResponse{
+		FloorID: floor.ID,
+		From:    *query.From,
+		To:      query.To,
+		Level:   query.Level,
+		Changes: make([]HistoryChange, 0),
+	}
+	if query.Level == "word" {
+		response.Diff = DiffWords(versions[from], versions[to])
+	} else {
+		response.Diff = DiffLines(versions[from], versions[to])
+	}
+
+	for _, history := range histories[min(from, to):max(from, to)] {
+		// hide the author, the same as GetFloorHistory
+		userID := history.UserID
+		if floor.UserID == userID {
+			userID = 1
+		}
+		response.Changes = append(response.Changes, HistoryChange{
+			HistoryID: history.ID,
+			UserID:    userID,
+			Reason:    history.Reason,
+			Time:      history.CreatedAt,
+		})
+	}
+
+	return c.JSON(&response)
+}
+
 // RestoreFloor
 //
 // @Summary Restore A Floor, admin only
@@ -815,11 +1106,7 @@ func RestoreFloor(c *fiber.Ctx) error {
 	floor.SensitiveDetail = floorHistory.SensitiveDetail
 	DB.Save(&floor)
 
-	go FloorIndex(FloorModel{
-		ID:        floor.ID,
-		UpdatedAt: time.Now(),
-		Content:   floor.Content,
-	})
+	IndexFloors(DB, Floors{&floor})
 
 	// log
 	MyLog("Floor", "Restore", floorID, user.ID, RoleAdmin, reason)
@@ -1095,13 +1382,9 @@ func ModifyFloorSensitive(c *fiber.Ctx) (err error) {
 	}
 
 	if floor.IsActualSensitive != nil && *floor.IsActualSensitive == false {
-		go FloorIndex(FloorModel{
-			ID:        floor.ID,
-			UpdatedAt: floor.UpdatedAt,
-			Content:   floor.Content,
-		})
+		IndexFloors(DB, Floors{&floor})
 	} else {
-		go FloorDelete(floor.ID)
+		FloorDelete(floor.ID)
 
 		MyLog("Floor", "Delete", floorID, user.ID, RoleAdmin, "reason: ", "sensitive")
 
@@ -0,0 +1,116 @@
+package floor
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+
+	"treehole_next/config"
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// GetSearchIndexAudit
+//
+// @Summary Get The Latest Audit Report Of The Search Index, admin only
+// @Tags Search
+// @Produce application/json
+// @Router /config/search/_audit [get]
+// @Success 200 {object} models.IndexAuditReport
+// @Failure 404 {object} common.HttpError
+func GetSearchIndexAudit(c *fiber.Ctx) error {
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.IsAdmin {
+		return common.Forbidden()
+	}
+
+	var report IndexAuditReport
+	if !GetCache(IndexAuditReportKey, &report) {
+		return common.NotFound("尚未审计")
+	}
+	return c.JSON(&report)
+}
+
+// AuditSearchIndex
+//
+// @Summary Audit A Range Of Floors In The Search Index, admin only
+// @Description Compare floors from from_id on with their documents, and repair mismatches unless repair is false.
+// @Tags Search
+// @Produce application/json
+// @Router /config/search/_audit [post]
+// @Param json body AuditSearchIndexModel true "json"
+// @Success 200 {object} models.IndexAuditReport
+func AuditSearchIndex(c *fiber.Ctx) error {
+	var body AuditSearchIndexModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.IsAdmin {
+		return common.Forbidden()
+	}
+
+	repair := body.Repair == nil || *body.Repair
+	report, err := AuditFloorIndex(c.Context(), body.FromID, body.Size, repair)
+	if err != nil {
+		return err
+	}
+	err = SetCache(IndexAuditReportKey, report, 0)
+	if err != nil {
+		log.Err(err).Msg("error caching index audit report")
+	}
+
+	MyLog("Search", "Audit", body.FromID, user.ID, RoleAdmin)
+	return c.JSON(report)
+}
+
+// AuditSearchIndexTask audits config.Config.IndexAuditSize floors periodically,
+// each run continues from the last floor of the previous one and wraps around at the end
+func AuditSearchIndexTask(ctx context.Context) {
+	if ES == nil || config.Config.IndexAuditIntervalMinutes <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Minute * time.Duration(config.Config.IndexAuditIntervalMinutes))
+	defer ticker.Stop()
+	fromID := 0
+	for {
+		select {
+		case <-ticker.C:
+			report, err := AuditFloorIndex(ctx, fromID, config.Config.IndexAuditSize, true)
+			if err != nil {
+				log.Err(err).Msg("error audit search index")
+				continue
+			}
+			err = SetCache(IndexAuditReportKey, report, 0)
+			if err != nil {
+				log.Err(err).Msg("error caching index audit report")
+			}
+			log.Info().
+				Int("from_id", report.FromID).
+				Int("to_id", report.ToID).
+				Int("missing", report.Missing.Count).
+				Int("stale", report.Stale.Count).
+				Int("extra", report.Extra.Count).
+				Msg("audit search index")
+
+			if report.Checked < config.Config.IndexAuditSize {
+				fromID = 0
+			} else {
+				fromID = report.ToID + 1
+			}
+		case <-ctx.Done():
+			log.Info().Msg("task AuditSearchIndexTask stopped...")
+			return
+		}
+	}
+}
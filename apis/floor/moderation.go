@@ -0,0 +1,252 @@
+package floor
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/maps"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+
+	"treehole_next/apis/message"
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// BatchModerate
+//
+// @Summary Apply Moderation Actions In Batch, admin only
+// @Description Actions are applied in one transaction, a failed action is rolled back alone and reported in results.
+// @Description Authors of floors deleted by others are notified, as in DeleteFloor.
+// @Tags Floor
+// @Accept application/json
+// @Produce application/json
+// @Router /moderation/_batch [post]
+// @Param json body BatchModerationModel true "json"
+// @Success 200 {object} BatchModerationResponse
+func BatchModerate(c *fiber.Ctx) error {
+	var body BatchModerationModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	// get user
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	// permission
+	if !user.IsAdmin {
+		return common.Forbidden()
+	}
+
+	var response BatchModerationResponse
+	var deletedFloorIDs []int
+	var notifiedFloors Floors
+	holeIDs := make(map[int]bool)
+	err = DB.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		response.Results = make([]ModerationResult, len(body.Actions))
+		for i, item := range body.Actions {
+			result := &response.Results[i]
+			*result = ModerationResult{
+				Index:   i,
+				Action:  item.Action,
+				FloorID: item.FloorID,
+				HoleID:  item.HoleID,
+			}
+
+			// savepoint, roll back this action only
+			var effect moderationEffect
+			err := tx.Transaction(func(tx *gorm.DB) (err error) {
+				effect, err = moderate(tx, user, item)
+				return err
+			})
+			if err != nil {
+				result.Message = err.Error()
+				response.Failed++
+				continue
+			}
+
+			result.Success = true
+			response.Succeeded++
+			holeIDs[effect.HoleID] = true
+			deletedFloorIDs = append(deletedFloorIDs, effect.DeletedFloorIDs...)
+			if effect.NotifiedFloor != nil {
+				notifiedFloors = append(notifiedFloors, effect.NotifiedFloor)
+			}
+			MyLog("Moderation", item.Action, max(item.FloorID, item.HoleID), user.ID, RoleAdmin, "reason: ", item.Reason)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// delete floors from Elasticsearch
+	if len(deletedFloorIDs) > 0 {
+		BulkDelete(deletedFloorIDs)
+	}
+
+	// SendModify when admin delete floor
+	for _, floor := range notifiedFloors {
+		err = floor.SendModify(DB)
+		if err != nil {
+			log.Err(err).Str("model", "Notification").Msg("SendModify failed")
+		}
+	}
+
+	// update cache
+	if len(holeIDs) > 0 {
+		var holes Holes
+		err = DB.Where("id IN ?", maps.Keys(holeIDs)).Find(&holes).Error
+		if err != nil {
+			return err
+		}
+		err = UpdateHoleCache(holes)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.JSON(&response)
+}
+
+type moderationEffect struct {
+	// the hole whose cache should be updated
+	HoleID int
+	// floors to be deleted from Elasticsearch
+	DeletedFloorIDs []int
+	// the deleted floor whose author is notified
+	NotifiedFloor *Floor
+}
+
+func moderate(tx *gorm.DB, user *User, item ModerationItem) (effect moderationEffect, err error) {
+	if item.Action == ModerationHideHole || item.Action == ModerationLockHole {
+		if item.HoleID == 0 {
+			return effect, common.BadRequest("hole_id 不能为空")
+		}
+
+		var hole Hole
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&hole, item.HoleID).Error
+		if err != nil {
+			return
+		}
+		effect.HoleID = hole.ID
+
+		if item.Action == ModerationLockHole {
+			err = tx.Model(&hole).Omit("UpdatedAt").Update("locked", true).Error
+			if err != nil {
+				return
+			}
+			CreateAdminLog(tx, AdminLogTypeHole, user.ID, struct {
+				HoleID int  `json:"hole_id"`
+				Locked bool `json:"locked"`
+			}{
+				HoleID: hole.ID,
+				Locked: true,
+			})
+			return
+		}
+
+		err = tx.Model(&hole).Omit("UpdatedAt").Update("hidden", true).Error
+		if err != nil {
+			return
+		}
+		err = tx.Model(&Floor{}).Where("hole_id = ?", hole.ID).Pluck("id", &effect.DeletedFloorIDs).Error
+		if err != nil {
+			return
+		}
+		err = message.DeleteMessageByRelatedHoleID(tx, hole.ID)
+		if err != nil {
+			return
+		}
+		CreateAdminLog(tx, AdminLogTypeHideHole, user.ID, struct {
+			HoleID int  `json:"hole_id"`
+			Hidden bool `json:"hidden"`
+		}{
+			HoleID: hole.ID,
+			Hidden: true,
+		})
+		return
+	}
+
+	if item.FloorID == 0 {
+		return effect, common.BadRequest("floor_id 不能为空")
+	}
+
+	var floor Floor
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&floor, item.FloorID).Error
+	if err != nil {
+		return
+	}
+	effect.HoleID = floor.HoleID
+
+	if item.Action == ModerationFold {
+		if item.Reason == "" {
+			return effect, common.BadRequest("折叠理由不能为空")
+		}
+		err = floor.Backup(tx, user.ID, item.Reason)
+		if err != nil {
+			return
+		}
+		floor.Fold = item.Reason
+		err = tx.Model(&floor).Select("Fold").Updates(&floor).Error
+		if err != nil {
+			return
+		}
+		CreateAdminLog(tx, AdminLogTypeFoldFloor, user.ID, struct {
+			FloorID int    `json:"floor_id"`
+			Reason  string `json:"reason"`
+		}{
+			FloorID: floor.ID,
+			Reason:  item.Reason,
+		})
+		return
+	}
+
+	// delete or sensitive
+	reason := item.Reason
+	if item.Action == ModerationSensitive {
+		if reason == "" {
+			reason = "违反社区规范"
+		}
+		isActualSensitive := true
+		floor.IsActualSensitive = &isActualSensitive
+	}
+	err = floor.Backup(tx, user.ID, reason)
+	if err != nil {
+		return
+	}
+	err = message.DeleteMessageByRelatedFloorID(tx, floor.ID)
+	if err != nil {
+		return
+	}
+	floor.Deleted = true
+	floor.Content = generateDeleteReason(reason, false)
+	err = tx.Omit(clause.Associations).Save(&floor).Error
+	if err != nil {
+		return
+	}
+	effect.DeletedFloorIDs = []int{floor.ID}
+	if item.Action == ModerationDelete && floor.UserID != user.ID {
+		effect.NotifiedFloor = &floor
+	}
+
+	logType := AdminLogTypeDeleteFloor
+	if item.Action == ModerationSensitive {
+		logType = AdminLogTypeChangeSensitive
+	}
+	CreateAdminLog(tx, logType, user.ID, struct {
+		FloorID int    `json:"floor_id"`
+		Action  string `json:"action"`
+		Reason  string `json:"reason"`
+	}{
+		FloorID: floor.ID,
+		Action:  item.Action,
+		Reason:  reason,
+	})
+	return
+}
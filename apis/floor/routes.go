@@ -9,26 +9,41 @@ import (
 func RegisterRoutes(app fiber.Router) {
 	app.Post("/floors/search", SearchFloors)
 	app.Get("/floors/search", SearchFloors)
+	app.Get("/holes/search", SearchHoles)
 
 	app.Get("/holes/:id<int>/floors", ListFloorsInAHole)
 	app.Get("/floors", ListFloorsOld)
 	app.Get("/floors/:id<int>", GetFloor)
+	app.Get("/floors/:id<int>/conversation", GetFloorConversation)
 	app.Post("/holes/:id<int>/floors", utils.MiddlewareHasAnsweredQuestions, CreateFloor)
 	app.Post("/floors", utils.MiddlewareHasAnsweredQuestions, CreateFloorOld)
 	app.Put("/floors/:id<int>", ModifyFloor)
 	app.Patch("/floors/:id<int>/_webvpn", ModifyFloor)
 	app.Post("/floors/:id<int>/like/:like<int>", ModifyFloorLike)
+	app.Post("/floors/:id<int>/reactions", AddFloorReaction)
+	app.Delete("/floors/:id<int>/reactions", DeleteFloorReaction)
 	app.Delete("/floors/:id<int>", DeleteFloor)
 
 	app.Get("/users/me/floors", ListReplyFloors)
 
 	app.Get("/floors/:id<int>/history", GetFloorHistory)
+	app.Get("/floors/:id<int>/history/_diff", GetFloorHistoryDiff)
 	app.Post("/floors/:id<int>/restore/:floor_history_id<int>", RestoreFloor)
 
 	app.Post("/config/search", SearchConfig)
+	app.Post("/config/search/_backfill", BackfillSearchIndex)
+	app.Post("/config/search/_reindex", ReindexSearch)
+	app.Get("/config/search/_reindex", GetReindexSearchStatus)
+	app.Get("/config/search/_audit", GetSearchIndexAudit)
+	app.Post("/config/search/_audit", AuditSearchIndex)
+	app.Get("/config/search/_top_queries", ListTopSearchQueries)
+	app.Get("/config/search/_zero_result_queries", ListZeroResultSearchQueries)
+	app.Get("/config/search/_latency", GetSearchLatency)
 	app.Get("/floors/:id<int>/punishment", GetPunishmentHistory)
 	app.Get("/floors/:id<int>/user_silence", GetUserSilence)
 
+	app.Post("/moderation/_batch", BatchModerate)
+
 	app.Get("/floors/_sensitive", ListSensitiveFloors)
 	app.Put("/floors/:id<int>/_sensitive", ModifyFloorSensitive)
 	app.Patch("/floors/:id<int>/_sensitive/_webvpn", ModifyFloorSensitive)
@@ -3,9 +3,11 @@ package floor
 import (
 	"time"
 
+	"github.com/gofiber/fiber/v2"
 	"github.com/opentreehole/go-common"
 
 	"treehole_next/models"
+	"treehole_next/utils"
 )
 
 type ListModel struct {
@@ -13,6 +15,21 @@ type ListModel struct {
 	Offset  int    `json:"offset" query:"offset" default:"0" validate:"min=0"`
 	Sort    string `json:"sort" query:"sort" default:"asc" validate:"oneof=asc desc"`       // Sort order
 	OrderBy string `json:"order_by" query:"order_by" default:"id" validate:"oneof=id like"` // SQL ORDER BY field
+	// opaque cursor returned by the previous page, pass an empty cursor to start cursor pagination, offset is ignored
+	Cursor string `json:"cursor" query:"cursor"`
+}
+
+// ListCursorResponse is returned by ListFloorsInAHole in cursor mode
+type ListCursorResponse struct {
+	Data models.Floors `json:"data"`
+	// null if there is no next page
+	NextCursor *string `json:"next_cursor"`
+	// null if there is no previous page
+	PrevCursor *string `json:"prev_cursor"`
+}
+
+func (response *ListCursorResponse) Preprocess(c *fiber.Ctx) error {
+	return response.Data.Preprocess(c)
 }
 
 type ListOldModel struct {
@@ -86,6 +103,11 @@ func (body ModifyModel) CheckPermission(user *models.User, floor *models.Floor,
 	return nil
 }
 
+type ReactionModel struct {
+	// one of 👍 👎 😂 😢 🤔 ❤️ 🎉, 👍 and 👎 are the same as like and dislike
+	Emoji string `json:"emoji" validate:"required"`
+}
+
 type DeleteModel struct {
 	Reason string `json:"delete_reason" validate:"max=32"`
 }
@@ -94,10 +116,80 @@ type RestoreModel struct {
 	Reason string `json:"restore_reason" validate:"required,max=32"`
 }
 
+type HistoryDiffModel struct {
+	// id of the floor history, 0 means the current content, default to the earliest history
+	From *int `json:"from" query:"from" validate:"omitempty,min=0"`
+	// id of the floor history, 0 means the current content
+	To    int    `json:"to" query:"to" default:"0" validate:"min=0"`
+	Level string `json:"level" query:"level" default:"line" validate:"oneof=line word"`
+}
+
+type HistoryChange struct {
+	HistoryID int       `json:"history_id"`
+	UserID    int       `json:"user_id"`
+	Reason    string    `json:"reason"`
+	Time      time.Time `json:"time"`
+}
+
+type HistoryDiffResponse struct {
+	FloorID int                 `json:"floor_id"`
+	From    int                 `json:"from"`
+	To      int                 `json:"to"`
+	Level   string              `json:"level"`
+	Diff    []utils.DiffSegment `json:"diff"`
+	// changes made between the two versions, in time order
+	Changes []HistoryChange `json:"changes"`
+}
+
+const (
+	ModerationFold      = "fold"
+	ModerationDelete    = "delete"
+	ModerationSensitive = "sensitive"
+	ModerationHideHole  = "hide_hole"
+	ModerationLockHole  = "lock_hole"
+)
+
+type ModerationItem struct {
+	Action string `json:"action" validate:"required,oneof=fold delete sensitive hide_hole lock_hole"`
+	// fold, delete and sensitive only
+	FloorID int `json:"floor_id" validate:"omitempty,min=1"`
+	// hide_hole and lock_hole only
+	HoleID int `json:"hole_id" validate:"omitempty,min=1"`
+	// required by fold, optional for delete and sensitive
+	Reason string `json:"reason" validate:"max=32"`
+}
+
+type BatchModerationModel struct {
+	Actions []ModerationItem `json:"actions" validate:"required,min=1,max=500,dive"`
+}
+
+type ModerationResult struct {
+	// index in actions
+	Index   int    `json:"index"`
+	Action  string `json:"action"`
+	FloorID int    `json:"floor_id,omitempty"`
+	HoleID  int    `json:"hole_id,omitempty"`
+	Success bool   `json:"success"`
+	// error message if failed
+	Message string `json:"message,omitempty"`
+}
+
+type BatchModerationResponse struct {
+	Succeeded int                `json:"succeeded"`
+	Failed    int                `json:"failed"`
+	Results   []ModerationResult `json:"results"`
+}
+
 type SearchConfigModel struct {
 	Open bool `json:"open"`
 }
 
+type AuditSearchIndexModel struct {
+	FromID int   `json:"from_id" validate:"min=0"`
+	Size   int   `json:"size" validate:"min=1,max=10000" default:"1000"`
+	Repair *bool `json:"repair"` // default true
+}
+
 type SensitiveFloorRequest struct {
 	Size    int               `json:"size" query:"size" default:"10" validate:"max=10"`
 	Offset  common.CustomTime `json:"offset" query:"offset" swaggertype:"string"`
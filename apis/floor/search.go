@@ -1,16 +1,25 @@
 package floor
 
 import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
 
 	. "treehole_next/config"
 	. "treehole_next/models"
 	. "treehole_next/utils"
+	"treehole_next/utils/search"
 )
 
 // SearchQuery is the query struct for searching floors
 type SearchQuery struct {
+	// Search supports the syntax of search.ParseQuery, e.g. "exact phrase", -excluded, #1234, tag:name, after:2006-01-02 and likes>10
 	Search string `json:"search" query:"search" validate:"required"`
 	Size   int    `json:"size" query:"size" validate:"min=0" default:"10"`
 	Offset int    `json:"offset" query:"offset" validate:"min=0" default:"0"`
@@ -22,32 +31,170 @@ type SearchQuery struct {
 	// Both are Unix timestamps, and are optional
 	StartTime *int64 `json:"start_time" query:"start_time"`
 	EndTime   *int64 `json:"end_time" query:"end_time"`
+
+	// HoleID, DivisionID and Tag limit the scope of searching, all are optional
+	HoleID     int    `json:"hole_id" query:"hole_id" validate:"min=0"`
+	DivisionID int    `json:"division_id" query:"division_id" validate:"min=0"`
+	Tag        string `json:"tag" query:"tag"` // tag name
+}
+
+// Request parses the search syntax and merges it with other parameters,
+// found is false if nothing can match, e.g. a tag does not exist
+func (query *SearchQuery) Request() (request SearchRequest, found bool, err error) {
+	parsed, err := search.ParseQuery(query.Search)
+	if err != nil {
+		var queryError *search.QueryError
+		if errors.As(err, &queryError) {
+			return request, false, &common.HttpError{
+				Code:    400,
+				Message: "搜索语法错误：" + queryError.Error(),
+				Detail: &common.ErrorDetail{{
+					Tag:     "syntax",
+					Field:   "search",
+					Value:   queryError.Token,
+					Param:   strconv.Itoa(queryError.Position),
+					Message: queryError.Message,
+				}},
+			}
+		}
+		return request, false, err
+	}
+
+	request = SearchRequest{
+		Keyword:   parsed.Keyword(),
+		Size:      query.Size,
+		Offset:    query.Offset,
+		Accurate:  query.Accurate,
+		Phrases:   parsed.Phrases,
+		Excludes:  parsed.Excludes,
+		StartTime: query.StartTime,
+		EndTime:   query.EndTime,
+		MinLikes:  parsed.MinLikes,
+		MaxLikes:  parsed.MaxLikes,
+		Filter:    SearchFilter{HoleID: query.HoleID, DivisionID: query.DivisionID},
+	}
+
+	if parsed.HoleID != 0 {
+		if query.HoleID != 0 && query.HoleID != parsed.HoleID {
+			return request, false, nil
+		}
+		request.Filter.HoleID = parsed.HoleID
+	}
+	if parsed.After != nil {
+		after := parsed.After.Unix()
+		if request.StartTime == nil || *request.StartTime < after {
+			request.StartTime = &after
+		}
+	}
+	if parsed.Before != nil {
+		before := parsed.Before.Unix() - 1
+		if request.EndTime == nil || *request.EndTime > before {
+			request.EndTime = &before
+		}
+	}
+
+	tagNames := parsed.Tags
+	if query.Tag != "" {
+		tagNames = append(tagNames, query.Tag)
+	}
+	if len(tagNames) == 0 {
+		return request, true, nil
+	}
+	var tags Tags
+	err = DB.Where("name IN ?", tagNames).Find(&tags).Error
+	if err != nil {
+		return request, false, err
+	}
+	for _, name := range tagNames {
+		index := slices.IndexFunc(tags, func(tag *Tag) bool { return tag.Name == name })
+		if index < 0 {
+			return request, false, nil
+		}
+		if !slices.Contains(request.Filter.TagIDs, tags[index].ID) {
+			request.Filter.TagIDs = append(request.Filter.TagIDs, tags[index].ID)
+		}
+	}
+	return request, true, nil
 }
 
 // SearchFloors
 //
 // @Summary SearchFloors In ElasticSearch
+// @Description Search supports "exact phrase", -excluded, #1234 (in hole), tag:name, after:2006-01-02, before:2006-01-02 and likes>10, likes>=, likes< or likes<=.
+// @Description A malformed query returns 400 with detail of the position and the token.
 // @Tags Search
 // @Produce application/json
 // @Router /floors/search [get]
 // @Router /floors/search [post]
 // @Param object query SearchQuery true "search_query"
 // @Success 200 {array} models.Floor
+// @Failure 400 {object} common.HttpError
 func SearchFloors(c *fiber.Ctx) error {
 	var query SearchQuery
 	err := common.ValidateQuery(c, &query)
 	if err != nil {
 		return err
 	}
+	start := time.Now()
+
+	request, found, err := query.Request()
+	if err != nil {
+		return err
+	}
+	if !found {
+		recordSearchEvent(query.Search, &request, 0, start)
+		return Serialize(c, HighlightedFloors{})
+	}
 
-	floors, err := Search(c, query.Search, query.Size, query.Offset, query.Accurate, query.StartTime, query.EndTime)
+	floors, err := Search(c, request)
 	if err != nil {
 		return err
 	}
+	recordSearchEvent(query.Search, &request, len(floors), start)
 
 	return Serialize(c, floors)
 }
 
+// SearchHolesQuery is the query struct for searching holes
+type SearchHolesQuery struct {
+	SearchQuery
+	// FloorSize is the max number of matched floors returned in each hole
+	FloorSize int `json:"floor_size" query:"floor_size" validate:"min=1,max=10" default:"3"`
+}
+
+// SearchHoles
+//
+// @Summary Search Floors Grouped By Hole
+// @Description The syntax is the same as /floors/search. Size and offset apply to holes, each hole returns its number of matched floors and the best of them.
+// @Tags Search
+// @Produce application/json
+// @Router /holes/search [get]
+// @Param object query SearchHolesQuery true "search_query"
+// @Success 200 {array} models.HoleSearchResult
+// @Failure 400 {object} common.HttpError
+func SearchHoles(c *fiber.Ctx) error {
+	var query SearchHolesQuery
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+
+	request, found, err := query.Request()
+	if err != nil {
+		return err
+	}
+	if !found {
+		return Serialize(c, HoleSearchResults{})
+	}
+
+	holes, err := SearchByHole(c, request, query.FloorSize)
+	if err != nil {
+		return err
+	}
+
+	return Serialize(c, holes)
+}
+
 // SearchConfig
 //
 // @Summary change search config
@@ -77,15 +224,97 @@ func SearchConfig(c *fiber.Ctx) error {
 	}
 }
 
+// BackfillSearchIndex
+//
+// @Summary Backfill Fields Of The Search Index, admin only
+// @Description Reindex all searchable floors in the background, so that documents indexed before hole_id, division_id, tag_ids etc. are added can be filtered.
+// @Tags Search
+// @Produce application/json
+// @Router /config/search/_backfill [post]
+// @Success 202 {object} Map
+func BackfillSearchIndex(c *fiber.Ctx) error {
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.IsAdmin {
+		return common.Forbidden()
+	}
+	if ES == nil {
+		return common.BadRequest("Elasticsearch 未启用")
+	}
+
+	go func() {
+		err := BackfillFloorIndex(context.Background())
+		if err != nil {
+			log.Err(err).Msg("backfill floor index failed")
+		}
+	}()
+
+	MyLog("Search", "Backfill", 0, user.ID, RoleAdmin)
+	return c.Status(202).JSON(Map{"message": "开始回填"})
+}
+
+// ReindexSearch
+//
+// @Summary Rebuild The Search Index, admin only
+// @Description Copy all searchable floors into a new index in the background, then switch searching to it without downtime.
+// @Tags Search
+// @Produce application/json
+// @Router /config/search/_reindex [post]
+// @Success 202 {object} Map
+func ReindexSearch(c *fiber.Ctx) error {
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.IsAdmin {
+		return common.Forbidden()
+	}
+	if ES == nil {
+		return common.BadRequest("Elasticsearch 未启用")
+	}
+	if GetReindexStatus().Running {
+		return common.BadRequest("索引正在重建")
+	}
+
+	go func() {
+		_ = ReindexFloors(context.Background())
+	}()
+
+	MyLog("Search", "Reindex", 0, user.ID, RoleAdmin)
+	return c.Status(202).JSON(Map{"message": "开始重建"})
+}
+
+// GetReindexSearchStatus
+//
+// @Summary Get Progress Of Rebuilding The Search Index, admin only
+// @Tags Search
+// @Produce application/json
+// @Router /config/search/_reindex [get]
+// @Success 200 {object} models.ReindexStatus
+func GetReindexSearchStatus(c *fiber.Ctx) error {
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.IsAdmin {
+		return common.Forbidden()
+	}
+	return c.JSON(GetReindexStatus())
+}
+
 func SearchFloorsOld(c *fiber.Ctx, query *ListOldModel) error {
 	if !DynamicConfig.OpenSearch.Load() {
 		return common.Forbidden("茶楼流量激增，搜索功能暂缓开放")
 	}
 
-	floors, err := Search(c, query.Search, query.Size, query.Offset, false, nil, nil)
+	start := time.Now()
+	floors, err := Search(c, SearchRequest{Keyword: query.Search, Size: query.Size, Offset: query.Offset})
 	if err != nil {
 		return err
 	}
+	recordSearchEvent(query.Search, nil, len(floors), start)
 
 	return Serialize(c, &floors)
 }
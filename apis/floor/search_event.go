@@ -0,0 +1,168 @@
+package floor
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+
+	"treehole_next/config"
+	. "treehole_next/models"
+	"treehole_next/utils/search"
+)
+
+var searchEventsChan = make(chan SearchEvent, 1000)
+
+// recordSearchEvent saves the event in background, events are dropped if too many are waiting
+func recordSearchEvent(query string, request *SearchRequest, resultCount int, start time.Time) {
+	event := NewSearchEvent(search.NormalizeQuery(query), request, resultCount, time.Since(start))
+	if config.Config.Mode == "test" {
+		saveSearchEvents([]SearchEvent{event})
+		return
+	}
+	select {
+	case searchEventsChan <- event:
+	default:
+		log.Warn().Msg("search events channel is full, event dropped")
+	}
+}
+
+func saveSearchEvents(events []SearchEvent) {
+	if len(events) == 0 {
+		return
+	}
+	err := DB.CreateInBatches(events, 500).Error
+	if err != nil {
+		log.Err(err).Int("count", len(events)).Msg("error saving search events")
+	}
+}
+
+// SaveSearchEvents saves recorded search events in batches
+func SaveSearchEvents(ctx context.Context) {
+	ticker := time.NewTicker(time.Second * 60)
+	defer ticker.Stop()
+	events := make([]SearchEvent, 0, 100)
+	for {
+		select {
+		case <-ticker.C:
+			saveSearchEvents(events)
+			events = events[:0]
+		case event := <-searchEventsChan:
+			events = append(events, event)
+		case <-ctx.Done():
+			saveSearchEvents(events)
+			log.Info().Msg("task SaveSearchEvents stopped...")
+			return
+		}
+	}
+}
+
+func purgeSearchEvents() error {
+	return DB.Exec(
+		"DELETE FROM search_event WHERE created_at < ?",
+		time.Now().Add(-time.Hour*24*time.Duration(config.Config.SearchEventPurgeDays)),
+	).Error
+}
+
+// PurgeSearchEvents deletes search events older than config.Config.SearchEventPurgeDays daily
+func PurgeSearchEvents(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour * 24)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := purgeSearchEvents()
+			if err != nil {
+				log.Err(err).Msg("error purge search events")
+			}
+		case <-ctx.Done():
+			log.Info().Msg("task PurgeSearchEvents stopped...")
+			return
+		}
+	}
+}
+
+type SearchStatsQuery struct {
+	// count searches in the last days
+	Days int `json:"days" query:"days" default:"7" validate:"min=1,max=365"`
+	Size int `json:"size" query:"size" default:"20" validate:"min=1,max=100"`
+}
+
+func (query SearchStatsQuery) Since() time.Time {
+	return time.Now().AddDate(0, 0, -query.Days)
+}
+
+// validateSearchStatsQuery checks the user is an admin and validates the query
+func validateSearchStatsQuery(c *fiber.Ctx) (query SearchStatsQuery, err error) {
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return query, err
+	}
+	if !user.IsAdmin {
+		return query, common.Forbidden()
+	}
+	err = common.ValidateQuery(c, &query)
+	return query, err
+}
+
+// ListTopSearchQueries
+//
+// @Summary List The Most Searched Queries, admin only
+// @Tags Search
+// @Produce application/json
+// @Router /config/search/_top_queries [get]
+// @Param object query SearchStatsQuery false "query"
+// @Success 200 {array} models.SearchQueryStat
+func ListTopSearchQueries(c *fiber.Ctx) error {
+	query, err := validateSearchStatsQuery(c)
+	if err != nil {
+		return err
+	}
+	stats, err := TopSearchQueries(DB, query.Since(), false, query.Size)
+	if err != nil {
+		return err
+	}
+	return c.JSON(stats)
+}
+
+// ListZeroResultSearchQueries
+//
+// @Summary List The Most Searched Queries Without Results, admin only
+// @Tags Search
+// @Produce application/json
+// @Router /config/search/_zero_result_queries [get]
+// @Param object query SearchStatsQuery false "query"
+// @Success 200 {array} models.SearchQueryStat
+func ListZeroResultSearchQueries(c *fiber.Ctx) error {
+	query, err := validateSearchStatsQuery(c)
+	if err != nil {
+		return err
+	}
+	stats, err := TopSearchQueries(DB, query.Since(), true, query.Size)
+	if err != nil {
+		return err
+	}
+	return c.JSON(stats)
+}
+
+// GetSearchLatency
+//
+// @Summary Get Latency Percentiles Of Searching In Milliseconds By Backend, admin only
+// @Tags Search
+// @Produce application/json
+// @Router /config/search/_latency [get]
+// @Param object query SearchStatsQuery false "query, size is ignored"
+// @Success 200 {array} models.SearchLatencyStat
+func GetSearchLatency(c *fiber.Ctx) error {
+	query, err := validateSearchStatsQuery(c)
+	if err != nil {
+		return err
+	}
+	stats, err := SearchLatencyStats(DB, query.Since())
+	if err != nil {
+		return err
+	}
+	return c.JSON(stats)
+}
@@ -68,7 +68,12 @@ func ListHomePage(c *fiber.Ctx) (err error) {
 			return nil
 		}
 
-		querySet, err := holes.MakeQuerySet(query.Offset, query.Size, query.Order, c, tx)
+		var querySet *gorm.DB
+		if query.Order == "hot" {
+			querySet, err = holes.MakeHotQuerySet(query.HotCursor(), query.Size, c, tx)
+		} else {
+			querySet, err = holes.MakeQuerySet(query.Offset, query.Size, query.Order, c, tx)
+		}
 		if err != nil {
 			return err
 		}
@@ -135,7 +140,12 @@ func ListHolesByDivision(c *fiber.Ctx) error {
 
 	// get holes
 	var holes Holes
-	querySet, err := holes.MakeQuerySet(query.Offset, query.Size, query.Order, c)
+	var querySet *gorm.DB
+	if query.Order == "hot" {
+		querySet, err = holes.MakeHotQuerySet(query.HotCursor(), query.Size, c)
+	} else {
+		querySet, err = holes.MakeQuerySet(query.Offset, query.Size, query.Order, c)
+	}
 	if err != nil {
 		return err
 	}
@@ -226,7 +236,12 @@ func ListHolesByTag(c *fiber.Ctx) error {
 
 	// get holes
 	var holes Holes
-	querySet, err := holes.MakeQuerySet(query.Offset, query.Size, "", c)
+	var querySet *gorm.DB
+	if query.Order == "hot" {
+		querySet, err = holes.MakeHotQuerySet(query.HotCursor(), query.Size, c)
+	} else {
+		querySet, err = holes.MakeQuerySet(query.Offset, query.Size, "", c)
+	}
 	if err != nil {
 		return err
 	}
@@ -429,6 +444,98 @@ func GetHole(c *fiber.Ctx) error {
 	return Serialize(c, &hole)
 }
 
+// ListRelatedHoles
+//
+// @Summary List Holes Related To A Hole
+// @Description Holes with similar first floors, holes sharing tags rank higher
+// @Tags Hole
+// @Produce application/json
+// @Router /holes/{id}/related [get]
+// @Param id path int true "id"
+// @Param object query RelatedModel false "query"
+// @Success 200 {array} Hole
+// @Failure 404 {object} MessageModel
+func ListRelatedHoles(c *fiber.Ctx) error {
+	var query RelatedModel
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+	id, _ := c.ParamsInt("id")
+
+	querySet, err := MakeHoleQuerySet(c)
+	if err != nil {
+		return err
+	}
+	var hole Hole
+	err = querySet.Take(&hole, id).Error
+	if err != nil {
+		return err
+	}
+
+	holes, err := RelatedHoles(c, &hole, query.Size)
+	if err != nil {
+		return err
+	}
+	return Serialize(c, &holes)
+}
+
+// ListSimilarHoles
+//
+// @Summary List Holes Similar To A Hole To Be Created
+// @Description Find existing holes similar to the content before creating a hole, holes sharing tags rank higher
+// @Tags Hole
+// @Produce application/json
+// @Router /holes/_similar [post]
+// @Param json body SimilarModel true "json"
+// @Success 200 {array} Hole
+func ListSimilarHoles(c *fiber.Ctx) error {
+	var body SimilarModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	tagIDs := make([]int, 0, len(body.Tags))
+	if len(body.Tags) > 0 {
+		err = DB.Model(&Tag{}).Where("name IN ?", body.Tags).Pluck("id", &tagIDs).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	holes, err := SimilarHoles(c, SimilarRequest{
+		Content: body.Content,
+		TagIDs:  tagIDs,
+		Size:    body.Size,
+	})
+	if err != nil {
+		return err
+	}
+	return Serialize(c, &holes)
+}
+
+// checkDuplicateHole returns 409 if the user created a hole with nearly the same content recently
+func checkDuplicateHole(userID int, content string) error {
+	holeID, err := FindDuplicateHole(userID, content)
+	if err != nil {
+		return err
+	}
+	if holeID == 0 {
+		return nil
+	}
+	return &common.HttpError{
+		Code:    409,
+		Message: fmt.Sprintf("您最近发过内容相近的帖子 #%d", holeID),
+		Detail: &common.ErrorDetail{{
+			Tag:     "duplicate",
+			Field:   "content",
+			Param:   strconv.Itoa(holeID),
+			Message: "内容与最近发布的帖子相近",
+		}},
+	}
+}
+
 // CreateHole
 //
 // @Summary Create A Hole
@@ -467,6 +574,13 @@ func CreateHole(c *fiber.Ctx) error {
 		return common.Forbidden(user.BanDivisionMessage(divisionID))
 	}
 
+	if body.CheckDuplicate {
+		err = checkDuplicateHole(user.ID, body.Content)
+		if err != nil {
+			return err
+		}
+	}
+
 	// special tag
 	if body.SpecialTag != "" && !user.IsAdmin && !slices.Contains(user.SpecialTags, body.SpecialTag) {
 		return common.Forbidden("非管理员禁止发含有特殊标签的洞")
@@ -494,8 +608,9 @@ func CreateHole(c *fiber.Ctx) error {
 		}},
 		UserID:     user.ID,
 		DivisionID: divisionID,
+		Poll:       body.Poll.ToModel(),
 	}
-	err = hole.Create(DB, user, body.ToName(), c)
+	err = hole.Create(DB, user, body.ToName(), body.CheckSimilarTags, c)
 	if err != nil {
 		return err
 	}
@@ -535,6 +650,13 @@ func CreateHoleOld(c *fiber.Ctx) error {
 		return common.Forbidden(user.BanDivisionMessage(body.DivisionID))
 	}
 
+	if body.CheckDuplicate {
+		err = checkDuplicateHole(user.ID, body.Content)
+		if err != nil {
+			return err
+		}
+	}
+
 	// special tag
 	if body.SpecialTag != "" && !user.IsAdmin && !slices.Contains(user.SpecialTags, body.SpecialTag) {
 		return common.Forbidden("非管理员禁止发含有特殊标签的洞")
@@ -563,8 +685,9 @@ func CreateHoleOld(c *fiber.Ctx) error {
 		}},
 		UserID:     user.ID,
 		DivisionID: body.DivisionID,
+		Poll:       body.Poll.ToModel(),
 	}
-	err = hole.Create(DB, user, body.ToName(), c)
+	err = hole.Create(DB, user, body.ToName(), body.CheckSimilarTags, c)
 	if err != nil {
 		return err
 	}
@@ -619,6 +742,8 @@ func ModifyHole(c *fiber.Ctx) error {
 	var hole Hole
 
 	changed := false
+	// whether floors should be reindexed into Elasticsearch
+	reindex := false
 
 	err = DB.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
 		// lock for update
@@ -637,6 +762,7 @@ func ModifyHole(c *fiber.Ctx) error {
 		if body.DivisionID != nil && *body.DivisionID != 0 && *body.DivisionID != hole.DivisionID {
 			hole.DivisionID = *body.DivisionID
 			changed = true
+			reindex = true
 			// log
 			MyLog("Hole", "Modify", holeID, user.ID, RoleAdmin, "DivisionID to: ", strconv.Itoa(hole.DivisionID))
 		}
@@ -650,7 +776,7 @@ func ModifyHole(c *fiber.Ctx) error {
 				// delete floors from Elasticsearch
 				var floors Floors
 				_ = DB.Where("hole_id = ?", hole.ID).Find(&floors)
-				go BulkDelete(Models2IDSlice(floors))
+				BulkDelete(Models2IDSlice(floors))
 
 				// log
 				MyLog("Hole", "Modify", holeID, user.ID, RoleAdmin, "Hidden: ")
@@ -659,17 +785,7 @@ func ModifyHole(c *fiber.Ctx) error {
 				changed = true
 
 				// reindex into Elasticsearch
-				var floors Floors
-				_ = DB.Where("hole_id = ?", hole.ID).Find(&floors)
-				var floorModels []FloorModel
-				for _, floor := range floors {
-					floorModels = append(floorModels, FloorModel{
-						ID:        floor.ID,
-						UpdatedAt: floor.UpdatedAt,
-						Content:   floor.Content,
-					})
-				}
-				go BulkInsert(floorModels)
+				reindex = true
 
 				// log
 				MyLog("Hole", "Modify", holeID, user.ID, RoleAdmin, "Unhidden: ")
@@ -680,17 +796,7 @@ func ModifyHole(c *fiber.Ctx) error {
 				changed = true
 
 				// reindex into Elasticsearch
-				var floors Floors
-				_ = DB.Where("hole_id = ?", hole.ID).Find(&floors)
-				var floorModels []FloorModel
-				for _, floor := range floors {
-					floorModels = append(floorModels, FloorModel{
-						ID:        floor.ID,
-						UpdatedAt: floor.UpdatedAt,
-						Content:   floor.Content,
-					})
-				}
-				go BulkInsert(floorModels)
+				reindex = true
 
 				// log
 				MyLog("Hole", "Modify", holeID, user.ID, RoleAdmin, "Unhidden: ")
@@ -700,7 +806,8 @@ func ModifyHole(c *fiber.Ctx) error {
 		// modify tags
 		if len(body.Tags) != 0 {
 			changed = true
-			hole.Tags, err = FindOrCreateTags(tx, user, body.ToName())
+			reindex = true
+			hole.Tags, err = FindOrCreateTags(tx, user, body.ToName(), body.CheckSimilarTags)
 			if err != nil {
 				return err
 			}
@@ -754,6 +861,27 @@ func ModifyHole(c *fiber.Ctx) error {
 			MyLog("Hole", "Modify", holeID, user.ID, RoleAdmin, "Frozen: ")
 		}
 
+		// modify poll
+		if body.ClosePoll != nil || body.DeletePoll != nil {
+			var poll Poll
+			err = tx.Where("hole_id = ?", hole.ID).Take(&poll).Error
+			if err != nil {
+				return err
+			}
+			changed = true
+
+			if body.DeletePoll != nil && *body.DeletePoll {
+				err = poll.Delete(tx)
+				MyLog("Hole", "Modify", holeID, user.ID, RoleAdmin, "DeletePoll: ")
+			} else if body.ClosePoll != nil {
+				err = tx.Model(&poll).Update("closed", *body.ClosePoll).Error
+				MyLog("Hole", "Modify", holeID, user.ID, RoleAdmin, "ClosePoll: ", strconv.FormatBool(*body.ClosePoll))
+			}
+			if err != nil {
+				return err
+			}
+		}
+
 		// save
 		if changed {
 			err = tx.Model(&hole).
@@ -788,6 +916,10 @@ func ModifyHole(c *fiber.Ctx) error {
 		return err
 	}
 
+	if reindex && !hole.Hidden {
+		IndexHoleFloors(DB, hole.ID)
+	}
+
 	// update cache
 	if changed {
 		err = UpdateHoleCache(Holes{&hole})
@@ -860,7 +992,7 @@ func HideHole(c *fiber.Ctx) error {
 	// delete floors from Elasticsearch
 	var floors Floors
 	_ = DB.Where("hole_id = ?", hole.ID).Find(&floors)
-	go BulkDelete(Models2IDSlice(floors))
+	BulkDelete(Models2IDSlice(floors))
 	err = message.DeleteMessageByRelatedHoleID(DB, hole.ID)
 	if err != nil {
 		return err
@@ -872,7 +1004,7 @@ func HideHole(c *fiber.Ctx) error {
 // PatchHole
 //
 // @Summary Patch A Hole
-// @Description Add hole.view
+// @Description Add hole.view, views of the same user within a window are counted once
 // @Tags Hole
 // @Produce application/json
 // @Router /holes/{id} [patch]
@@ -885,7 +1017,15 @@ func PatchHole(c *fiber.Ctx) error {
 		return err
 	}
 
-	holeViewsChan <- holeID
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	err = viewHole(holeID, userID)
+	if err != nil {
+		return err
+	}
 
 	return c.Status(204).JSON(nil)
 }
@@ -949,7 +1089,7 @@ func DeleteHole(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
-	go BulkDelete(Models2IDSlice(floors))
+	BulkDelete(Models2IDSlice(floors))
 
 	err = DeleteCache("divisions")
 	if err != nil {
@@ -0,0 +1,110 @@
+package hole
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"treehole_next/config"
+	. "treehole_next/models"
+)
+
+const hotScoreBatchSize = 500
+
+func updateHoleHotScore() error {
+	since := time.Now().AddDate(0, 0, -config.Config.HoleHotWindowDays)
+
+	var holes []struct {
+		ID            int
+		View          int
+		Reply         int
+		FavoriteCount int
+		CreatedAt     time.Time
+	}
+	err := DB.Model(&Hole{}).
+		Select("id", "view", "reply", "favorite_count", "created_at").
+		Where("created_at > ?", since).
+		Scan(&holes).Error
+	if err != nil {
+		return err
+	}
+	if len(holes) == 0 {
+		return nil
+	}
+
+	var holeLikes []struct {
+		HoleID int
+		Likes  int
+	}
+	err = DB.Model(&Floor{}).
+		Select("hole_id, SUM(`like`) AS likes").
+		Where("hole_id IN (?)", DB.Model(&Hole{}).Select("id").Where("created_at > ?", since)).
+		Group("hole_id").
+		Scan(&holeLikes).Error
+	if err != nil {
+		return err
+	}
+	likes := make(map[int]int, len(holeLikes))
+	for _, holeLike := range holeLikes {
+		likes[holeLike.HoleID] = holeLike.Likes
+	}
+
+	/*
+		UPDATE hole
+		SET hot_score = CASE id
+			WHEN 1 THEN 1.23
+			WHEN 2 THEN 4.56
+		END
+		WHERE id IN (1,2)
+	*/
+	for start := 0; start < len(holes); start += hotScoreBatchSize {
+		end := min(start+hotScoreBatchSize, len(holes))
+		keys := make([]string, 0, end-start)
+
+		var builder strings.Builder
+		builder.WriteString("UPDATE hole SET hot_score = CASE id ")
+		for _, hole := range holes[start:end] {
+			score := HoleHotScore(hole.View, hole.Reply, hole.FavoriteCount, likes[hole.ID], hole.CreatedAt)
+			builder.WriteString(fmt.Sprintf("WHEN %d THEN %s ", hole.ID, strconv.FormatFloat(score, 'f', -1, 64)))
+			keys = append(keys, strconv.Itoa(hole.ID))
+		}
+		builder.WriteString("END WHERE id IN (")
+		builder.WriteString(strings.Join(keys, ","))
+		builder.WriteString(")")
+
+		err = DB.Exec(builder.String()).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Info().Int("count", len(holes)).Msg("update hole hot score success")
+	return nil
+}
+
+func UpdateHoleHotScore(ctx context.Context) {
+	// scores are 0 before the first update, do not wait for the first tick after deploying
+	err := updateHoleHotScore()
+	if err != nil {
+		log.Err(err).Msg("error update hole hot score")
+	}
+
+	ticker := time.NewTicker(time.Minute * 10)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := updateHoleHotScore()
+			if err != nil {
+				log.Err(err).Msg("error update hole hot score")
+			}
+		case <-ctx.Done():
+			log.Info().Msg("task UpdateHoleHotScore stopped...")
+			return
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package hole
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// MergeHole
+//
+// @Summary Merge A Hole Into Another, admin only
+// @Description Move all floors of from_hole_id into this hole, carry over favorites and subscriptions, then hide the merged hole with a notice.
+// @Tags Hole
+// @Accept application/json
+// @Produce application/json
+// @Router /holes/{id}/_merge [post]
+// @Param id path int true "id of the hole to merge into"
+// @Param json body MergeModel true "json"
+// @Success 200 {object} Hole
+// @Failure 404 {object} MessageModel
+func MergeHole(c *fiber.Ctx) error {
+	var body MergeModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	holeID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.IsAdmin {
+		return common.Forbidden()
+	}
+	if holeID == body.FromHoleID {
+		return common.BadRequest("不能合并到自身")
+	}
+
+	var hole, from Hole
+	var floors Floors
+	err = DB.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		// lock for update, in id order to avoid deadlock
+		var holes Holes
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", []int{holeID, body.FromHoleID}).
+			Order("id").Find(&holes).Error
+		if err != nil {
+			return err
+		}
+		if len(holes) != 2 {
+			return gorm.ErrRecordNotFound
+		}
+		for _, h := range holes {
+			if h.ID == holeID {
+				hole = *h
+			} else {
+				from = *h
+			}
+		}
+
+		floors, err = hole.Merge(tx, &from, user.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	MyLog("Hole", "Merge", holeID, user.ID, RoleAdmin, "From: ", strconv.Itoa(from.ID))
+
+	// reindex moved floors into Elasticsearch
+	if hole.Hidden {
+		BulkDelete(Models2IDSlice(floors))
+	} else {
+		var visibleFloors Floors
+		for _, floor := range floors {
+			if !floor.Deleted && !floor.Sensitive() {
+				visibleFloors = append(visibleFloors, floor)
+			}
+		}
+		IndexFloors(DB, visibleFloors)
+	}
+
+	// update cache
+	err = UpdateHoleCache(Holes{&hole, &from})
+	if err != nil {
+		return err
+	}
+
+	return Serialize(c, &hole)
+}
@@ -92,7 +92,7 @@ func purgeHole() (err error) {
 		}
 
 		// delete floor in search engine
-		go BulkDelete(floorIDs)
+		BulkDelete(floorIDs)
 
 		// log
 		log.Info().
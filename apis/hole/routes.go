@@ -17,6 +17,8 @@ func RegisterRoutes(app fiber.Router) {
 	app.Get("/holes/:id<int>", GetHole)
 	app.Get("/holes", ListHoles)
 	app.Get("/holes/_good", ListGoodHoles)
+	app.Get("/holes/:id<int>/related", ListRelatedHoles)
+	app.Post("/holes/_similar", ListSimilarHoles)
 	app.Post("/divisions/:id/holes", utils.MiddlewareHasAnsweredQuestions, CreateHole)
 	app.Post("/holes", utils.MiddlewareHasAnsweredQuestions, CreateHoleOld)
 	app.Patch("/holes/:id<int>/_webvpn", ModifyHole)
@@ -24,6 +26,8 @@ func RegisterRoutes(app fiber.Router) {
 	app.Put("/holes/:id<int>", ModifyHole)
 	app.Delete("/holes/:id<int>", HideHole)
 	app.Delete("/holes/:id<int>/_force", DeleteHole)
+	app.Post("/holes/:id<int>/_merge", MergeHole)
+	app.Post("/holes/:id<int>/_split", SplitHole)
 	app.Get("/holes/:id<int>/summary", GenerateSummary)
 	app.Post("/holes/:id<int>/summary/feedback", GetFeedback)
 }
@@ -5,6 +5,7 @@ import (
 
 	"github.com/opentreehole/go-common"
 
+	"treehole_next/apis/poll"
 	"treehole_next/apis/tag"
 	"treehole_next/models"
 )
@@ -16,14 +17,35 @@ type ShowHomePageModel struct {
 	Offset0            common.CustomTime `json:"start_time" query:"offset" swaggertype:"string"` // updated time < offset (default is now)
 	Offset             common.CustomTime `json:"offset" query:"offset" swaggertype:"string"`
 	Tags               []string          `json:"tags" query:"tags"`
-	Order              string            `json:"order" query:"order"`
+	Order              string            `json:"order" query:"order"` // time_updated, time_created or hot
+	// order=hot only, hot_score and id of the last hole in the previous page
+	ScoreOffset *float64 `json:"score_offset" query:"score_offset"`
+	IDOffset    int      `json:"id_offset" query:"id_offset"`
+}
+
+func (q *ShowHomePageModel) HotCursor() *models.HoleHotCursor {
+	return hotCursor(q.ScoreOffset, q.IDOffset)
 }
 
 type QueryTime struct {
 	Size int `json:"size" query:"size" default:"10" validate:"max=10"`
 	// updated time < offset (default is now)
 	Offset common.CustomTime `json:"offset" query:"offset" swaggertype:"string"`
-	Order  string            `json:"order" query:"order"`
+	Order  string            `json:"order" query:"order"` // time_updated, time_created or hot
+	// order=hot only, hot_score and id of the last hole in the previous page
+	ScoreOffset *float64 `json:"score_offset" query:"score_offset"`
+	IDOffset    int      `json:"id_offset" query:"id_offset"`
+}
+
+func (q *QueryTime) HotCursor() *models.HoleHotCursor {
+	return hotCursor(q.ScoreOffset, q.IDOffset)
+}
+
+func hotCursor(scoreOffset *float64, idOffset int) *models.HoleHotCursor {
+	if scoreOffset == nil {
+		return nil
+	}
+	return &models.HoleHotCursor{Score: *scoreOffset, ID: idOffset}
 }
 
 func (q *QueryTime) SetDefaults() {
@@ -66,6 +88,8 @@ func (q *ListOldModel) SetDefaults() {
 
 type TagCreateModelSlice struct {
 	Tags []tag.CreateModel `json:"tags" validate:"omitempty,min=1,max=10,dive"` // All users
+	// return 409 with the similar tags in detail instead of creating new tags similar to existing ones
+	CheckSimilarTags bool `json:"check_similar_tags"`
 }
 
 func (tagCreateModelSlice TagCreateModelSlice) ToName() []string {
@@ -81,6 +105,10 @@ type CreateModel struct {
 	TagCreateModelSlice
 	// Admin and Operator only
 	SpecialTag string `json:"special_tag" validate:"max=16"`
+	// optional poll attached to the hole
+	Poll *poll.CreateModel `json:"poll" validate:"omitempty"`
+	// return 409 if the user posted a hole with nearly the same content recently, the hole id is in detail
+	CheckDuplicate bool `json:"check_duplicate"`
 }
 
 type CreateOldModel struct {
@@ -100,6 +128,8 @@ type ModifyModel struct {
 	Unhidden   *bool `json:"unhidden"`                               // admin only
 	Lock       *bool `json:"lock"`                                   // admin only
 	Frozen     *bool `json:"frozen"`                                 // admin only
+	ClosePoll  *bool `json:"close_poll"`                             // admin only, true to close and false to reopen
+	DeletePoll *bool `json:"delete_poll"`                            // admin only
 }
 
 func (body ModifyModel) CheckPermission(user *models.User, hole *models.Hole) error {
@@ -124,11 +154,41 @@ func (body ModifyModel) CheckPermission(user *models.User, hole *models.Hole) er
 	if body.Frozen != nil && !user.IsAdmin {
 		return common.Forbidden("非管理员禁止冻结帖子")
 	}
+	if (body.ClosePoll != nil || body.DeletePoll != nil) && !user.IsAdmin {
+		return common.Forbidden("非管理员禁止修改投票")
+	}
 	return nil
 }
 
 func (body ModifyModel) DoNothing() bool {
-	return body.Hidden == nil && body.Unhidden == nil && body.Tags == nil && body.DivisionID == nil && body.Lock == nil && body.Frozen == nil
+	return body.Hidden == nil && body.Unhidden == nil && body.Tags == nil && body.DivisionID == nil && body.Lock == nil && body.Frozen == nil &&
+		body.ClosePoll == nil && body.DeletePoll == nil
+}
+
+type RelatedModel struct {
+	Size int `json:"size" query:"size" default:"5" validate:"min=1,max=10"`
+}
+
+type SimilarModel struct {
+	// content of the hole to be created
+	Content string `json:"content" validate:"required,max=10000"`
+	// tag names of the hole to be created, holes sharing tags rank higher
+	Tags []string `json:"tags" validate:"omitempty,max=10"`
+	Size int      `json:"size" default:"5" validate:"min=1,max=10"`
+}
+
+type MergeModel struct {
+	// id of the hole to be merged and hidden
+	FromHoleID int `json:"from_hole_id" validate:"required,min=1"`
+}
+
+type SplitModel struct {
+	// floors to be moved, the first floor of the hole is not allowed
+	FloorIDs []int `json:"floor_ids" validate:"required,min=1,dive,min=1"`
+	// division of the new hole
+	DivisionID int `json:"division_id" validate:"required,min=1"`
+	// tags of the new hole, default to tags of the split hole
+	TagCreateModelSlice
 }
 
 type Summary struct {
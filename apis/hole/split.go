@@ -0,0 +1,103 @@
+package hole
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// SplitHole
+//
+// @Summary Split Floors Into A New Hole, admin only
+// @Description Move the selected floors into a new hole in the given division, the first floor can not be moved. Authors of the moved floors are notified.
+// @Tags Hole
+// @Accept application/json
+// @Produce application/json
+// @Router /holes/{id}/_split [post]
+// @Param id path int true "id of the hole to split"
+// @Param json body SplitModel true "json"
+// @Success 201 {object} Hole
+// @Failure 404 {object} MessageModel
+func SplitHole(c *fiber.Ctx) error {
+	var body SplitModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+	holeID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.IsAdmin {
+		return common.Forbidden()
+	}
+
+	var division Division
+	err = DB.Take(&division, body.DivisionID).Error
+	if err != nil {
+		return err
+	}
+
+	newHole := Hole{DivisionID: body.DivisionID}
+	if len(body.Tags) > 0 {
+		newHole.Tags, err = FindOrCreateTags(DB, user, body.ToName(), body.CheckSimilarTags)
+		if err != nil {
+			return err
+		}
+	}
+
+	var hole Hole
+	var floors Floors
+	err = DB.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		// lock for update
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&hole, holeID).Error
+		if err != nil {
+			return err
+		}
+
+		// default to tags of the hole
+		if len(newHole.Tags) == 0 {
+			err = tx.Model(&hole).Association("Tags").Find(&newHole.Tags)
+			if err != nil {
+				return err
+			}
+		}
+
+		floors, err = hole.Split(tx, body.FloorIDs, &newHole, user.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	MyLog("Hole", "Split", holeID, user.ID, RoleAdmin, "NewHole: ", strconv.Itoa(newHole.ID))
+
+	// moved floors belong to the new hole in Elasticsearch
+	IndexHoleFloors(DB, newHole.ID)
+
+	err = newHole.SendSplit(floors)
+	if err != nil {
+		log.Err(err).Str("model", "Notification").Msg("SendSplit failed")
+	}
+
+	// update cache
+	err = UpdateHoleCache(Holes{&hole, &newHole})
+	if err != nil {
+		return err
+	}
+
+	return Serialize(c.Status(201), &newHole)
+}
@@ -8,12 +8,50 @@ import (
 	"time"
 
 	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/maps"
+	"gorm.io/gorm/clause"
 
+	"treehole_next/config"
 	. "treehole_next/models"
+	"treehole_next/utils"
 )
 
-var holeViewsChan = make(chan int, 1000)
+type holeView struct {
+	HoleID int
+	UserID int
+}
+
+var holeViewsChan = make(chan holeView, 1000)
+var holeViewsFlush = make(chan chan struct{})
 var holeViews = map[int]int{}
+var holeViewers = map[holeView]bool{}
+
+// viewHole counts a view of the user, views within config.Config.HoleViewWindowSeconds are counted once
+func viewHole(holeID, userID int) error {
+	key := fmt.Sprintf("hole_view_%d_%d", holeID, userID)
+	added, err := utils.SetCacheIfAbsent(key, true, time.Duration(config.Config.HoleViewWindowSeconds)*time.Second)
+	if err != nil {
+		return err
+	}
+	if !added {
+		return nil
+	}
+
+	holeViewsChan <- holeView{HoleID: holeID, UserID: userID}
+	return nil
+}
+
+// FlushHoleViews saves views received so far by the running UpdateHoleViews without waiting for the next tick
+func FlushHoleViews() {
+	done := make(chan struct{})
+	holeViewsFlush <- done
+	<-done
+}
+
+func addHoleView(view holeView) {
+	holeViews[view.HoleID]++
+	holeViewers[view] = true
+}
 
 func updateHoleViews() {
 	/*
@@ -51,6 +89,35 @@ func updateHoleViews() {
 	}
 }
 
+func updateHoleUniqueViews() {
+	if len(holeViewers) == 0 {
+		return
+	}
+	viewers := make([]HoleViewer, 0, len(holeViewers))
+	holeIDs := make(map[int]bool)
+	for view := range holeViewers {
+		viewers = append(viewers, HoleViewer{HoleID: view.HoleID, UserID: view.UserID})
+		holeIDs[view.HoleID] = true
+		delete(holeViewers, view)
+	}
+
+	err := DB.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(viewers, 500).Error
+	if err != nil {
+		log.Err(err).Msg("update hole unique views failed")
+		return
+	}
+
+	err = DB.Exec(
+		"UPDATE hole SET unique_view = (SELECT COUNT(*) FROM hole_viewer WHERE hole_viewer.hole_id = hole.id) WHERE id IN ?",
+		maps.Keys(holeIDs),
+	).Error
+	if err != nil {
+		log.Err(err).Msg("update hole unique views failed")
+	} else {
+		log.Info().Int("count", len(holeIDs)).Msg("update hole unique views success")
+	}
+}
+
 func UpdateHoleViews(ctx context.Context) {
 
 	ticker := time.NewTicker(time.Second * 60)
@@ -59,10 +126,19 @@ func UpdateHoleViews(ctx context.Context) {
 		select {
 		case <-ticker.C:
 			updateHoleViews()
-		case holeID := <-holeViewsChan:
-			holeViews[holeID]++
+			updateHoleUniqueViews()
+		case view := <-holeViewsChan:
+			addHoleView(view)
+		case done := <-holeViewsFlush:
+			for len(holeViewsChan) > 0 {
+				addHoleView(<-holeViewsChan)
+			}
+			updateHoleViews()
+			updateHoleUniqueViews()
+			close(done)
 		case <-ctx.Done():
 			updateHoleViews()
+			updateHoleUniqueViews()
 			log.Info().Msg("task UpdateHoleViews stopped...")
 			return
 		}
@@ -1,6 +1,8 @@
 package message
 
 import (
+	"errors"
+
 	"github.com/opentreehole/go-common"
 	"gorm.io/gorm"
 
@@ -31,22 +33,24 @@ func ListMessages(c *fiber.Ctx) error {
 
 	messages := Messages{}
 
+	condition := "message.id = message_user.message_id and message_user.user_id = ?"
+	values := []any{userID}
 	if query.NotRead {
-		DB.Raw(`
-			SELECT message.*,message_user.has_read FROM message
-			INNER JOIN message_user 
-			WHERE message.id = message_user.message_id and message_user.user_id = ? and message_user.has_read = false
-			ORDER BY updated_at DESC`,
-			userID,
-		).Scan(&messages)
-	} else {
-		DB.Raw(`
-			SELECT message.*,message_user.has_read FROM message
-			INNER JOIN message_user
-			WHERE message.id = message_user.message_id and message_user.user_id = ?
-			ORDER BY updated_at DESC`,
-			userID,
-		).Scan(&messages)
+		condition += " and message_user.has_read = false"
+	}
+	if query.Type != "" {
+		condition += " and message.type = ?"
+		values = append(values, query.Type)
+	}
+	err = DB.Raw(`
+		SELECT message.*,message_user.has_read FROM message
+		INNER JOIN message_user
+		WHERE `+condition+`
+		ORDER BY updated_at DESC`,
+		values...,
+	).Scan(&messages).Error
+	if err != nil {
+		return err
 	}
 
 	return Serialize(c, &messages)
@@ -111,12 +115,9 @@ func ClearMessages(c *fiber.Ctx) error {
 		return err
 	}
 
-	result := DB.Exec(
-		"UPDATE message_user SET has_read = true WHERE user_id = ?",
-		userID,
-	)
-	if result.Error != nil {
-		return result.Error
+	_, err = MarkMessages(DB, userID, "", true)
+	if err != nil {
+		return err
 	}
 	return c.Status(204).JSON(nil)
 }
@@ -153,9 +154,97 @@ func DeleteMessage(c *fiber.Ctx) error {
 	if result.Error != nil {
 		return result.Error
 	}
+	InvalidateUnreadCount(userID)
+	return c.Status(204).JSON(nil)
+}
+
+// ModifyMessage
+// @Summary Mark a message of a user as read or unread
+// @Tags Message
+// @Produce application/json
+// @Router /messages/{id} [patch]
+// @Param id path int true "message id"
+// @Param json body ModifyModel true "json"
+// @Success 204
+// @Failure 404 {object} MessageModel
+func ModifyMessage(c *fiber.Ctx) error {
+	var body ModifyModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	id, _ := c.ParamsInt("id")
+	// RowsAffected is 0 if has_read is not changed on mysql, so check the existence first
+	var messageUser MessageUser
+	err = DB.Where("user_id = ? AND message_id = ?", userID, id).Take(&messageUser).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return common.NotFound("消息不存在")
+		}
+		return err
+	}
+	err = DB.Model(&MessageUser{}).
+		Where("user_id = ? AND message_id = ?", userID, id).
+		Update("has_read", *body.HasRead).Error
+	if err != nil {
+		return err
+	}
+	InvalidateUnreadCount(userID)
 	return c.Status(204).JSON(nil)
 }
 
+// MarkMessagesByType
+// @Summary Mark all messages of a user as read or unread
+// @Description Mark messages of the type, or all messages if type is empty
+// @Tags Message
+// @Produce application/json
+// @Router /messages/_mark [post]
+// @Param json body MarkModel true "json"
+// @Success 200 {object} Map
+func MarkMessagesByType(c *fiber.Ctx) error {
+	var body MarkModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	marked, err := MarkMessages(DB, userID, body.Type, *body.HasRead)
+	if err != nil {
+		return err
+	}
+	return c.JSON(Map{"marked": marked})
+}
+
+// GetUnreadMessageCount
+// @Summary Count unread messages of a user by type
+// @Tags Message
+// @Produce application/json
+// @Router /messages/_unread_count [get]
+// @Success 200 {object} UnreadCount
+func GetUnreadMessageCount(c *fiber.Ctx) error {
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	count, err := GetUnreadCount(DB, userID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(count)
+}
+
 func deleteMessagesByCondition(db *gorm.DB, condition string, value int) error {
 	var messageIDs []int
 	if err := db.Model(&Message{}).Where(condition, value).Pluck("id", &messageIDs).Error; err != nil {
@@ -164,16 +253,32 @@ func deleteMessagesByCondition(db *gorm.DB, condition string, value int) error {
 	if len(messageIDs) == 0 {
 		return nil
 	}
+	var userIDs []int
+	if err := db.Model(&MessageUser{}).Where("message_id IN ?", messageIDs).Distinct().Pluck("user_id", &userIDs).Error; err != nil {
+		return err
+	}
 	if err := db.Where("message_id IN ?", messageIDs).Delete(&MessageUser{}).Error; err != nil {
 		return err
 	}
-	return db.Where("id IN ?", messageIDs).Delete(&Message{}).Error
+	if err := db.Where("id IN ?", messageIDs).Delete(&Message{}).Error; err != nil {
+		return err
+	}
+	InvalidateUnreadCount(userIDs...)
+	return nil
 }
 
+// DeleteMessageByRelatedFloorID deletes messages and queued digest items of the floor
 func DeleteMessageByRelatedFloorID(db *gorm.DB, floorID int) error {
+	if err := db.Where("floor_id = ?", floorID).Delete(&DigestItem{}).Error; err != nil {
+		return err
+	}
 	return deleteMessagesByCondition(db, "related_floor_id = ?", floorID)
 }
 
+// DeleteMessageByRelatedHoleID deletes messages and queued digest items of the hole
 func DeleteMessageByRelatedHoleID(db *gorm.DB, holeID int) error {
+	if err := db.Where("hole_id = ?", holeID).Delete(&DigestItem{}).Error; err != nil {
+		return err
+	}
 	return deleteMessagesByCondition(db, "related_hole_id = ?", holeID)
 }
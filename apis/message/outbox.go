@@ -0,0 +1,107 @@
+package message
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// DeliverNotificationsTask delivers the notification outbox periodically and when new entries are added
+func DeliverNotificationsTask(ctx context.Context) {
+	ticker := time.NewTicker(time.Second * 10)
+	defer ticker.Stop()
+	deliver := func() {
+		for {
+			delivered, err := DeliverNotifications()
+			if err != nil {
+				log.Err(err).Msg("error delivering notifications")
+				return
+			}
+			if delivered == 0 {
+				return
+			}
+		}
+	}
+	for {
+		select {
+		case <-ticker.C:
+			deliver()
+		case <-OutboxWakeup():
+			deliver()
+		case <-ctx.Done():
+			log.Info().Msg("task DeliverNotificationsTask stopped...")
+			return
+		}
+	}
+}
+
+// ListOutbox
+// @Summary List Pushes To The Notification Service, admin only
+// @Description Delivered pushes are removed, pending ones are being retried and dead ones are waiting to be replayed.
+// @Tags Message
+// @Produce application/json
+// @Router /messages/_outbox [get]
+// @Param object query ListOutboxModel false "query"
+// @Success 200 {array} NotificationOutbox
+func ListOutbox(c *fiber.Ctx) error {
+	var query ListOutboxModel
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.IsAdmin {
+		return common.Forbidden()
+	}
+
+	entries := NotificationOutboxes{}
+	err = DB.Where("status = ?", query.Status).
+		Order("id DESC").Offset(query.Offset).Limit(query.Size).
+		Find(&entries).Error
+	if err != nil {
+		return err
+	}
+	return c.JSON(entries)
+}
+
+// ReplayOutbox
+// @Summary Replay Dead Pushes To The Notification Service, admin only
+// @Tags Message
+// @Produce application/json
+// @Router /messages/_outbox/_replay [post]
+// @Param json body ReplayOutboxModel false "json"
+// @Success 200 {object} Map
+func ReplayOutbox(c *fiber.Ctx) error {
+	var body ReplayOutboxModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.IsAdmin {
+		return common.Forbidden()
+	}
+
+	replayed, err := ReplayNotifications(DB, body.IDs)
+	if err != nil {
+		return err
+	}
+
+	MyLog("Message", "ReplayOutbox", 0, user.ID, RoleAdmin, fmt.Sprintf("replayed: %d", replayed))
+	return c.JSON(Map{"replayed": replayed})
+}
@@ -9,4 +9,10 @@ func RegisterRoutes(app fiber.Router) {
 	app.Put("/messages", ClearMessagesDeprecated)
 	app.Patch("/messages/_webvpn", ClearMessagesDeprecated)
 	app.Delete("/messages/:id<int>", DeleteMessage)
+	app.Patch("/messages/:id<int>", ModifyMessage)
+	app.Post("/messages/_mark", MarkMessagesByType)
+	app.Get("/messages/_unread_count", GetUnreadMessageCount)
+	app.Get("/messages/_stream", StreamMessages)
+	app.Get("/messages/_outbox", ListOutbox)
+	app.Post("/messages/_outbox/_replay", ReplayOutbox)
 }
@@ -1,5 +1,7 @@
 package message
 
+import . "treehole_next/models"
+
 type CreateModel struct {
 	// MessageTypeMail
 	Description string `json:"description"`
@@ -8,4 +10,32 @@ type CreateModel struct {
 
 type ListModel struct {
 	NotRead bool `json:"not_read" default:"false" query:"not_read"`
+	// only messages of the type, default is all
+	Type MessageType `json:"type" query:"type"`
+}
+
+type ModifyModel struct {
+	HasRead *bool `json:"has_read" validate:"required"`
+}
+
+type MarkModel struct {
+	// only messages of the type, default is all
+	Type    MessageType `json:"type"`
+	HasRead *bool       `json:"has_read" validate:"required"`
+}
+
+type ListOutboxModel struct {
+	Status OutboxStatus `json:"status" query:"status" default:"dead" validate:"oneof=pending dead"`
+	Size   int          `json:"size" query:"size" default:"30" validate:"min=1,max=100"`
+	Offset int          `json:"offset" query:"offset" default:"0" validate:"min=0"`
+}
+
+type ReplayOutboxModel struct {
+	// ids of dead entries to replay, empty means all dead entries
+	IDs []int `json:"ids" validate:"omitempty,max=1000,dive,min=1"`
+}
+
+type StreamModel struct {
+	// resume from the message, the Last-Event-ID header takes precedence
+	LastID int `json:"last_id" query:"last_id" validate:"min=0"`
 }
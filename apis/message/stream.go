@@ -0,0 +1,129 @@
+package message
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+
+	. "treehole_next/models"
+)
+
+const (
+	// streamBacklogSize is the max number of missed messages sent when resuming
+	streamBacklogSize = 100
+	// streamHeartbeat keeps idle connections from being closed by proxies
+	streamHeartbeat = time.Second * 30
+)
+
+// StreamMessages
+// @Summary Stream New Messages of a User
+// @Description Server-Sent Events, each event is a message with its id as the event id.
+// @Description Reconnect with Last-Event-ID or last_id to receive messages missed in between.
+// @Tags Message
+// @Produce text/event-stream
+// @Router /messages/_stream [get]
+// @Param object query StreamModel false "query"
+// @Success 200 {array} Message
+func StreamMessages(c *fiber.Ctx) error {
+	var query StreamModel
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+	// resuming from 0 sends all messages up to the backlog size
+	resume := c.Query("last_id") != ""
+	if lastEventID := c.Get("Last-Event-ID"); lastEventID != "" {
+		query.LastID, err = strconv.Atoi(lastEventID)
+		if err != nil || query.LastID < 0 {
+			return common.BadRequest("Last-Event-ID 无效")
+		}
+		resume = true
+	}
+
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	// subscribe before loading missed messages, so that nothing is lost in between
+	messages, unsubscribe := SubscribeMessages(userID)
+	backlog := Messages{}
+	if resume {
+		err = DB.Raw(`
+			SELECT message.*,message_user.has_read FROM message
+			INNER JOIN message_user
+			WHERE message.id = message_user.message_id and message_user.user_id = ? and message.id > ?
+			ORDER BY message.id LIMIT ?`,
+			userID, query.LastID, streamBacklogSize,
+		).Scan(&backlog).Error
+		if err != nil {
+			unsubscribe()
+			return err
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+		send := func(message *Message) error {
+			_ = message.Preprocess(nil)
+			data, err := json.Marshal(message)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(w, "id: %d\nevent: message\ndata: %s\n\n", message.ID, data)
+			if err != nil {
+				return err
+			}
+			return w.Flush()
+		}
+
+		_, _ = fmt.Fprintf(w, "retry: %d\n\n", 3000)
+		if w.Flush() != nil {
+			return
+		}
+		sentID := query.LastID
+		for i := range backlog {
+			if send(&backlog[i]) != nil {
+				return
+			}
+			sentID = backlog[i].ID
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+				// already sent in the backlog
+				if message.ID <= sentID {
+					continue
+				}
+				err := send(message)
+				if err != nil {
+					log.Debug().Err(err).Int("user_id", userID).Msg("message stream closed")
+					return
+				}
+			case <-heartbeat.C:
+				_, _ = fmt.Fprint(w, ": heartbeat\n\n")
+				if w.Flush() != nil {
+					return
+				}
+			}
+		}
+	})
+	return nil
+}
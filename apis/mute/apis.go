@@ -0,0 +1,118 @@
+package mute
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+
+	. "treehole_next/models"
+)
+
+// ListMutes
+//
+// @Summary List User's Mutes
+// @Description Expired mutes are not listed.
+// @Tags Mute
+// @Produce application/json
+// @Router /users/me/mutes [get]
+// @Success 200 {array} models.UserMute
+func ListMutes(c *fiber.Ctx) error {
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	mutes, err := ListUserMutes(DB, userID)
+	if err != nil {
+		return err
+	}
+	return c.JSON(mutes)
+}
+
+// AddMute
+//
+// @Summary Mute A Hole Or A Floor
+// @Description Replies, mentions and subscriptions in a muted hole, and mentions of a muted floor, are not notified until time_expires.
+// @Description Muting a muted hole or floor again updates time_expires.
+// @Tags Mute
+// @Accept application/json
+// @Produce application/json
+// @Router /users/me/mutes [post]
+// @Param json body CreateModel true "json"
+// @Success 201 {object} models.UserMute
+// @Failure 400 {object} common.HttpError
+// @Failure 403 {object} common.HttpError "too many mutes"
+// @Failure 404 {object} common.HttpError
+func AddMute(c *fiber.Ctx) error {
+	var body CreateModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	mute := UserMute{UserID: userID, HoleID: body.HoleID, FloorID: body.FloorID}
+	if body.ExpiresAt != nil {
+		if !body.ExpiresAt.Time.After(time.Now()) {
+			return common.BadRequest("屏蔽的结束时间应晚于当前时间")
+		}
+		mute.ExpiresAt = &body.ExpiresAt.Time
+	}
+
+	var count int64
+	if mute.HoleID != 0 {
+		err = DB.Model(&Hole{}).Where("id = ?", mute.HoleID).Count(&count).Error
+	} else {
+		err = DB.Model(&Floor{}).Where("id = ?", mute.FloorID).Count(&count).Error
+	}
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		if mute.HoleID != 0 {
+			return common.NotFound("帖子不存在")
+		}
+		return common.NotFound("楼层不存在")
+	}
+
+	err = AddUserMute(DB, &mute)
+	if err != nil {
+		return err
+	}
+	return c.Status(201).JSON(&mute)
+}
+
+// DeleteMute
+//
+// @Summary Unmute A Hole Or A Floor
+// @Tags Mute
+// @Produce application/json
+// @Router /users/me/mutes/{id} [delete]
+// @Param id path int true "mute id"
+// @Success 204
+// @Failure 404 {object} common.HttpError
+func DeleteMute(c *fiber.Ctx) error {
+	muteID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	result := DB.Where("id = ? AND user_id = ?", muteID, userID).Delete(&UserMute{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return common.NotFound("屏蔽不存在")
+	}
+	return c.Status(204).JSON(nil)
+}
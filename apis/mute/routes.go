@@ -0,0 +1,9 @@
+package mute
+
+import "github.com/gofiber/fiber/v2"
+
+func RegisterRoutes(app fiber.Router) {
+	app.Get("/users/me/mutes", ListMutes)
+	app.Post("/users/me/mutes", AddMute)
+	app.Delete("/users/me/mutes/:id<int>", DeleteMute)
+}
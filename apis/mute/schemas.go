@@ -0,0 +1,14 @@
+package mute
+
+import "github.com/opentreehole/go-common"
+
+type CreateModel struct {
+	// mute replies, mentions and subscriptions in the hole
+	HoleID int `json:"hole_id" validate:"required_without=FloorID,excluded_with=FloorID,min=0"`
+
+	// mute mentions of the floor
+	FloorID int `json:"floor_id" validate:"required_without=HoleID,excluded_with=HoleID,min=0"`
+
+	// muted forever if not set
+	ExpiresAt *common.CustomTime `json:"time_expires" swaggertype:"string"`
+}
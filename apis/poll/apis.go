@@ -0,0 +1,110 @@
+package poll
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	. "treehole_next/models"
+	. "treehole_next/utils"
+)
+
+// GetPoll
+//
+// @Summary Get The Poll Of A Hole
+// @Tags Poll
+// @Produce application/json
+// @Router /holes/{id}/poll [get]
+// @Param id path int true "hole id"
+// @Success 200 {object} models.Poll
+// @Failure 404 {object} MessageModel
+func GetPoll(c *fiber.Ctx) error {
+	holeID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	_, poll, err := loadPoll(c, holeID)
+	if err != nil {
+		return err
+	}
+
+	return Serialize(c, poll)
+}
+
+// VotePoll
+//
+// @Summary Vote In The Poll Of A Hole
+// @Description Each user can vote only once, single choice polls accept exactly one option.
+// @Description Only admins can vote in locked holes.
+// @Tags Poll
+// @Accept application/json
+// @Produce application/json
+// @Router /holes/{id}/poll/votes [post]
+// @Param id path int true "hole id"
+// @Param json body VoteModel true "json"
+// @Success 201 {object} models.Poll
+// @Failure 404 {object} MessageModel
+func VotePoll(c *fiber.Ctx) error {
+	holeID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	var body VoteModel
+	err = common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	hole, poll, err := loadPoll(c, holeID)
+	if err != nil {
+		return err
+	}
+	if user.BanDivision[hole.DivisionID] != nil {
+		return common.Forbidden(user.BanDivisionMessage(hole.DivisionID))
+	}
+	if hole.Locked && !user.IsAdmin {
+		return common.Forbidden("该帖子已被锁定，非管理员禁止投票")
+	}
+
+	err = DB.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		return poll.Vote(tx, user.ID, body.OptionIDs)
+	})
+	if err != nil {
+		return err
+	}
+
+	return Serialize(c.Status(201), poll)
+}
+
+// loadPoll finds a hole visible to the current user and its poll
+func loadPoll(c *fiber.Ctx, holeID int) (*Hole, *Poll, error) {
+	querySet, err := MakeHoleQuerySet(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	var hole Hole
+	err = querySet.Take(&hole, holeID).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var poll Poll
+	err = DB.Preload("Options").Where("hole_id = ?", holeID).Take(&poll).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, common.NotFound("该帖子没有投票")
+		}
+		return nil, nil, err
+	}
+	return &hole, &poll, nil
+}
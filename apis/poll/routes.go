@@ -0,0 +1,8 @@
+package poll
+
+import "github.com/gofiber/fiber/v2"
+
+func RegisterRoutes(app fiber.Router) {
+	app.Get("/holes/:id<int>/poll", GetPoll)
+	app.Post("/holes/:id<int>/poll/votes", VotePoll)
+}
@@ -0,0 +1,43 @@
+package poll
+
+import (
+	"time"
+
+	"treehole_next/models"
+)
+
+type CreateModel struct {
+	// single or multiple, default is single
+	Type    string   `json:"type" validate:"omitempty,oneof=single multiple"`
+	Options []string `json:"options" validate:"min=2,max=20,dive,min=1,max=64"`
+	// votes are not accepted after deadline, omit for no deadline
+	Deadline *time.Time `json:"deadline" validate:"omitempty"`
+	// whether users can see the result before voting
+	ShowResultBeforeVote bool `json:"show_result_before_vote"`
+}
+
+// ToModel converts the request to a poll, nil if no poll is provided
+func (body *CreateModel) ToModel() *models.Poll {
+	if body == nil {
+		return nil
+	}
+	poll := models.Poll{
+		Type:                 body.Type,
+		Deadline:             body.Deadline,
+		ShowResultBeforeVote: body.ShowResultBeforeVote,
+	}
+	if poll.Type == "" {
+		poll.Type = models.PollTypeSingle
+	}
+	for i, content := range body.Options {
+		poll.Options = append(poll.Options, &models.PollOption{
+			Ranking: i,
+			Content: content,
+		})
+	}
+	return &poll
+}
+
+type VoteModel struct {
+	OptionIDs []int `json:"option_ids" validate:"min=1,max=20"`
+}
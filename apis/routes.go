@@ -8,8 +8,11 @@ import (
 	"treehole_next/apis/floor"
 	"treehole_next/apis/hole"
 	"treehole_next/apis/message"
+	"treehole_next/apis/mute"
 	"treehole_next/apis/penalty"
+	"treehole_next/apis/poll"
 	"treehole_next/apis/report"
+	"treehole_next/apis/savedsearch"
 	"treehole_next/apis/subscription"
 	"treehole_next/apis/tag"
 	"treehole_next/apis/user"
@@ -47,6 +50,9 @@ func RegisterRoutes(app *fiber.App) {
 	penalty.RegisterRoutes(group)
 	user.RegisterRoutes(group)
 	message.RegisterRoutes(group)
+	poll.RegisterRoutes(group)
+	savedsearch.RegisterRoutes(group)
+	mute.RegisterRoutes(group)
 }
 
 func MiddlewareGetUser(c *fiber.Ctx) error {
@@ -0,0 +1,99 @@
+package savedsearch
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+
+	"treehole_next/apis/floor"
+	. "treehole_next/models"
+)
+
+// ListSavedSearches
+//
+// @Summary List User's Saved Searches
+// @Tags SavedSearch
+// @Produce application/json
+// @Router /users/me/saved_searches [get]
+// @Success 200 {array} models.SavedSearch
+func ListSavedSearches(c *fiber.Ctx) error {
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	savedSearches := make(SavedSearches, 0)
+	err = DB.Where("user_id = ?", userID).Order("id").Find(&savedSearches).Error
+	if err != nil {
+		return err
+	}
+	return c.JSON(savedSearches)
+}
+
+// AddSavedSearch
+//
+// @Summary Save A Search Query
+// @Description New floors matching the query are notified as saved_search periodically, which can be turned off by config.notify_off.
+// @Description Floors existing when the query is saved are not notified.
+// @Tags SavedSearch
+// @Accept application/json
+// @Produce application/json
+// @Router /users/me/saved_searches [post]
+// @Param json body CreateModel true "json"
+// @Success 201 {object} models.SavedSearch
+// @Failure 400 {object} common.HttpError
+// @Failure 403 {object} common.HttpError "too many saved searches"
+func AddSavedSearch(c *fiber.Ctx) error {
+	var body CreateModel
+	err := common.ValidateBody(c, &body)
+	if err != nil {
+		return err
+	}
+
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	// reject malformed queries early
+	query := floor.SearchQuery{Search: body.Query}
+	_, _, err = query.Request()
+	if err != nil {
+		return err
+	}
+
+	savedSearch, err := AddUserSavedSearch(DB, userID, body.Query)
+	if err != nil {
+		return err
+	}
+	return c.Status(201).JSON(savedSearch)
+}
+
+// DeleteSavedSearch
+//
+// @Summary Delete A Saved Search
+// @Tags SavedSearch
+// @Produce application/json
+// @Router /users/me/saved_searches/{id} [delete]
+// @Param id path int true "saved search id"
+// @Success 204
+// @Failure 404 {object} common.HttpError
+func DeleteSavedSearch(c *fiber.Ctx) error {
+	savedSearchID, err := c.ParamsInt("id")
+	if err != nil {
+		return err
+	}
+
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return err
+	}
+
+	result := DB.Where("id = ? AND user_id = ?", savedSearchID, userID).Delete(&SavedSearch{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return common.NotFound("保存的搜索不存在")
+	}
+	return c.Status(204).JSON(nil)
+}
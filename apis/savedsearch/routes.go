@@ -0,0 +1,9 @@
+package savedsearch
+
+import "github.com/gofiber/fiber/v2"
+
+func RegisterRoutes(app fiber.Router) {
+	app.Get("/users/me/saved_searches", ListSavedSearches)
+	app.Post("/users/me/saved_searches", AddSavedSearch)
+	app.Delete("/users/me/saved_searches/:id<int>", DeleteSavedSearch)
+}
@@ -0,0 +1,6 @@
+package savedsearch
+
+type CreateModel struct {
+	// search syntax of /floors/search, e.g. "二手 显示器" or tag:考研 likes>10
+	Query string `json:"query" validate:"required,max=256"`
+}
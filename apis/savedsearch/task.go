@@ -0,0 +1,182 @@
+package savedsearch
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
+
+	"treehole_next/apis/floor"
+	"treehole_next/config"
+	. "treehole_next/models"
+)
+
+// savedSearchPageSize is the number of floors searched at a time by a run of a saved search
+const savedSearchPageSize = 50
+
+// RunSavedSearchesTask runs saved searches against new floors periodically
+func RunSavedSearchesTask(ctx context.Context) {
+	if config.Config.SavedSearchIntervalMinutes <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Minute * time.Duration(config.Config.SavedSearchIntervalMinutes))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// floors created in the last minute may not be indexed yet, leave them to the next run
+			var maxFloorID int
+			err := DB.Model(&Floor{}).Select("COALESCE(MAX(id), 0)").
+				Where("created_at < ?", time.Now().Add(-time.Minute)).Scan(&maxFloorID).Error
+			if err != nil {
+				log.Err(err).Msg("error finding max floor id")
+				continue
+			}
+			err = RunSavedSearches(ctx, maxFloorID)
+			if err != nil {
+				log.Err(err).Msg("error run saved searches")
+			}
+		case <-ctx.Done():
+			log.Info().Msg("task RunSavedSearchesTask stopped...")
+			return
+		}
+	}
+}
+
+// RunSavedSearches runs each saved search against floors after its last run and up to maxFloorID,
+// at most config.Config.SavedSearchRate searches per second
+func RunSavedSearches(ctx context.Context, maxFloorID int) error {
+	limiter := time.NewTicker(time.Second / time.Duration(max(config.Config.SavedSearchRate, 1)))
+	defer limiter.Stop()
+
+	var ran, notified int
+	lastID := 0
+	for {
+		var savedSearches SavedSearches
+		err := DB.Where("id > ? AND last_floor_id < ?", lastID, maxFloorID).
+			Order("id").Limit(100).Find(&savedSearches).Error
+		if err != nil {
+			return err
+		}
+		if len(savedSearches) == 0 {
+			break
+		}
+
+		for _, savedSearch := range savedSearches {
+			select {
+			case <-limiter.C:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			claimed, err := claimSavedSearch(savedSearch, maxFloorID)
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				// run by another instance
+				continue
+			}
+			matched, err := runSavedSearch(ctx, savedSearch, maxFloorID)
+			if err != nil {
+				log.Err(err).Int("saved_search_id", savedSearch.ID).Msg("error run saved search")
+				continue
+			}
+			ran++
+			if matched {
+				notified++
+			}
+		}
+		lastID = savedSearches[len(savedSearches)-1].ID
+	}
+
+	log.Info().Int("ran", ran).Int("notified", notified).Int("max_floor_id", maxFloorID).Msg("run saved searches")
+	return nil
+}
+
+// claimSavedSearch moves LastFloorID of savedSearch to maxFloorID, so that other instances skip the same floors.
+// It returns false if the search is claimed by another instance.
+func claimSavedSearch(savedSearch *SavedSearch, maxFloorID int) (bool, error) {
+	result := DB.Model(&SavedSearch{}).Where("id = ? AND last_floor_id = ?", savedSearch.ID, savedSearch.LastFloorID).
+		Update("last_floor_id", maxFloorID)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// releaseSavedSearch moves LastFloorID back after a failed run, so that the floors are searched in the next run
+func releaseSavedSearch(savedSearch *SavedSearch, maxFloorID int) {
+	err := DB.Model(&SavedSearch{}).Where("id = ? AND last_floor_id = ?", savedSearch.ID, maxFloorID).
+		Update("last_floor_id", savedSearch.LastFloorID).Error
+	if err != nil {
+		log.Err(err).Int("saved_search_id", savedSearch.ID).Msg("error release saved search")
+	}
+}
+
+// runSavedSearch notifies the owner of new floors matching savedSearch after its LastFloorID and up to maxFloorID,
+// the search should be claimed by claimSavedSearch first
+func runSavedSearch(ctx context.Context, savedSearch *SavedSearch, maxFloorID int) (matched bool, err error) {
+	floors, err := matchSavedSearch(ctx, savedSearch, maxFloorID)
+	if err != nil {
+		// search the floors again in the next run
+		releaseSavedSearch(savedSearch, maxFloorID)
+		return false, err
+	}
+
+	now := time.Now()
+	savedSearch.LastFloorID = maxFloorID
+	savedSearch.LastRunAt = &now
+	savedSearch.LastMatchCount = len(floors)
+	err = DB.Model(savedSearch).Select("LastRunAt", "LastMatchCount").Updates(savedSearch).Error
+	if err != nil {
+		return false, err
+	}
+
+	if len(floors) == 0 {
+		return false, nil
+	}
+	_, err = savedSearch.SendNewMatches(floors, len(floors)).Send()
+	return true, err
+}
+
+// matchSavedSearch finds floors matching savedSearch after its LastFloorID and up to maxFloorID,
+// excluding floors of the owner
+func matchSavedSearch(ctx context.Context, savedSearch *SavedSearch, maxFloorID int) (Floors, error) {
+	query := floor.SearchQuery{Search: savedSearch.Query, Size: savedSearchPageSize}
+	request, found, err := query.Request()
+	if err != nil {
+		return nil, err
+	}
+
+	floors := make(Floors, 0)
+	if !found {
+		return floors, nil
+	}
+	request.AfterFloorID = savedSearch.LastFloorID
+	request.MaxFloorID = maxFloorID
+
+	// hits are ordered by relevance, page through all of them so that no floor in the window is missed
+	var floorIDs []int
+	for {
+		page, err := SearchFloorIDs(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		floorIDs = append(floorIDs, page...)
+		if len(page) < request.Size {
+			break
+		}
+		request.Offset += request.Size
+	}
+	if len(floorIDs) == 0 {
+		return floors, nil
+	}
+	// the owner's own floors are not news
+	err = DB.Where("id IN ? AND id <= ? AND user_id <> ? AND deleted = false", floorIDs, maxFloorID, savedSearch.UserID).
+		Order("id").Find(&floors).Error
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(floors, func(floor *Floor) bool { return floor.Sensitive() }), nil
+}
@@ -51,6 +51,35 @@ func ListTags(c *fiber.Ctx) error {
 	return Serialize(c, &tags)
 }
 
+// AutocompleteTags
+//
+// @Summary Autocomplete Tags
+// @Description Match tags by prefix, pinyin (e.g. kaoyan or ky for 考研), substring or a typo.
+// @Description Better matches come first, then hotter tags. Sensitive and admin-only tags are excluded for non-admins.
+// @Tags Tag
+// @Produce application/json
+// @Param object query AutocompleteModel true "query"
+// @Router /tags/_autocomplete [get]
+// @Success 200 {array} Tag
+func AutocompleteTags(c *fiber.Ctx) error {
+	var query AutocompleteModel
+	err := common.ValidateQuery(c, &query)
+	if err != nil {
+		return err
+	}
+
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	tags, err := SuggestTags(user, query.Search, query.Size)
+	if err != nil {
+		return err
+	}
+	return Serialize(c, &tags)
+}
+
 // GetTag
 //
 // @Summary Get A Tag
@@ -4,6 +4,7 @@ import "github.com/gofiber/fiber/v2"
 
 func RegisterRoutes(app fiber.Router) {
 	app.Get("/tags", ListTags)
+	app.Get("/tags/_autocomplete", AutocompleteTags)
 	app.Get("/tags/:id<int>", GetTag)
 	app.Post("/tags", CreateTag)
 	app.Put("/tags/:id<int>", ModifyTag)
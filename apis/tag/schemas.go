@@ -18,3 +18,9 @@ type DeleteModel struct {
 type SearchModel struct {
 	Search string `json:"s" query:"s" validate:"max=32"` // search tag by name
 }
+
+type AutocompleteModel struct {
+	// prefix, pinyin, initials of pinyin or a name with a typo
+	Search string `json:"s" query:"s" validate:"required,max=32"`
+	Size   int    `json:"size" query:"size" validate:"min=1,max=50" default:"10"`
+}
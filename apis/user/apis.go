@@ -155,9 +155,22 @@ func modifyUser(_ *fiber.Ctx, user *User, body ModifyModel) error {
 		if body.Config.Notify != nil {
 			newUser.Config.Notify = body.Config.Notify
 		}
+		if body.Config.NotifyOff != nil {
+			newUser.Config.NotifyOff = body.Config.NotifyOff
+		}
 		if body.Config.ShowFolded != nil {
 			newUser.Config.ShowFolded = *body.Config.ShowFolded
 		}
+		for messageType, period := range body.Config.Digest {
+			if period == DigestImmediate {
+				delete(newUser.Config.Digest, messageType)
+				continue
+			}
+			if newUser.Config.Digest == nil {
+				newUser.Config.Digest = make(map[MessageType]DigestPeriod)
+			}
+			newUser.Config.Digest[messageType] = period
+		}
 	}
 
 	err = DB.Model(&user).Omit(clause.Associations).Select("Config").UpdateColumns(&newUser).Error
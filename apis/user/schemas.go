@@ -1,5 +1,7 @@
 package user
 
+import . "treehole_next/models"
+
 type ModifyModel struct {
 	Nickname *string          `json:"nickname" validate:"omitempty,min=1"`
 	Config   *UserConfigModel `json:"config"`
@@ -7,5 +9,9 @@ type ModifyModel struct {
 
 type UserConfigModel struct {
 	Notify     []string `json:"notify"`
+	NotifyOff  []string `json:"notify_off"`
 	ShowFolded *string  `json:"show_folded"`
+	// merged into the current config, e.g. {"reply": "daily"}, immediate removes the type.
+	// Only pushes are held for digests, messages are listed as soon as they are sent.
+	Digest map[MessageType]DigestPeriod `json:"digest" validate:"omitempty,dive,keys,oneof=reply favorite mention saved_search,endkeys,oneof=immediate hourly daily weekly"`
 }
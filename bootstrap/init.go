@@ -2,13 +2,18 @@ package bootstrap
 
 import (
 	"context"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/opentreehole/go-common"
 
 	"treehole_next/apis"
+	"treehole_next/apis/floor"
 	"treehole_next/apis/hole"
 	"treehole_next/apis/message"
+	"treehole_next/apis/savedsearch"
 	"treehole_next/config"
 	"treehole_next/models"
 	"treehole_next/utils"
@@ -25,6 +30,7 @@ func Init() (*fiber.App, context.CancelFunc) {
 	sensitive.InitSensitiveLabelMap()
 	models.Init()
 	models.InitDB()
+	models.InitSearch()
 	models.InitAdminList()
 
 	app := fiber.New(fiber.Config{
@@ -39,6 +45,19 @@ func Init() (*fiber.App, context.CancelFunc) {
 	return app, startTasks()
 }
 
+// Reindex rebuilds the search index from the database without starting the server,
+// searching keeps working on the old index until the new one is ready
+func Reindex() error {
+	config.InitConfig()
+	utils.InitCache()
+	models.Init()
+	models.InitDB()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	return models.ReindexFloors(ctx)
+}
+
 func registerMiddlewares(app *fiber.App) {
 	app.Use(recover.New(recover.Config{EnableStackTrace: true}))
 	app.Use(common.MiddlewareGetUserID)
@@ -52,7 +71,16 @@ func startTasks() context.CancelFunc {
 	ctx, cancel := context.WithCancel(context.Background())
 	go hole.UpdateHoleViews(ctx)
 	go hole.PurgeHole(ctx)
+	go hole.UpdateHoleHotScore(ctx)
 	go message.PurgeMessage()
+	go message.DeliverNotificationsTask(ctx)
+	go models.RunMessageHub(ctx)
+	go models.SendDigestsTask(ctx)
+	go floor.AuditSearchIndexTask(ctx)
+	go floor.SaveSearchEvents(ctx)
+	go floor.PurgeSearchEvents(ctx)
+	go models.SaveSearchIndex(ctx)
+	go savedsearch.RunSavedSearchesTask(ctx)
 	// go models.UpdateAdminList(ctx)
 	go sensitive.UpdateSensitiveLabelMap(ctx)
 	return cancel
@@ -35,7 +35,36 @@ var Config struct {
 	AdminOnly          bool     `env:"ADMIN_ONLY" envDefault:"false"`
 	HolePurgeDivisions []int    `env:"HOLE_PURGE_DIVISIONS" envDefault:"2"`
 	HolePurgeDays      int      `env:"HOLE_PURGE_DAYS" envDefault:"30"`
-	OpenSensitiveCheck bool     `env:"OPEN_SENSITIVE_CHECK" envDefault:"true"`
+	// views of a hole by the same user within this window are counted once, 0 means once forever
+	HoleViewWindowSeconds int `env:"HOLE_VIEW_WINDOW_SECONDS" envDefault:"1800"`
+	// hot scores of holes created within these days are refreshed periodically
+	HoleHotWindowDays int `env:"HOLE_HOT_WINDOW_DAYS" envDefault:"7"`
+	// a hole created this many seconds later needs 10 times less engagement to rank the same
+	HoleHotDecaySeconds float64 `env:"HOLE_HOT_DECAY_SECONDS" envDefault:"45000"`
+	OpenSensitiveCheck  bool    `env:"OPEN_SENSITIVE_CHECK" envDefault:"true"`
+	// floors in the search index are compared with the database every interval, 0 means disabled
+	IndexAuditIntervalMinutes int `env:"INDEX_AUDIT_INTERVAL_MINUTES" envDefault:"60"`
+	// floors checked in one run, the next run continues from the last floor and wraps around
+	IndexAuditSize int `env:"INDEX_AUDIT_SIZE" envDefault:"20000"`
+	// elasticsearch, local or database, defaults to elasticsearch if ELASTICSEARCH_URL is set,
+	// otherwise local in dev and test mode and database in other modes
+	SearchBackend string `env:"SEARCH_BACKEND"`
+	// file to persist the local search index, empty means in memory only
+	SearchIndexPath string `env:"SEARCH_INDEX_PATH"`
+	// number of search queries a user can save
+	SavedSearchLimit int `env:"SAVED_SEARCH_LIMIT" envDefault:"10"`
+	// saved searches are run against new floors every interval, 0 means disabled
+	SavedSearchIntervalMinutes int `env:"SAVED_SEARCH_INTERVAL_MINUTES" envDefault:"30"`
+	// saved searches run per second at most, to protect the search backend
+	SavedSearchRate int `env:"SAVED_SEARCH_RATE" envDefault:"5"`
+	// new holes are checked against holes of the same user created in the window for duplicates
+	DuplicateHoleWindowHours int `env:"DUPLICATE_HOLE_WINDOW_HOURS" envDefault:"24"`
+	// search events older than the days are purged
+	SearchEventPurgeDays int `env:"SEARCH_EVENT_PURGE_DAYS" envDefault:"90"`
+	// failed pushes to the notification service are retried after 1, 2, 4... times the interval
+	NotificationRetrySeconds int `env:"NOTIFICATION_RETRY_SECONDS" envDefault:"30"`
+	// pushes failed so many times are dead-lettered until replayed by an admin
+	NotificationMaxAttempts int `env:"NOTIFICATION_MAX_ATTEMPTS" envDefault:"8"`
 
 	YiDunBusinessIdText          string   `env:"YI_DUN_BUSINESS_ID_TEXT" envDefault:""`
 	YiDunBusinessIdImage         string   `env:"YI_DUN_BUSINESS_ID_IMAGE" envDefault:""`
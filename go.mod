@@ -12,6 +12,7 @@ require (
 	github.com/gofiber/fiber/v2 v2.52.13
 	github.com/google/uuid v1.6.0
 	github.com/hetiansu5/urlquery v1.2.7
+	github.com/mozillazg/go-pinyin v0.21.0
 	github.com/opentreehole/go-common v0.1.7
 	github.com/patrickmn/go-cache v2.1.0+incompatible
 	github.com/redis/go-redis/v9 v9.17.3
@@ -8,6 +8,7 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"treehole_next/bootstrap"
+	"treehole_next/models"
 )
 
 //	@title			Open Tree Hole
@@ -24,6 +25,15 @@ import (
 //	@BasePath	/api
 
 func main() {
+	// usage: treehole_next reindex
+	if len(os.Args) > 1 && os.Args[1] == "reindex" {
+		err := bootstrap.Reindex()
+		if err != nil {
+			log.Fatal().Err(err).Msg("reindex failed")
+		}
+		return
+	}
+
 	app, cancel := bootstrap.Init()
 	go func() {
 		err := app.Listen("0.0.0.0:8000")
@@ -38,6 +48,9 @@ func main() {
 	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
 	<-interrupt
 
+	// end message streams, otherwise shutdown waits for them
+	models.StopMessageHub()
+
 	// close app
 	err := app.Shutdown()
 	if err != nil {
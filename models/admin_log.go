@@ -24,6 +24,10 @@ const (
 	AdminLogTypeMessage         AdminLogType = "send_message"
 	AdminLogTypeDeleteReport    AdminLogType = "delete_report"
 	AdminLogTypeChangeSensitive AdminLogType = "change_sensitive"
+	AdminLogTypeMergeHole       AdminLogType = "merge_hole"
+	AdminLogTypeSplitHole       AdminLogType = "split_hole"
+	AdminLogTypeFoldFloor       AdminLogType = "fold_floor"
+	AdminLogTypeDeleteFloor     AdminLogType = "delete_floor"
 )
 
 // CreateAdminLog
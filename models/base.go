@@ -4,8 +4,8 @@ package models
 type Map = map[string]interface{}
 
 type Models interface {
-	Division | Hole | Floor | Tag | User | Report | Message |
-		Divisions | Holes | Floors | Tags | Users | Reports | Messages
+	Division | Hole | Floor | Tag | User | Report | Message | Poll | SavedSearch | NotificationOutbox | UserMute |
+		Divisions | Holes | Floors | Tags | Users | Reports | Messages | SavedSearches | NotificationOutboxes | UserMutes
 }
 
 type MessageModel struct {
@@ -0,0 +1,259 @@
+package models
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"treehole_next/utils"
+)
+
+// DigestPeriod is how often notifications of a type are delivered to a user
+type DigestPeriod string
+
+const (
+	DigestImmediate DigestPeriod = "immediate"
+	DigestHourly    DigestPeriod = "hourly"
+	DigestDaily     DigestPeriod = "daily"
+	DigestWeekly    DigestPeriod = "weekly"
+)
+
+// DigestibleMessageTypes can be delivered in digests, others are always immediate
+var DigestibleMessageTypes = []MessageType{MessageTypeReply, MessageTypeFavorite, MessageTypeMention, MessageTypeSavedSearch}
+
+// digestHour is the hour of the day when daily and weekly digests are sent
+const digestHour = 8
+
+// digestLease is how long claimed items are hidden from other replicas, they are sent again after it if sending fails
+const digestLease = 10 * time.Minute
+
+// digestDescriptionSize is the max number of holes listed in the description of a digest
+const digestDescriptionSize = 5
+
+// DigestItem is a notification queued for a digest, deleted once the digest is sent
+type DigestItem struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"time_created"`
+
+	UserID int          `json:"-" gorm:"not null;index:idx_digest_user_due,priority:1"`
+	Type   MessageType  `json:"type" gorm:"size:16;not null"`
+	Period DigestPeriod `json:"period" gorm:"size:16;not null"`
+
+	// 0 if the notification is not related to a hole
+	HoleID      int    `json:"hole_id" gorm:"not null;default:0"`
+	FloorID     *int   `json:"floor_id"`
+	Title       string `json:"title" gorm:"size:1024;not null"`
+	Description string `json:"description" gorm:"size:256;not null"`
+
+	// the digest containing the item is sent at the time, moved forward by digestLease when claimed
+	DueAt time.Time `json:"time_due" gorm:"not null;index;index:idx_digest_user_due,priority:2"`
+
+	// token of the latest SendDueDigests claiming the item
+	ClaimedBy string `json:"-" gorm:"size:36;not null;default:''"`
+}
+
+// DigestGroup summarizes items of a digest in the same hole, it is the Data of a digest Message
+type DigestGroup struct {
+	HoleID int                 `json:"hole_id"`
+	Count  int                 `json:"count"`
+	Types  map[MessageType]int `json:"types"`
+	// the latest item
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	FloorID     *int   `json:"floor_id"`
+}
+
+// DigestPeriodOf returns the digest period of the message type configured by the user
+func (config *UserConfig) DigestPeriodOf(messageType MessageType) DigestPeriod {
+	if !slices.Contains(DigestibleMessageTypes, messageType) {
+		return DigestImmediate
+	}
+	period, ok := config.Digest[messageType]
+	if !ok {
+		return DigestImmediate
+	}
+	return period
+}
+
+// NextDigestTime is when the digest of the period containing now is sent:
+// the next hour for hourly, digestHour of the next day for daily, and digestHour of the next Monday for weekly
+func NextDigestTime(period DigestPeriod, now time.Time) time.Time {
+	switch period {
+	case DigestHourly:
+		return now.Truncate(time.Hour).Add(time.Hour)
+	case DigestDaily, DigestWeekly:
+		due := time.Date(now.Year(), now.Month(), now.Day(), digestHour, 0, 0, 0, now.Location())
+		if !due.After(now) {
+			due = due.AddDate(0, 0, 1)
+		}
+		if period == DigestWeekly {
+			due = due.AddDate(0, 0, (int(time.Monday)-int(due.Weekday())+7)%7)
+		}
+		return due
+	default:
+		return now
+	}
+}
+
+// queueDigest saves the notification for digests of the users
+func (message *Notification) queueDigest(tx *gorm.DB, periods map[int]DigestPeriod) error {
+	holeID := 0
+	if message.RelatedHoleID != nil {
+		holeID = *message.RelatedHoleID
+	} else if message.RelatedFloorID != nil {
+		err := tx.Model(&Floor{}).Where("id = ?", *message.RelatedFloorID).Select("hole_id").Scan(&holeID).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	items := make([]DigestItem, 0, len(periods))
+	for userID, period := range periods {
+		items = append(items, DigestItem{
+			UserID:      userID,
+			Type:        message.Type,
+			Period:      period,
+			HoleID:      holeID,
+			FloorID:     message.RelatedFloorID,
+			Title:       message.Title,
+			Description: utils.StripContent(cleanNotificationDescription(message.Description), 256),
+			DueAt:       NextDigestTime(period, now),
+		})
+	}
+	return tx.Create(&items).Error
+}
+
+// SendDigestsTask sends due digests periodically
+func SendDigestsTask(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := SendDueDigests(time.Now())
+			if err != nil {
+				log.Err(err).Msg("error sending digests")
+			}
+		case <-ctx.Done():
+			log.Info().Msg("task SendDigestsTask stopped...")
+			return
+		}
+	}
+}
+
+// SendDueDigests sends one digest message to each user with items due before now, then deletes the items.
+// Items are claimed by a token and moving DueAt forward, so that multiple instances do not send the same items.
+func SendDueDigests(now time.Time) error {
+	var userIDs []int
+	err := DB.Clauses(dbresolver.Write).Model(&DigestItem{}).Where("due_at <= ?", now).Distinct().Pluck("user_id", &userIDs).Error
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		token := uuid.NewString()
+		result := DB.Model(&DigestItem{}).Where("user_id = ? AND due_at <= ?", userID, now).
+			Updates(map[string]any{"claimed_by": token, "due_at": now.Add(digestLease)})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// claimed by another instance
+			continue
+		}
+
+		var items []DigestItem
+		err = DB.Clauses(dbresolver.Write).Where("claimed_by = ?", token).Order("id").Find(&items).Error
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			continue
+		}
+
+		_, err = newDigest(userID, items).Send()
+		if err != nil {
+			log.Err(err).Int("user_id", userID).Msg("error sending digest")
+			continue
+		}
+
+		ids := make([]int, len(items))
+		for i, item := range items {
+			ids[i] = item.ID
+		}
+		err = DB.Delete(&DigestItem{}, ids).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(userIDs) > 0 {
+		log.Info().Int("users", len(userIDs)).Msg("send digests")
+	}
+	return nil
+}
+
+// newDigest summarizes items by hole, the hole with the latest item first
+func newDigest(userID int, items []DigestItem) Notification {
+	var groups []*DigestGroup
+	for _, item := range items {
+		index := slices.IndexFunc(groups, func(group *DigestGroup) bool { return group.HoleID == item.HoleID })
+		if index < 0 {
+			groups = append(groups, &DigestGroup{HoleID: item.HoleID, Types: make(map[MessageType]int)})
+			index = len(groups) - 1
+		}
+		group := groups[index]
+		group.Count++
+		group.Types[item.Type]++
+		group.Title = item.Title
+		group.Description = item.Description
+		group.FloorID = item.FloorID
+	}
+	slices.SortStableFunc(groups, func(a, b *DigestGroup) int {
+		return cmp.Compare(b.latestItemIndex(items), a.latestItemIndex(items))
+	})
+
+	lines := make([]string, 0, digestDescriptionSize)
+	for _, group := range groups[:min(len(groups), digestDescriptionSize)] {
+		if group.HoleID == 0 {
+			lines = append(lines, fmt.Sprintf("%d 条通知：%s", group.Count, group.Description))
+		} else {
+			lines = append(lines, fmt.Sprintf("#%d %d 条通知：%s", group.HoleID, group.Count, group.Description))
+		}
+	}
+
+	url := "/api/messages"
+	var relatedHoleID *int
+	if len(groups) == 1 && groups[0].HoleID != 0 {
+		url = fmt.Sprintf("/api/holes/%d", groups[0].HoleID)
+		relatedHoleID = &groups[0].HoleID
+	}
+
+	periodNames := map[DigestPeriod]string{DigestHourly: "每小时", DigestDaily: "每日", DigestWeekly: "每周"}
+	return Notification{
+		Data:          groups,
+		Recipients:    []int{userID},
+		Title:         fmt.Sprintf("%s摘要：您有 %d 条新通知", periodNames[items[len(items)-1].Period], len(items)),
+		Description:   strings.Join(lines, "\n"),
+		Type:          MessageTypeDigest,
+		URL:           url,
+		RelatedHoleID: relatedHoleID,
+	}
+}
+
+func (group *DigestGroup) latestItemIndex(items []DigestItem) int {
+	for i := len(items) - 1; i >= 0; i-- {
+		if items[i].HoleID == group.HoleID {
+			return i
+		}
+	}
+	return -1
+}
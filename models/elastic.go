@@ -5,8 +5,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -16,6 +18,8 @@ import (
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
 	"github.com/opentreehole/go-common"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
 
 	"treehole_next/config"
 	"treehole_next/utils"
@@ -28,6 +32,8 @@ import (
 
 var ES *elasticsearch.TypedClient
 
+// IndexName is the alias of the floor index that searches and writes go through,
+// it points to a versioned index created by ReindexFloors. Older deployments have a concrete index of this name.
 const IndexName = "floors"
 
 func Init() {
@@ -58,12 +64,255 @@ func Init() {
 	log.Info().Msgf("elasticsearch Server: %s\n", info.Version.Int)
 	log.Info().Msgf("elasticsearch Server Minimum Index Compatibility Version: %s\n", info.Version.MinimumIndexCompatibilityVersion)
 	log.Info().Msgf("elasticsearch Server Minimum Wire Compatibility Version: %s\n", info.Version.MinimumWireCompatibilityVersion)
+
+	// new fields are added to the existing index, documents are filled by BackfillFloorIndex
+	_, err = ES.Indices.PutMapping(IndexName).Properties(floorMappingProperties).Do(context.Background())
+	if err != nil {
+		log.Warn().Err(err).Msg("error putting floor mapping")
+	}
 }
 
+// FloorModel is the document of a floor in Elasticsearch, built by NewFloorModels
 type FloorModel struct {
-	ID        int       `json:"id"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Content   string    `json:"content"`
+	ID         int       `json:"id"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Content    string    `json:"content"`
+	HoleID     int       `json:"hole_id"`
+	DivisionID int       `json:"division_id"`
+	TagIDs     []int     `json:"tag_ids"`
+	Like       int       `json:"like"`
+	// 0 for the first floor of the hole
+	Ranking int `json:"ranking"`
+	// whether the hole is hidden or deleted
+	Hidden    bool `json:"hidden"`
+	Sensitive bool `json:"sensitive"`
+}
+
+// floorMappingProperties are fields added after content, put into the mapping of the existing index at Init
+var floorMappingProperties = map[string]types.Property{
+	"hole_id":     types.NewIntegerNumberProperty(),
+	"division_id": types.NewIntegerNumberProperty(),
+	"tag_ids":     types.NewIntegerNumberProperty(),
+	"like":        types.NewIntegerNumberProperty(),
+	"ranking":     types.NewIntegerNumberProperty(),
+	"hidden":      types.NewBooleanProperty(),
+	"sensitive":   types.NewBooleanProperty(),
+}
+
+// SearchFilter limits the scope of Search, zero values are ignored
+type SearchFilter struct {
+	HoleID     int
+	DivisionID int
+	// the hole should have all of the tags
+	TagIDs []int
+}
+
+// NewFloorModels builds documents of floors with the division, tags and hidden state of their holes,
+// floors of deleted or missing holes are hidden
+func NewFloorModels(tx *gorm.DB, floors Floors) ([]FloorModel, error) {
+	if len(floors) == 0 {
+		return nil, nil
+	}
+	holeIDs := make([]int, 0, len(floors))
+	for _, floor := range floors {
+		if !slices.Contains(holeIDs, floor.HoleID) {
+			holeIDs = append(holeIDs, floor.HoleID)
+		}
+	}
+
+	var holes Holes
+	err := tx.Unscoped().Select("id", "division_id", "hidden", "deleted_at").Where("id IN ?", holeIDs).Find(&holes).Error
+	if err != nil {
+		return nil, err
+	}
+	var holeTags []HoleTag
+	err = tx.Where("hole_id IN ?", holeIDs).Find(&holeTags).Error
+	if err != nil {
+		return nil, err
+	}
+
+	holeMap := make(map[int]*Hole, len(holes))
+	for _, hole := range holes {
+		holeMap[hole.ID] = hole
+	}
+	tagIDs := make(map[int][]int, len(holes))
+	for _, holeTag := range holeTags {
+		tagIDs[holeTag.HoleID] = append(tagIDs[holeTag.HoleID], holeTag.TagID)
+	}
+
+	floorModels := make([]FloorModel, 0, len(floors))
+	for _, floor := range floors {
+		floorModel := FloorModel{
+			ID:        floor.ID,
+			UpdatedAt: floor.UpdatedAt,
+			Content:   floor.Content,
+			HoleID:    floor.HoleID,
+			TagIDs:    tagIDs[floor.HoleID],
+			Like:      floor.Like,
+			Ranking:   floor.Ranking,
+			Sensitive: floor.Sensitive(),
+		}
+		if floorModel.UpdatedAt.IsZero() {
+			floorModel.UpdatedAt = time.Now()
+		}
+		if floorModel.TagIDs == nil {
+			floorModel.TagIDs = []int{}
+		}
+		if hole, ok := holeMap[floor.HoleID]; ok {
+			floorModel.DivisionID = hole.DivisionID
+			floorModel.Hidden = hole.Hidden || hole.DeletedAt.Valid
+		} else {
+			floorModel.Hidden = true
+		}
+		floorModels = append(floorModels, floorModel)
+	}
+	return floorModels, nil
+}
+
+// IndexFloors builds documents of floors synchronously and inserts them by BulkInsert
+func IndexFloors(tx *gorm.DB, floors Floors) {
+	if Searcher == nil {
+		return
+	}
+	floorModels, err := NewFloorModels(tx, floors)
+	if err != nil {
+		log.Err(err).Ints("floor_ids", utils.Models2IDSlice(floors)).Msg("error building floor models")
+		return
+	}
+	BulkInsert(floorModels)
+}
+
+// floorSearchable tells whether the floor should be in the index, floorModel is built by NewFloorModels
+func floorSearchable(floor *Floor, floorModel FloorModel) bool {
+	return !floor.Deleted && !floorModel.Sensitive && !floorModel.Hidden
+}
+
+// searchableFloors filters floors that should be in the index, the hole should be visible as well
+func searchableFloors(tx *gorm.DB) *gorm.DB {
+	return tx.Where("deleted = ? AND (is_actual_sensitive = ? OR (is_actual_sensitive IS NULL AND is_sensitive = ?))", false, false, false)
+}
+
+// IndexHoleFloors reindexes searchable floors of a visible hole, used when the hole is unhidden or its division or tags change
+func IndexHoleFloors(tx *gorm.DB, holeID int) {
+	if Searcher == nil {
+		return
+	}
+	var floors Floors
+	err := searchableFloors(tx).Where("hole_id = ?", holeID).Find(&floors).Error
+	if err != nil {
+		log.Err(err).Int("hole_id", holeID).Msg("error loading floors to index")
+		return
+	}
+	IndexFloors(tx, floors)
+}
+
+const floorBackfillBatchSize = 1000
+
+// BackfillFloorIndex reindexes all searchable floors in visible holes in batches,
+// used to fill the fields added to FloorModel into the existing index.
+func BackfillFloorIndex(ctx context.Context) error {
+	if ES == nil {
+		return common.BadRequest("Elasticsearch 未启用")
+	}
+	total := 0
+	err := eachFloorModelBatch(ctx, func(floorModels []FloorModel) error {
+		err := elasticBackend{}.BulkIndex(floorModels)
+		if err != nil {
+			return err
+		}
+		total += len(floorModels)
+		log.Info().Int("last_id", floorModels[len(floorModels)-1].ID).Int("total", total).Msg("backfill floor index")
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Info().Int("total", total).Msg("backfill floor index done")
+	return nil
+}
+
+// visibleSearchableFloors filters searchable floors in visible holes, which are all the documents of the index
+func visibleSearchableFloors(tx *gorm.DB) *gorm.DB {
+	return searchableFloors(tx).
+		Where("hole_id IN (?)", DB.Model(&Hole{}).Select("id").Where("hidden = ?", false))
+}
+
+// eachFloorModelBatch loads documents of all visible searchable floors in batches ordered by id and calls fn with each batch
+func eachFloorModelBatch(ctx context.Context, fn func(floorModels []FloorModel) error) error {
+	lastID := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		var floors Floors
+		err := visibleSearchableFloors(DB).
+			Where("id > ?", lastID).
+			Order("id").Limit(floorBackfillBatchSize).
+			Find(&floors).Error
+		if err != nil {
+			return err
+		}
+		if len(floors) == 0 {
+			return nil
+		}
+
+		floorModels, err := NewFloorModels(DB, floors)
+		if err != nil {
+			return err
+		}
+		err = fn(floorModels)
+		if err != nil {
+			return err
+		}
+		lastID = floors[len(floors)-1].ID
+	}
+}
+
+// eachChangedFloorModelBatch loads floors updated since the time, and floors of holes updated or deleted since the time,
+// in batches ordered by id, and calls fn with documents of the searchable ones and ids of the others
+func eachChangedFloorModelBatch(ctx context.Context, since time.Time, fn func(toIndex []FloorModel, toDelete []int) error) error {
+	holeIDs := DB.Unscoped().Model(&Hole{}).Select("id").Where("updated_at >= ? OR deleted_at >= ?", since, since)
+	lastID := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		var floors Floors
+		err := DB.Where("id > ? AND (updated_at >= ? OR hole_id IN (?))", lastID, since, holeIDs).
+			Order("id").Limit(floorBackfillBatchSize).
+			Find(&floors).Error
+		if err != nil {
+			return err
+		}
+		if len(floors) == 0 {
+			return nil
+		}
+
+		floorModels, err := NewFloorModels(DB, floors)
+		if err != nil {
+			return err
+		}
+		var toIndex []FloorModel
+		var toDelete []int
+		for i, floorModel := range floorModels {
+			if floorSearchable(floors[i], floorModel) {
+				toIndex = append(toIndex, floorModel)
+			} else {
+				toDelete = append(toDelete, floorModel.ID)
+			}
+		}
+		err = fn(toIndex, toDelete)
+		if err != nil {
+			return err
+		}
+		lastID = floors[len(floors)-1].ID
+	}
 }
 
 const HighlightBegin = "<em>"
@@ -93,138 +342,27 @@ func (floors HighlightedFloors) Preprocess(_ *fiber.Ctx) error {
 	return nil
 }
 
-// Search searches floors by keyword.
-//
-// Parameters:
-// - c: Fiber context
-// - keyword: The keyword to search for
-// - size: The number of results to return
-// - offset: The starting point of the results
-// - accurate: Whether to use accurate search
-// - startTime and endTime: Filter floors by time (If not specified, set to nil)
+// Search searches floors by the request with Searcher, or by SearchOld if no search backend is in use.
 //
 // Returns:
 // - HighlightedFloors: A list of floors matching the search criteria, each floor with an extra HighlightedContent field
 // - error: An error if the search fails
-func Search(c *fiber.Ctx, keyword string, size, offset int, accurate bool, startTime *int64, endTime *int64) (HighlightedFloors, error) {
-	if ES == nil {
-		return SearchOld(c, keyword, size, offset, startTime, endTime)
-	}
-
-	// our query design:
-	// {
-	// 	"query": {
-	// 		"bool": {
-	// 			"must": {
-	// 				"dis_max": {
-	// 					"queries": [{
-	// 						 "multi_match": {}
-	// 					 },
-	// 					 {
-	// 						 "multi_match": {}
-	// 					 }]
-	// 				}
-	// 			},
-	// 			"filter": {
-	// 				//Term filter
-	// 			}
-	// 		}
-	// 	}
-	// }
-
-	var filterQueries []types.Query
-	var disMaxQueries []types.Query
-
-	if accurate {
-		disMaxQueries = []types.Query{
-			{MatchPhrase: map[string]types.MatchPhraseQuery{"content": {Query: keyword}}},
-			{MatchPhrase: map[string]types.MatchPhraseQuery{"content.ik_smart": {Query: keyword}}},
-		}
-	} else {
-		disMaxQueries = []types.Query{
-			{Match: map[string]types.MatchQuery{"content": {Query: keyword}}},
-			{Match: map[string]types.MatchQuery{"content.ik_smart": {Query: keyword}}},
-		}
-	}
-
-	if startTime != nil || endTime != nil {
-		dateRangeQuery := types.DateRangeQuery{}
-		if startTime != nil {
-			start := time.Unix(*startTime, 0).UTC().Format(time.RFC3339)
-			dateRangeQuery.Gte = &start
-		}
-		if endTime != nil {
-			end := time.Unix(*endTime, 0).UTC().Format(time.RFC3339)
-			dateRangeQuery.Lte = &end
-		}
-		timeRangeQuery := types.Query{
-			Range: map[string]types.RangeQuery{
-				"updated_at": dateRangeQuery,
-			},
-		}
-		filterQueries = append(filterQueries, timeRangeQuery)
-	}
-
-	query := types.Query{
-		Bool: &types.BoolQuery{
-			Must: []types.Query{
-				{
-					DisMax: &types.DisMaxQuery{
-						Queries: disMaxQueries,
-					},
-				},
-			},
-			Filter: filterQueries,
-		},
+func Search(c *fiber.Ctx, request SearchRequest) (HighlightedFloors, error) {
+	if Searcher == nil {
+		return SearchOld(c, request)
 	}
 
-	highlight := &types.Highlight{
-		Fields: map[string]types.HighlightField{
-			"content": {
-				NumberOfFragments: &[]int{0}[0],
-			},
-			"content.ik_smart": {
-				NumberOfFragments: &[]int{0}[0],
-			},
-		},
-		PreTags:  []string{HighlightBegin},
-		PostTags: []string{HighlightEnd},
-	}
-
-	res, err := ES.Search().
-		Index(IndexName).From(offset).
-		Size(size).Query(&query).
-		Highlight(highlight).
-		Sort(
-			types.SortOptions{
-				SortOptions: map[string]types.FieldSort{
-					"_score": {Order: &sortorder.Desc},
-				},
-			},
-			types.SortOptions{
-				SortOptions: map[string]types.FieldSort{
-					"updated_at": {Order: &sortorder.Desc},
-				},
-			}).
-		Do(context.Background())
-
+	hits, err := Searcher.Search(c.Context(), request)
 	if err != nil {
-		var errorMsg = fmt.Sprintf("error searching floors: %e", err)
-		log.Err(err).Msg("error searching floors")
-
-		var esError *types.ElasticsearchError
-		if errors.As(err, &esError) {
-			data, _ := json.Marshal(esError)
-			log.Err(err).
-				Bytes("error_detail", data).
-				Msg("error searching floors")
-			return nil, &common.HttpError{Code: esError.Status, Message: errorMsg}
-		}
-		return nil, common.InternalServerError(errorMsg)
+		return nil, err
 	}
+	return loadHighlightedFloors(c, hits)
+}
 
+// loadHighlightedFloors loads floors of hits in the same order, and preprocesses them
+func loadHighlightedFloors(c *fiber.Ctx, hits []SearchHit) (HighlightedFloors, error) {
 	// get floors
-	floorSize := len(res.Hits.Hits)
+	floorSize := len(hits)
 	if floorSize == 0 {
 		return HighlightedFloors{}, nil
 	}
@@ -232,24 +370,10 @@ func Search(c *fiber.Ctx, keyword string, size, offset int, accurate bool, start
 
 	floorIDs := make([]int, floorSize)
 	highlightedContents := make(map[int]string)
-	for i, hit := range res.Hits.Hits {
-		id, err := strconv.Atoi(*hit.Id_)
-		if err != nil {
-			var errorMsg = "error parsing floor_id from ElasticSearch ID"
-			log.Err(err).Msg(errorMsg)
-			return nil, common.InternalServerError(errorMsg)
-		}
-		floorIDs[i] = id
-		if hit.Highlight != nil {
-			var fragments []string
-			if f, ok := hit.Highlight["content"]; ok && len(f) > 0 {
-				fragments = f
-			} else if f, ok := hit.Highlight["content.ik_smart"]; ok && len(f) > 0 {
-				fragments = f
-			}
-			if len(fragments) > 0 {
-				highlightedContents[id] = fragments[0]
-			}
+	for i, hit := range hits {
+		floorIDs[i] = hit.FloorID
+		if hit.HighlightedContent != "" {
+			highlightedContents[hit.FloorID] = hit.HighlightedContent
 		}
 	}
 	log.Info().Ints("floor_ids", floorIDs).Msg("search response")
@@ -297,34 +421,24 @@ func Search(c *fiber.Ctx, keyword string, size, offset int, accurate bool, start
 }
 
 // SearchOld searches floors by keyword by Database.
-// It is used when ElasticSearch is not available. (Not recommended)
-func SearchOld(c *fiber.Ctx, keyword string, size, offset int, startTimeUnix *int64, endTimeUnix *int64) (HighlightedFloors, error) {
+// It is used when no search backend is in use. (Not recommended)
+// Each word of the keyword should appear in the content, phrases and excludes are matched as substrings.
+func SearchOld(c *fiber.Ctx, request SearchRequest) (HighlightedFloors, error) {
 	floors := Floors{}
-	var startTime, endTime *time.Time
-	if startTimeUnix != nil {
-		start := time.Unix(*startTimeUnix, 0)
-		startTime = &start
-	}
-	if endTimeUnix != nil {
-		end := time.Unix(*endTimeUnix, 0)
-		endTime = &end
-	}
-	querySet, err := floors.MakeQuerySetWithTimeRange(nil, &offset, &size, startTime, endTime, c)
+	querySet, err := floors.MakeQuerySet(nil, &request.Offset, &request.Size, c)
 	if err != nil {
-		log.Err(err).Msg("error building floor query set with time range")
+		log.Err(err).Msg("error building floor query set")
 		return nil, err
 	}
 
-	err = querySet.
-		Where("content like ?", "%"+keyword+"%").
-		Where("hole_id in (?)", DB.Table("hole").Select("id").Where("hidden = false")).
-		Order("id desc").Find(&floors).Error
+	querySet, keywords := searchOldScope(querySet, request)
+	err = querySet.Order("id desc").Find(&floors).Error
 	if err != nil {
-		log.Err(err).Msgf("error finding floors by keyword '%s'", keyword)
+		log.Err(err).Msgf("error finding floors by keywords %v", keywords)
 		return nil, err
 	}
 
-	result, err := PreprocessAndHighlight(c, floors, keyword)
+	result, err := PreprocessAndHighlight(c, floors, keywords...)
 	if err != nil {
 		return nil, err
 	}
@@ -332,7 +446,74 @@ func SearchOld(c *fiber.Ctx, keyword string, size, offset int, startTimeUnix *in
 	return result, nil
 }
 
-func PreprocessAndHighlight(c *fiber.Ctx, floors Floors, keyword string) (HighlightedFloors, error) {
+// SearchFloorIDs finds IDs of floors matching request without loading them, newest first if searching the database
+func SearchFloorIDs(ctx context.Context, request SearchRequest) ([]int, error) {
+	if Searcher != nil {
+		hits, err := Searcher.Search(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		floorIDs := make([]int, len(hits))
+		for i, hit := range hits {
+			floorIDs[i] = hit.FloorID
+		}
+		return floorIDs, nil
+	}
+
+	var floorIDs []int
+	querySet, _ := searchOldScope(DB.Model(&Floor{}), request)
+	err := querySet.Order("id desc").Offset(request.Offset).Limit(request.Size).Pluck("id", &floorIDs).Error
+	return floorIDs, err
+}
+
+// searchOldScope applies the conditions of request to a query of floors, returning the keywords to highlight
+func searchOldScope(querySet *gorm.DB, request SearchRequest) (*gorm.DB, []string) {
+	if request.StartTime != nil {
+		querySet = querySet.Where("created_at >= ?", time.Unix(*request.StartTime, 0))
+	}
+	if request.EndTime != nil {
+		querySet = querySet.Where("created_at <= ?", time.Unix(*request.EndTime, 0))
+	}
+
+	filter := request.Filter
+	if filter.HoleID != 0 {
+		querySet = querySet.Where("hole_id = ?", filter.HoleID)
+	}
+	if filter.DivisionID != 0 {
+		querySet = querySet.Where("hole_id in (?)", DB.Table("hole").Select("id").Where("division_id = ?", filter.DivisionID))
+	}
+	for _, tagID := range filter.TagIDs {
+		querySet = querySet.Where("hole_id in (?)", DB.Table("hole_tags").Select("hole_id").Where("tag_id = ?", tagID))
+	}
+	if request.MinLikes != nil {
+		querySet = querySet.Where("`like` >= ?", *request.MinLikes)
+	}
+	if request.MaxLikes != nil {
+		querySet = querySet.Where("`like` <= ?", *request.MaxLikes)
+	}
+	if request.AfterFloorID > 0 {
+		querySet = querySet.Where("id > ?", request.AfterFloorID)
+	}
+	if request.MaxFloorID > 0 {
+		querySet = querySet.Where("id <= ?", request.MaxFloorID)
+	}
+
+	keywords := strings.Fields(request.Keyword)
+	if request.Accurate && request.Keyword != "" {
+		keywords = []string{request.Keyword}
+	}
+	keywords = append(keywords, request.Phrases...)
+	for _, keyword := range keywords {
+		querySet = querySet.Where("content like ?", "%"+keyword+"%")
+	}
+	for _, exclude := range request.Excludes {
+		querySet = querySet.Where("content not like ?", "%"+exclude+"%")
+	}
+
+	return querySet.Where("hole_id in (?)", DB.Table("hole").Select("id").Where("hidden = false")), keywords
+}
+
+func PreprocessAndHighlight(c *fiber.Ctx, floors Floors, keywords ...string) (HighlightedFloors, error) {
 	// preprocess here to reuse Floors#Preprocess
 	err := floors.Preprocess(c)
 	if err != nil {
@@ -343,18 +524,9 @@ func PreprocessAndHighlight(c *fiber.Ctx, floors Floors, keyword string) (Highli
 	// at this point potentially sensitive content is wiped out by Preprocess, so we can highlight safely
 	highlighted := make(HighlightedFloors, len(floors))
 
-	// skip highlighting if keyword is empty
-	if keyword == "" {
-		CopyToHighlightedFloors(floors, highlighted)
-		return highlighted, nil
-	}
-
-	// (?i) for case insensitivity, QuoteMeta to avoid regex injection
-	regex := "(?i)" + regexp.QuoteMeta(keyword)
-	pattern, err := regexp.Compile(regex)
-	if err != nil {
-		log.Err(err).Msgf("error compiling highlight regex: '%s'", regex)
-		// fall back to unhighlighted result
+	// skip highlighting if keywords are empty
+	pattern := highlightPattern(keywords)
+	if pattern == nil {
 		CopyToHighlightedFloors(floors, highlighted)
 		return highlighted, nil
 	}
@@ -369,6 +541,30 @@ func PreprocessAndHighlight(c *fiber.Ctx, floors Floors, keyword string) (Highli
 	return highlighted, nil
 }
 
+// highlightPattern matches any of the keywords case-insensitively, nil if keywords are empty
+func highlightPattern(keywords []string) *regexp.Regexp {
+	quoted := make([]string, 0, len(keywords))
+	for _, keyword := range keywords {
+		if keyword != "" {
+			quoted = append(quoted, regexp.QuoteMeta(keyword))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	// prefer the longest keyword at the same position
+	slices.SortFunc(quoted, func(a, b string) int { return len(b) - len(a) })
+
+	// (?i) for case insensitivity, QuoteMeta to avoid regex injection
+	regex := "(?i)" + strings.Join(quoted, "|")
+	pattern, err := regexp.Compile(regex)
+	if err != nil {
+		log.Err(err).Msgf("error compiling highlight regex: '%s'", regex)
+		return nil
+	}
+	return pattern
+}
+
 // CopyToHighlightedFloors converts Floors to HighlightedFloors but doesn't actually perform the highlighting
 func CopyToHighlightedFloors(floors Floors, result HighlightedFloors) {
 	for i, floor := range floors {
@@ -379,109 +575,439 @@ func CopyToHighlightedFloors(floors Floors, result HighlightedFloors) {
 	}
 }
 
-// BulkInsert run in single goroutine only
-// see https://www.elastic.co/guide/en/elasticsearch/reference/master/docs-bulk.html
-func BulkInsert(floors []FloorModel) {
-	if ES == nil {
-		return
+// elasticBackend is the SearchBackend of Elasticsearch, writes go to writeIndices
+type elasticBackend struct{}
+
+// elasticQuery builds the bool query of request, matching content with both the standard and the ik_smart analyzer
+func elasticQuery(request SearchRequest) (*types.Query, *types.Highlight) {
+	keyword, accurate, filter := request.Keyword, request.Accurate, request.Filter
+	startTime, endTime := request.StartTime, request.EndTime
+
+	// our query design:
+	// {
+	// 	"query": {
+	// 		"bool": {
+	// 			"must": [{
+	// 				"dis_max": {
+	// 					"queries": [{
+	// 						 "multi_match": {}
+	// 					 },
+	// 					 {
+	// 						 "multi_match": {}
+	// 					 }]
+	// 				}
+	// 			}], // the keyword and each phrase
+	// 			"filter": {
+	// 				//Term filter
+	// 			},
+	// 			"must_not": {
+	// 				// hidden, sensitive and excluded phrases
+	// 			}
+	// 		}
+	// 	}
+	// }
+
+	var filterQueries []types.Query
+	var mustQueries []types.Query
+
+	// contentQuery matches text with both analyzers
+	contentQuery := func(text string, phrase bool) types.Query {
+		var disMaxQueries []types.Query
+		if phrase {
+			disMaxQueries = []types.Query{
+				{MatchPhrase: map[string]types.MatchPhraseQuery{"content": {Query: text}}},
+				{MatchPhrase: map[string]types.MatchPhraseQuery{"content.ik_smart": {Query: text}}},
+			}
+		} else {
+			disMaxQueries = []types.Query{
+				{Match: map[string]types.MatchQuery{"content": {Query: text}}},
+				{Match: map[string]types.MatchQuery{"content.ik_smart": {Query: text}}},
+			}
+		}
+		return types.Query{DisMax: &types.DisMaxQuery{Queries: disMaxQueries}}
 	}
-	if len(floors) == 0 {
-		return
+
+	if keyword != "" {
+		mustQueries = append(mustQueries, contentQuery(keyword, accurate))
+	}
+	for _, phrase := range request.Phrases {
+		mustQueries = append(mustQueries, contentQuery(phrase, true))
+	}
+
+	if startTime != nil || endTime != nil {
+		dateRangeQuery := types.DateRangeQuery{}
+		if startTime != nil {
+			start := time.Unix(*startTime, 0).UTC().Format(time.RFC3339)
+			dateRangeQuery.Gte = &start
+		}
+		if endTime != nil {
+			end := time.Unix(*endTime, 0).UTC().Format(time.RFC3339)
+			dateRangeQuery.Lte = &end
+		}
+		timeRangeQuery := types.Query{
+			Range: map[string]types.RangeQuery{
+				"updated_at": dateRangeQuery,
+			},
+		}
+		filterQueries = append(filterQueries, timeRangeQuery)
+	}
+
+	if request.MinLikes != nil || request.MaxLikes != nil {
+		likeRangeQuery := types.NumberRangeQuery{}
+		if request.MinLikes != nil {
+			likeRangeQuery.Gte = (*types.Float64)(&[]float64{float64(*request.MinLikes)}[0])
+		}
+		if request.MaxLikes != nil {
+			likeRangeQuery.Lte = (*types.Float64)(&[]float64{float64(*request.MaxLikes)}[0])
+		}
+		filterQueries = append(filterQueries, types.Query{
+			Range: map[string]types.RangeQuery{"like": likeRangeQuery},
+		})
+	}
+
+	if request.AfterFloorID > 0 || request.MaxFloorID > 0 {
+		idRangeQuery := types.NumberRangeQuery{}
+		if request.AfterFloorID > 0 {
+			idRangeQuery.Gt = (*types.Float64)(&[]float64{float64(request.AfterFloorID)}[0])
+		}
+		if request.MaxFloorID > 0 {
+			idRangeQuery.Lte = (*types.Float64)(&[]float64{float64(request.MaxFloorID)}[0])
+		}
+		filterQueries = append(filterQueries, types.Query{
+			Range: map[string]types.RangeQuery{"id": idRangeQuery},
+		})
+	}
+
+	for field, value := range map[string]int{
+		"hole_id":     filter.HoleID,
+		"division_id": filter.DivisionID,
+	} {
+		if value != 0 {
+			filterQueries = append(filterQueries, types.Query{
+				Term: map[string]types.TermQuery{field: {Value: value}},
+			})
+		}
+	}
+	for _, tagID := range filter.TagIDs {
+		filterQueries = append(filterQueries, types.Query{
+			Term: map[string]types.TermQuery{"tag_ids": {Value: tagID}},
+		})
+	}
+
+	// documents indexed before these fields are added have neither of them
+	mustNotQueries := []types.Query{
+		{Term: map[string]types.TermQuery{"hidden": {Value: true}}},
+		{Term: map[string]types.TermQuery{"sensitive": {Value: true}}},
+	}
+	for _, exclude := range request.Excludes {
+		mustNotQueries = append(mustNotQueries, types.Query{
+			MatchPhrase: map[string]types.MatchPhraseQuery{"content": {Query: exclude}},
+		})
+	}
+
+	query := types.Query{
+		Bool: &types.BoolQuery{
+			Must:    mustQueries,
+			Filter:  filterQueries,
+			MustNot: mustNotQueries,
+		},
+	}
+
+	highlight := &types.Highlight{
+		Fields: map[string]types.HighlightField{
+			"content": {
+				NumberOfFragments: &[]int{0}[0],
+			},
+			"content.ik_smart": {
+				NumberOfFragments: &[]int{0}[0],
+			},
+		},
+		PreTags:  []string{HighlightBegin},
+		PostTags: []string{HighlightEnd},
+	}
+
+	return &query, highlight
+}
+
+// elasticSort sorts by score and then by updated_at
+func elasticSort() []types.SortCombinations {
+	return []types.SortCombinations{
+		types.SortOptions{
+			SortOptions: map[string]types.FieldSort{
+				"_score": {Order: &sortorder.Desc},
+			},
+		},
+		types.SortOptions{
+			SortOptions: map[string]types.FieldSort{
+				"updated_at": {Order: &sortorder.Desc},
+			},
+		},
+	}
+}
+
+func elasticSearchError(err error) error {
+	var errorMsg = fmt.Sprintf("error searching floors: %e", err)
+	log.Err(err).Msg("error searching floors")
+
+	var esError *types.ElasticsearchError
+	if errors.As(err, &esError) {
+		data, _ := json.Marshal(esError)
+		log.Err(err).
+			Bytes("error_detail", data).
+			Msg("error searching floors")
+		return &common.HttpError{Code: esError.Status, Message: errorMsg}
+	}
+	return common.InternalServerError(errorMsg)
+}
+
+func elasticHits(esHits []types.Hit) ([]SearchHit, error) {
+	hits := make([]SearchHit, len(esHits))
+	for i, hit := range esHits {
+		id, err := strconv.Atoi(*hit.Id_)
+		if err != nil {
+			var errorMsg = "error parsing floor_id from ElasticSearch ID"
+			log.Err(err).Msg(errorMsg)
+			return nil, common.InternalServerError(errorMsg)
+		}
+		hits[i].FloorID = id
+		if hit.Highlight != nil {
+			var fragments []string
+			if f, ok := hit.Highlight["content"]; ok && len(f) > 0 {
+				fragments = f
+			} else if f, ok := hit.Highlight["content.ik_smart"]; ok && len(f) > 0 {
+				fragments = f
+			}
+			if len(fragments) > 0 {
+				hits[i].HighlightedContent = fragments[0]
+			}
+		}
+	}
+	return hits, nil
+}
+
+// Search runs the query on the alias
+func (elasticBackend) Search(ctx context.Context, request SearchRequest) ([]SearchHit, error) {
+	query, highlight := elasticQuery(request)
+	res, err := ES.Search().
+		Index(IndexName).From(request.Offset).
+		Size(request.Size).Query(query).
+		Highlight(highlight).
+		Sort(elasticSort()...).
+		Do(ctx)
+	if err != nil {
+		return nil, elasticSearchError(err)
+	}
+	return elasticHits(res.Hits.Hits)
+}
+
+// SearchHoles collapses hits on hole_id, the best floors of each hole are returned as inner hits
+func (elasticBackend) SearchHoles(ctx context.Context, request SearchRequest, floorsPerHole int) ([]HoleSearchHit, error) {
+	query, highlight := elasticQuery(request)
+	innerHitsName := "floors"
+	res, err := ES.Search().
+		Index(IndexName).From(request.Offset).
+		Size(request.Size).Query(query).
+		Collapse(&types.FieldCollapse{
+			Field: "hole_id",
+			InnerHits: []types.InnerHits{{
+				Name:      &innerHitsName,
+				Size:      &floorsPerHole,
+				Highlight: highlight,
+				Sort:      elasticSort(),
+			}},
+		}).
+		Sort(elasticSort()...).
+		Do(ctx)
+	if err != nil {
+		return nil, elasticSearchError(err)
+	}
+
+	holeHits := make([]HoleSearchHit, 0, len(res.Hits.Hits))
+	for _, hit := range res.Hits.Hits {
+		var document FloorModel
+		err = json.Unmarshal(hit.Source_, &document)
+		if err != nil {
+			return nil, common.InternalServerError("error parsing floor document")
+		}
+		holeHit := HoleSearchHit{HoleID: document.HoleID}
+		if innerHits, ok := hit.InnerHits[innerHitsName]; ok && innerHits.Hits != nil {
+			if innerHits.Hits.Total != nil {
+				holeHit.Count = int(innerHits.Hits.Total.Value)
+			}
+			holeHit.Floors, err = elasticHits(innerHits.Hits.Hits)
+			if err != nil {
+				return nil, err
+			}
+		}
+		holeHits = append(holeHits, holeHit)
+	}
+	return holeHits, nil
+}
+
+// SimilarHoles runs a more_like_this query on first floors, each shared tag adds to the score
+func (elasticBackend) SimilarHoles(ctx context.Context, request SimilarRequest) ([]int, error) {
+	minTermFreq, minDocFreq, maxQueryTerms := 1, 1, 25
+	var shouldQueries []types.Query
+	for _, tagID := range request.TagIDs {
+		shouldQueries = append(shouldQueries, types.Query{
+			Term: map[string]types.TermQuery{"tag_ids": {Value: tagID}},
+		})
+	}
+	mustNotQueries := []types.Query{
+		{Term: map[string]types.TermQuery{"hidden": {Value: true}}},
+		{Term: map[string]types.TermQuery{"sensitive": {Value: true}}},
+	}
+	if request.ExcludeHoleID != 0 {
+		mustNotQueries = append(mustNotQueries, types.Query{
+			Term: map[string]types.TermQuery{"hole_id": {Value: request.ExcludeHoleID}},
+		})
+	}
+	query := types.Query{
+		Bool: &types.BoolQuery{
+			Must: []types.Query{{
+				MoreLikeThis: &types.MoreLikeThisQuery{
+					Fields:             []string{"content", "content.ik_smart"},
+					Like:               []types.Like{request.Content},
+					MinTermFreq:        &minTermFreq,
+					MinDocFreq:         &minDocFreq,
+					MaxQueryTerms:      &maxQueryTerms,
+					MinimumShouldMatch: "30%",
+				},
+			}},
+			Should: shouldQueries,
+			// documents indexed before ranking is added are not matched until backfilled
+			Filter:  []types.Query{{Term: map[string]types.TermQuery{"ranking": {Value: 0}}}},
+			MustNot: mustNotQueries,
+		},
+	}
+
+	res, err := ES.Search().
+		Index(IndexName).
+		Size(request.Size).Query(&query).
+		Do(ctx)
+	if err != nil {
+		return nil, elasticSearchError(err)
 	}
 
+	holeIDs := make([]int, 0, len(res.Hits.Hits))
+	for _, hit := range res.Hits.Hits {
+		var document FloorModel
+		err = json.Unmarshal(hit.Source_, &document)
+		if err != nil {
+			return nil, common.InternalServerError("error parsing floor document")
+		}
+		if !slices.Contains(holeIDs, document.HoleID) {
+			holeIDs = append(holeIDs, document.HoleID)
+		}
+	}
+	return holeIDs, nil
+}
+
+// BulkIndex see https://www.elastic.co/guide/en/elasticsearch/reference/master/docs-bulk.html
+func (elasticBackend) BulkIndex(floors []FloorModel) error {
+	var errs []error
+	for _, index := range writeIndices() {
+		err := bulkIndex(index, floors)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("index %s: %w", index, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// bulkIndex inserts or replaces documents of floors in the index
+func bulkIndex(index string, floors []FloorModel) error {
+	return bulkWrite(index, "index", floors)
+}
+
+// bulkCreate inserts documents of floors into the index, existing documents are kept
+func bulkCreate(index string, floors []FloorModel) error {
+	return bulkWrite(index, "create", floors)
+}
+
+func bulkWrite(index string, action string, floors []FloorModel) error {
 	var BulkBuffer = bytes.NewBuffer(make([]byte, 0, 1024000)) // 100 KB buffer
 
 	for _, floor := range floors {
-		// meta: use index, it will insert or replace a document
-		BulkBuffer.WriteString(fmt.Sprintf(`{ "index" : { "_id" : "%d" } }%s`, floor.ID, "\n"))
+		// meta: index inserts or replaces a document, create fails with a conflict if the document exists
+		BulkBuffer.WriteString(fmt.Sprintf(`{ "%s" : { "_id" : "%d" } }%s`, action, floor.ID, "\n"))
 
 		// data: should not contain \n, because \n is the delimiter of one action
 		data, err := json.Marshal(floor)
 		if err != nil {
-			log.Printf("error failed to marshal floor: %s", err)
-			return
+			return err
 		}
 		BulkBuffer.Write(data)
 		BulkBuffer.WriteByte('\n') // the final line of data must end with a newline character \n
 	}
 
-	var floorIDs []int
-	for _, floorModel := range floors {
-		floorIDs = append(floorIDs, floorModel.ID)
-	}
-	log.Info().Ints("floor_ids", floorIDs).Msg("Preparing insert floors")
-
-	_, err := ES.Bulk().Index(IndexName).Raw(BulkBuffer).Do(context.Background())
+	res, err := ES.Bulk().Index(index).Raw(BulkBuffer).Do(context.Background())
 	if err != nil {
-		log.Printf("error indexing floors %v: %s", floorIDs, err)
-		return
+		return err
+	}
+	if !res.Errors {
+		return nil
 	}
-	log.Info().Ints("floor_ids", floorIDs).Msg("index floors success")
+	for _, item := range res.Items {
+		for _, result := range item {
+			if result.Error != nil && !(action == "create" && result.Status == http.StatusConflict) {
+				return fmt.Errorf("bulk request to %s has failed items", index)
+			}
+		}
+	}
+	return nil
 }
 
-// BulkDelete used when a hole becomes hidden and delete all of its floors
-func BulkDelete(floorIDs []int) {
-	if ES == nil {
-		return
-	}
-	if len(floorIDs) == 0 {
-		return
+func (elasticBackend) BulkDelete(floorIDs []int) error {
+	var errs []error
+	for _, index := range writeIndices() {
+		err := bulkDelete(index, floorIDs)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("index %s: %w", index, err))
+		}
 	}
+	return errors.Join(errs...)
+}
 
+// bulkDelete deletes documents of floors from the index
+func bulkDelete(index string, floorIDs []int) error {
 	var BulkBuffer = bytes.NewBuffer(make([]byte, 0, 1024000)) // 100 KB buffer
 
 	for _, floorID := range floorIDs {
-		// meta: use index, it will insert or replace a document
 		BulkBuffer.WriteString(fmt.Sprintf(`{ "delete" : { "_id" : "%d" } }%s`, floorID, "\n"))
 	}
-	log.Info().Ints("floor_ids", floorIDs).Msg("Preparing delete floors")
 
 	_, err := ES.Bulk().
-		Index(IndexName).
+		Index(index).
 		Raw(BulkBuffer).
 		Do(context.Background())
-	if err != nil {
-		log.Printf("error deleting floors %v: %s", floorIDs, err)
-		return
-	}
-	log.Info().Ints("floor_ids", floorIDs).Msg("delete floors success")
+	return err
 }
 
-// FloorIndex insert or replace a document, used when a floor is created or restored
-// see https://www.elastic.co/guide/en/elasticsearch/reference/master/docs-index_.html
-func FloorIndex(floorModel FloorModel) {
-	if ES == nil {
-		return
-	}
-
-	_, err := ES.
-		Index(IndexName).
-		Id(strconv.Itoa(floorModel.ID)).
-		Document(&floorModel).
-		Refresh(refresh.Refresh{Name: "false"}).
-		Do(context.Background())
-
-	if err != nil {
-		log.Err(err).
-			Msg("error index floor")
-	} else {
-		log.Info().Int("floor_id", floorModel.ID).Msg("index floor success")
+// Index see https://www.elastic.co/guide/en/elasticsearch/reference/master/docs-index_.html
+func (elasticBackend) Index(floorModel FloorModel) error {
+	var errs []error
+	for _, index := range writeIndices() {
+		_, err := ES.
+			Index(index).
+			Id(strconv.Itoa(floorModel.ID)).
+			Document(&floorModel).
+			Refresh(refresh.Refresh{Name: "false"}).
+			Do(context.Background())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("index %s: %w", index, err))
+		}
 	}
+	return errors.Join(errs...)
 }
 
-// FloorDelete used when a floor is deleted
-func FloorDelete(floorID int) {
-	if ES == nil {
-		return
-	}
-	_, err := ES.Delete(
-		IndexName,
-		strconv.Itoa(floorID)).Do(context.Background())
-
-	if err != nil {
-		log.Err(err).
-			Msg("error delete floor")
-	} else {
-		log.Info().Int("floor_id", floorID).Msg("delete floor success")
+func (elasticBackend) Delete(floorID int) error {
+	var errs []error
+	for _, index := range writeIndices() {
+		_, err := ES.Delete(index, strconv.Itoa(floorID)).Do(context.Background())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("index %s: %w", index, err))
+		}
 	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,180 @@
+package models
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/goccy/go-json"
+	"github.com/opentreehole/go-common"
+	"golang.org/x/exp/slices"
+)
+
+// IndexAuditReportKey is the cache key of the latest IndexAuditReport
+const IndexAuditReportKey = "index_audit_report"
+
+// indexAuditMaxIDs bounds floor ids kept in an IndexAuditMismatch
+const indexAuditMaxIDs = 100
+
+// IndexAuditMismatch counts floors of one kind of mismatch, with at most 100 of their ids
+type IndexAuditMismatch struct {
+	Count    int   `json:"count"`
+	FloorIDs []int `json:"floor_ids"`
+}
+
+func (m *IndexAuditMismatch) add(floorID int) {
+	m.Count++
+	if len(m.FloorIDs) < indexAuditMaxIDs {
+		m.FloorIDs = append(m.FloorIDs, floorID)
+	}
+}
+
+// IndexAuditReport is the result of comparing floors in the database with documents in the search index
+type IndexAuditReport struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// floors with id in [FromID, ToID] are checked
+	FromID  int `json:"from_id"`
+	ToID    int `json:"to_id"`
+	Checked int `json:"checked"`
+	// searchable floors not in the index
+	Missing IndexAuditMismatch `json:"missing"`
+	// documents with outdated content, hole, division, tags, hidden or sensitive state,
+	// or without fields added to the mapping later
+	Stale IndexAuditMismatch `json:"stale"`
+	// documents of floors that are deleted, sensitive or in hidden holes
+	Extra IndexAuditMismatch `json:"extra"`
+	// whether mismatches are fixed
+	Repaired bool `json:"repaired"`
+}
+
+// AuditFloorIndex compares at most size floors from fromID on with their documents in the index,
+// mismatched documents are reindexed or deleted if repair is true
+func AuditFloorIndex(ctx context.Context, fromID, size int, repair bool) (*IndexAuditReport, error) {
+	if ES == nil {
+		return nil, common.BadRequest("Elasticsearch 未启用")
+	}
+
+	report := IndexAuditReport{StartedAt: time.Now(), FromID: fromID, ToID: fromID, Repaired: repair}
+	lastID := fromID - 1
+	for report.Checked < size {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		var floors Floors
+		err := DB.Where("id > ?", lastID).
+			Order("id").Limit(min(floorBackfillBatchSize, size-report.Checked)).
+			Find(&floors).Error
+		if err != nil {
+			return nil, err
+		}
+		if len(floors) == 0 {
+			break
+		}
+
+		err = auditFloorBatch(ctx, floors, &report, repair)
+		if err != nil {
+			return nil, err
+		}
+		lastID = floors[len(floors)-1].ID
+		report.ToID = lastID
+		report.Checked += len(floors)
+	}
+	report.FinishedAt = time.Now()
+	return &report, nil
+}
+
+func auditFloorBatch(ctx context.Context, floors Floors, report *IndexAuditReport, repair bool) error {
+	floorModels, err := NewFloorModels(DB, floors)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, len(floors))
+	for i, floor := range floors {
+		ids[i] = strconv.Itoa(floor.ID)
+	}
+	res, err := ES.Mget().Index(IndexName).Ids(ids...).Do(ctx)
+	if err != nil {
+		return err
+	}
+	documents := make(map[int]FloorModel, len(res.Docs))
+	// documents indexed before fields are added, missing fields decode to zero values
+	incomplete := make(map[int]bool)
+	for _, item := range res.Docs {
+		result, ok := item.(*types.GetResult)
+		if !ok || !result.Found {
+			continue
+		}
+		var document FloorModel
+		err = json.Unmarshal(result.Source_, &document)
+		if err != nil {
+			return err
+		}
+		id, err := strconv.Atoi(result.Id_)
+		if err != nil {
+			return err
+		}
+		documents[id] = document
+
+		var fields map[string]json.RawMessage
+		err = json.Unmarshal(result.Source_, &fields)
+		if err != nil {
+			return err
+		}
+		for field := range floorMappingProperties {
+			if _, ok := fields[field]; !ok {
+				incomplete[id] = true
+				break
+			}
+		}
+	}
+
+	var toIndex []FloorModel
+	var toDelete []int
+	for i, expected := range floorModels {
+		document, found := documents[expected.ID]
+		searchable := floorSearchable(floors[i], expected)
+		switch {
+		case searchable && !found:
+			report.Missing.add(expected.ID)
+			toIndex = append(toIndex, expected)
+		case searchable && (incomplete[expected.ID] || floorDocumentOutdated(expected, document)):
+			report.Stale.add(expected.ID)
+			toIndex = append(toIndex, expected)
+		case !searchable && found:
+			report.Extra.add(expected.ID)
+			toDelete = append(toDelete, expected.ID)
+		}
+	}
+
+	if repair {
+		BulkInsert(toIndex)
+		BulkDelete(toDelete)
+	}
+	return nil
+}
+
+// floorDocumentOutdated compares the fields that affect searching, updated_at is ignored
+func floorDocumentOutdated(expected, document FloorModel) bool {
+	if expected.Content != document.Content ||
+		expected.HoleID != document.HoleID ||
+		expected.DivisionID != document.DivisionID ||
+		expected.Hidden != document.Hidden ||
+		expected.Sensitive != document.Sensitive ||
+		expected.Ranking != document.Ranking ||
+		expected.Like != document.Like ||
+		len(expected.TagIDs) != len(document.TagIDs) {
+		return true
+	}
+	for _, tagID := range expected.TagIDs {
+		if !slices.Contains(document.TagIDs, tagID) {
+			return true
+		}
+	}
+	return false
+}
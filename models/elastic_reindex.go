@@ -0,0 +1,235 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/opentreehole/go-common"
+	"github.com/rs/zerolog/log"
+
+	"treehole_next/utils"
+)
+
+// ReindexStatus is the progress of the latest ReindexFloors
+type ReindexStatus struct {
+	// the versioned index being built
+	Index      string     `json:"index"`
+	Running    bool       `json:"running"`
+	Total      int64      `json:"total"`
+	Done       int64      `json:"done"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Error      string     `json:"error,omitempty"`
+}
+
+var reindexState struct {
+	sync.RWMutex
+	status ReindexStatus
+	// dualWriteIndex receives writes besides IndexName until the alias is swapped
+	dualWriteIndex string
+}
+
+// reindexDualWriteKey is the cache key of the index being built, shared with other instances
+// so that their writes go to the new index as well
+const reindexDualWriteKey = "reindex_dual_write_index"
+
+// reindexDualWriteLease bounds how long other instances keep writing to the new index
+// if the reindexing instance dies, it is renewed after each batch
+const reindexDualWriteLease = 10 * time.Minute
+
+// setDualWriteIndex starts or renews writing to index besides IndexName on all instances, or stops it if index is empty
+func setDualWriteIndex(index string) {
+	reindexState.Lock()
+	reindexState.dualWriteIndex = index
+	reindexState.Unlock()
+
+	var err error
+	if index == "" {
+		err = utils.DeleteCache(reindexDualWriteKey)
+	} else {
+		err = utils.SetCache(reindexDualWriteKey, index, reindexDualWriteLease)
+	}
+	if err != nil {
+		log.Err(err).Str("index", index).Msg("error sharing dual write index")
+	}
+}
+
+// GetReindexStatus returns the progress of the running or the latest reindexing
+func GetReindexStatus() ReindexStatus {
+	reindexState.RLock()
+	defer reindexState.RUnlock()
+	return reindexState.status
+}
+
+// writeIndices returns indices that writes go to, the new index is included while reindexing on any instance
+// so that floors changed after being copied are not lost after the alias swap
+func writeIndices() []string {
+	reindexState.RLock()
+	index := reindexState.dualWriteIndex
+	reindexState.RUnlock()
+	if index == "" && !utils.GetCache(reindexDualWriteKey, &index) {
+		return []string{IndexName}
+	}
+	return []string{IndexName, index}
+}
+
+// floorMapping is the full mapping of a new floor index
+func floorMapping() *types.TypeMapping {
+	ikSmart := "ik_smart"
+	content := types.NewTextProperty()
+	contentIkSmart := types.NewTextProperty()
+	contentIkSmart.Analyzer = &ikSmart
+	content.Fields = map[string]types.Property{"ik_smart": contentIkSmart}
+
+	properties := map[string]types.Property{
+		"id":         types.NewIntegerNumberProperty(),
+		"updated_at": types.NewDateProperty(),
+		"content":    content,
+	}
+	for field, property := range floorMappingProperties {
+		properties[field] = property
+	}
+	return &types.TypeMapping{Properties: properties}
+}
+
+// ReindexFloors copies all visible searchable floors from the database into a new versioned index,
+// then points the alias IndexName to it atomically, so that searching is never interrupted.
+// Writes on all instances go to both indices meanwhile, and floors changed since the start are synced again before the swap.
+// The legacy concrete index named IndexName is removed in the same request,
+// older versioned indices are kept for rolling back and should be deleted manually.
+func ReindexFloors(ctx context.Context) error {
+	if ES == nil {
+		return common.BadRequest("Elasticsearch 未启用")
+	}
+
+	now := time.Now()
+	index := fmt.Sprintf("%s_v%s", IndexName, now.Format("20060102150405"))
+	reindexState.Lock()
+	var running string
+	if reindexState.status.Running || utils.GetCache(reindexDualWriteKey, &running) {
+		reindexState.Unlock()
+		return common.BadRequest("索引正在重建")
+	}
+	reindexState.status = ReindexStatus{Index: index, Running: true, StartedAt: &now}
+	reindexState.Unlock()
+
+	err := reindexFloors(ctx, index, now)
+
+	setDualWriteIndex("")
+	finishedAt := time.Now()
+	reindexState.Lock()
+	reindexState.status.Running = false
+	reindexState.status.FinishedAt = &finishedAt
+	if err != nil {
+		reindexState.status.Error = err.Error()
+	}
+	reindexState.Unlock()
+
+	if err != nil {
+		log.Err(err).Str("index", index).Msg("reindex floors failed")
+		_, deleteErr := ES.Indices.Delete(index).Do(context.Background())
+		if deleteErr != nil {
+			log.Err(deleteErr).Str("index", index).Msg("error deleting unfinished index")
+		}
+		return err
+	}
+	log.Info().Str("index", index).Int64("total", GetReindexStatus().Done).Msg("reindex floors done")
+	return nil
+}
+
+func reindexFloors(ctx context.Context, index string, startedAt time.Time) error {
+	var total int64
+	err := visibleSearchableFloors(DB).Model(&Floor{}).Count(&total).Error
+	if err != nil {
+		return err
+	}
+
+	_, err = ES.Indices.Create(index).Mappings(floorMapping()).Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	reindexState.Lock()
+	reindexState.status.Total = total
+	reindexState.Unlock()
+	setDualWriteIndex(index)
+
+	err = eachFloorModelBatch(ctx, func(floorModels []FloorModel) error {
+		// documents written by instances meanwhile are newer than the copies
+		err := bulkCreate(index, floorModels)
+		if err != nil {
+			return err
+		}
+		setDualWriteIndex(index)
+
+		reindexState.Lock()
+		reindexState.status.Done += int64(len(floorModels))
+		status := reindexState.status
+		reindexState.Unlock()
+		log.Info().Str("index", index).Int64("done", status.Done).Int64("total", status.Total).Msg("reindex floors")
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// writes missed by instances not seeing the dual write index yet
+	err = eachChangedFloorModelBatch(ctx, startedAt, func(toIndex []FloorModel, toDelete []int) error {
+		if len(toIndex) > 0 {
+			err := bulkIndex(index, toIndex)
+			if err != nil {
+				return err
+			}
+		}
+		if len(toDelete) > 0 {
+			return bulkDelete(index, toDelete)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = ES.Indices.Refresh().Index(index).Do(ctx)
+	if err != nil {
+		return err
+	}
+	return swapFloorAlias(ctx, index)
+}
+
+// swapFloorAlias points IndexName to index in a single request,
+// removing the alias from other indices, or removing the legacy concrete index
+func swapFloorAlias(ctx context.Context, index string) error {
+	alias := IndexName
+	actions := []types.IndicesAction{{Add: &types.AddAction{Alias: &alias, Index: &index}}}
+
+	isAlias, err := ES.Indices.ExistsAlias(alias).Do(ctx)
+	if err != nil {
+		return err
+	}
+	if isAlias {
+		aliases, err := ES.Indices.GetAlias().Name(alias).Do(ctx)
+		if err != nil {
+			return err
+		}
+		for oldIndex := range aliases {
+			if oldIndex != index {
+				actions = append(actions, types.IndicesAction{Remove: &types.RemoveAction{Alias: &alias, Index: &oldIndex}})
+			}
+		}
+	} else {
+		exists, err := ES.Indices.Exists(alias).Do(ctx)
+		if err != nil {
+			return err
+		}
+		if exists {
+			actions = append(actions, types.IndicesAction{RemoveIndex: &types.RemoveIndexAction{Index: &alias}})
+		}
+	}
+
+	_, err = ES.Indices.UpdateAliases().Actions(actions...).Do(ctx)
+	return err
+}
@@ -1,12 +1,15 @@
 package models
 
 import (
+	"encoding/base64"
 	"fmt"
 	"time"
 	"treehole_next/utils/sensitive"
 
+	"github.com/goccy/go-json"
 	"github.com/opentreehole/go-common"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
 
 	"treehole_next/utils"
 
@@ -99,6 +102,9 @@ type Floor struct {
 
 	// whether the user is the author of the floor
 	IsMe bool `json:"is_me" gorm:"-:all"`
+
+	// aggregated reactions with non-zero count, including like and dislike
+	Reactions []FloorReactionCount `json:"reactions" gorm:"-:all"`
 }
 
 func (floor *Floor) GetID() int {
@@ -151,6 +157,138 @@ func (floors Floors) MakeQuerySet(holeID, offset, size *int, c *fiber.Ctx, tx ..
 	return querySet, nil
 }
 
+// FloorCursor is an opaque position in the floor list of a hole.
+// Floors are keyed on (ranking, id), or (like, id) when ordered by like.
+type FloorCursor struct {
+	Value int `json:"v"`
+	ID    int `json:"i"`
+	// Backward means that the page before this position is requested
+	Backward bool `json:"b,omitempty"`
+}
+
+// NewFloorCursor builds the cursor pointing to floor under the given order_by field.
+func NewFloorCursor(floor *Floor, orderBy string, backward bool) *FloorCursor {
+	cursor := FloorCursor{Value: floor.Ranking, ID: floor.ID, Backward: backward}
+	if orderBy == "like" {
+		cursor.Value = floor.Like
+	}
+	return &cursor
+}
+
+func (cursor *FloorCursor) Encode() string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeFloorCursor parses a cursor encoded by FloorCursor.Encode, an empty string means the first page.
+func DecodeFloorCursor(raw string) (*FloorCursor, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, common.BadRequest("cursor 无效")
+	}
+	var cursor FloorCursor
+	if err = json.Unmarshal(data, &cursor); err != nil {
+		return nil, common.BadRequest("cursor 无效")
+	}
+	return &cursor, nil
+}
+
+// MakeCursorQuerySet creates a keyset pagination query set for floors in a hole.
+// It takes the following parameters:
+// - holeID: the ID of the hole to filter by.
+// - cursor: the position to start from, nil for the first page.
+// - size: the size for pagination, one more row is fetched to tell whether there is another page.
+// - orderBy: "id" orders floors by (ranking, id), "like" orders by (like, id).
+// - sort: "asc" or "desc".
+// - c: context of the request.
+// - tx: optional *gorm.DB, use it when provided (e.g. in transaction).
+//
+// If cursor.Backward is set, rows are returned in reverse order and should be reversed by the caller.
+func (floors Floors) MakeCursorQuerySet(holeID int, cursor *FloorCursor, size int, orderBy, sort string, c *fiber.Ctx, tx ...*gorm.DB) (*gorm.DB, error) {
+	querySet, err := floors.MakeQuerySet(&holeID, nil, nil, c, tx...)
+	if err != nil {
+		return nil, err
+	}
+
+	column := "ranking"
+	if orderBy == "like" {
+		column = "`like`"
+	}
+
+	desc := sort == "desc"
+	if cursor != nil && cursor.Backward {
+		desc = !desc
+	}
+
+	if cursor != nil {
+		operator := ">"
+		if desc {
+			operator = "<"
+		}
+		querySet = querySet.Where(fmt.Sprintf("(%s, id) %s (?, ?)", column, operator), cursor.Value, cursor.ID)
+	}
+
+	direction := "asc"
+	if desc {
+		direction = "desc"
+	}
+	return querySet.Order(column + " " + direction).Order("id " + direction).Limit(size + 1), nil
+}
+
+// maxConversationDepth limits the number of ancestors walked by LoadConversation
+const maxConversationDepth = 100
+
+// LoadConversation returns the thread around the floor in dialog mode:
+// its reply_to ancestors, the floor itself and the floors directly replying to it,
+// all inside the same hole and ordered by ranking.
+func (floor *Floor) LoadConversation(tx *gorm.DB) (Floors, error) {
+	conversation := Floors{floor}
+	visited := map[int]bool{floor.ID: true}
+
+	// walk up the reply_to chain, stop at floors in other holes or cycles
+	replyTo := floor.ReplyTo
+	for depth := 0; replyTo != 0 && !visited[replyTo] && depth < maxConversationDepth; depth++ {
+		querySet, err := MakeFloorQuerySet(nil, tx)
+		if err != nil {
+			return nil, err
+		}
+		var parent Floor
+		err = querySet.Where("hole_id = ?", floor.HoleID).Limit(1).Find(&parent, replyTo).Error
+		if err != nil {
+			return nil, err
+		}
+		if parent.ID == 0 {
+			break
+		}
+		visited[parent.ID] = true
+		conversation = append(conversation, &parent)
+		replyTo = parent.ReplyTo
+	}
+
+	querySet, err := MakeFloorQuerySet(nil, tx)
+	if err != nil {
+		return nil, err
+	}
+	var replies Floors
+	err = querySet.Where("hole_id = ? AND reply_to = ?", floor.HoleID, floor.ID).Find(&replies).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, reply := range replies {
+		if !visited[reply.ID] {
+			conversation = append(conversation, reply)
+		}
+	}
+
+	slices.SortFunc(conversation, func(a, b *Floor) int {
+		return a.Ranking - b.Ranking
+	})
+	return conversation, nil
+}
+
 // MakeQuerySetWithTimeRange creates a query set for the Floors model with an optional time range filter.
 // It takes the following parameters:
 // - holeID: the ID of the hole to filter by.
@@ -225,6 +363,12 @@ func (floors Floors) Preprocess(c *fiber.Ctx) (err error) {
 		return
 	}
 
+	// get floors' reactions, after likes are loaded
+	err = floors.loadFloorReactions(c)
+	if err != nil {
+		return
+	}
+
 	// set floors IsMe
 	for _, floor := range floors {
 		floor.IsMe = userID == floor.UserID
@@ -382,13 +526,9 @@ func (floor *Floor) Create(tx *gorm.DB, hole *Hole, c *fiber.Ctx) (err error) {
 
 	if !hole.Hidden && !floor.Sensitive() {
 		// insert into Elasticsearch
-		go FloorIndex(FloorModel{
-			ID:        floor.ID,
-			UpdatedAt: time.Now(),
-			Content:   floor.Content,
-		})
+		IndexFloors(tx, Floors{floor})
 	} else {
-		go FloorDelete(floor.ID)
+		FloorDelete(floor.ID)
 	}
 
 	// delete cache
@@ -501,6 +641,9 @@ func (floor *Floor) SendSubscription(tx *gorm.DB) Notification {
 		}
 	}
 
+	// filter users who muted the hole
+	userIDs = filterMutedHole(tx, userIDs, floor.HoleID)
+
 	// Construct Notification
 	message := Notification{
 		Data:           floor,
@@ -526,7 +669,7 @@ func (floor *Floor) SendReply(tx *gorm.DB) Notification {
 	// return if no recipients or isMe
 	var userIDs []int
 	if userID != 0 && userID != floor.UserID {
-		userIDs = []int{userID}
+		userIDs = filterMutedHole(tx, []int{userID}, floor.HoleID)
 	}
 
 	// construct message
@@ -543,7 +686,7 @@ func (floor *Floor) SendReply(tx *gorm.DB) Notification {
 	return message
 }
 
-func (floor *Floor) SendMention(_ *gorm.DB) Notification {
+func (floor *Floor) SendMention(tx *gorm.DB) Notification {
 	// get recipients
 	var userIDs []int
 	for _, mention := range floor.Mention {
@@ -552,9 +695,17 @@ func (floor *Floor) SendMention(_ *gorm.DB) Notification {
 			continue
 		}
 
+		// not send if the mentioned floor is muted
+		if isFloorMuted(tx, mention.UserID, mention.ID) {
+			continue
+		}
+
 		userIDs = append(userIDs, mention.UserID)
 	}
 
+	// filter users who muted the hole
+	userIDs = filterMutedHole(tx, userIDs, floor.HoleID)
+
 	// construct message
 	message := Notification{
 		Data:           floor,
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+)
+
+const (
+	// ReactionLike is the projection of floor.Like, stored in floor_like
+	ReactionLike = "👍"
+	// ReactionDislike is the projection of floor.Dislike, stored in floor_like
+	ReactionDislike = "👎"
+)
+
+// FloorReactionEmojis is the fixed set of reactions, in display order
+var FloorReactionEmojis = []string{ReactionLike, ReactionDislike, "😂", "😢", "🤔", "❤️", "🎉"}
+
+// FloorReaction stores reactions except like and dislike, a user can react with several emojis
+type FloorReaction struct {
+	FloorID   int       `json:"floor_id" gorm:"primaryKey"`
+	UserID    int       `json:"-" gorm:"primaryKey"`
+	Emoji     string    `json:"emoji" gorm:"primaryKey;size:16"`
+	CreatedAt time.Time `json:"time_created"`
+}
+
+// FloorReactionCount is the aggregated count of an emoji on a floor
+type FloorReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+	// whether the current user has reacted with this emoji
+	Reacted bool `json:"reacted"`
+}
+
+func (floors Floors) loadFloorReactions(c *fiber.Ctx) (err error) {
+	if len(floors) == 0 {
+		return nil
+	}
+	userID, err := common.GetUserID(c)
+	if err != nil {
+		return
+	}
+
+	floorIDs := make([]int, len(floors))
+	for i, floor := range floors {
+		floorIDs[i] = floor.ID
+	}
+
+	var counts []struct {
+		FloorID int
+		Emoji   string
+		Count   int
+	}
+	err = DB.Model(&FloorReaction{}).
+		Select("floor_id, emoji, COUNT(*) AS count").
+		Where("floor_id IN ?", floorIDs).
+		Group("floor_id, emoji").
+		Scan(&counts).Error
+	if err != nil {
+		return
+	}
+
+	var reactions []FloorReaction
+	err = DB.Clauses(dbresolver.Write).
+		Where("floor_id IN ? AND user_id = ?", floorIDs, userID).
+		Find(&reactions).Error
+	if err != nil {
+		return
+	}
+
+	for _, floor := range floors {
+		floor.Reactions = make([]FloorReactionCount, 0)
+		for _, emoji := range FloorReactionEmojis {
+			reaction := FloorReactionCount{Emoji: emoji}
+			switch emoji {
+			case ReactionLike:
+				reaction.Count = floor.Like
+				reaction.Reacted = floor.Liked == 1
+			case ReactionDislike:
+				reaction.Count = floor.Dislike
+				reaction.Reacted = floor.Liked == -1
+			default:
+				for _, count := range counts {
+					if count.FloorID == floor.ID && count.Emoji == emoji {
+						reaction.Count = count.Count
+						break
+					}
+				}
+				reaction.Reacted = slices.ContainsFunc(reactions, func(r FloorReaction) bool {
+					return r.FloorID == floor.ID && r.Emoji == emoji
+				})
+			}
+			if reaction.Count > 0 {
+				floor.Reactions = append(floor.Reactions, reaction)
+			}
+		}
+	}
+	return
+}
+
+// ModifyReaction adds or removes a reaction of the user,
+// like and dislike are written through ModifyLike so that floor.Like and floor.Dislike stay compatible.
+// The caller should save floor.Like and floor.Dislike.
+func (floor *Floor) ModifyReaction(tx *gorm.DB, userID int, emoji string, add bool) (err error) {
+	if !slices.Contains(FloorReactionEmojis, emoji) {
+		return common.BadRequest("不支持的表情")
+	}
+
+	if emoji == ReactionLike || emoji == ReactionDislike {
+		var likeOption int8 = 1
+		if emoji == ReactionDislike {
+			likeOption = -1
+		}
+		if add {
+			return floor.ModifyLike(tx, userID, likeOption)
+		}
+
+		var floorLike FloorLike
+		err = tx.Where("floor_id = ? AND user_id = ?", floor.ID, userID).Limit(1).Find(&floorLike).Error
+		if err != nil {
+			return err
+		}
+		if floorLike.LikeData != likeOption {
+			// nothing to remove, keep the other one
+			return floor.ModifyLike(tx, userID, floorLike.LikeData)
+		}
+		return floor.ModifyLike(tx, userID, 0)
+	}
+
+	reaction := FloorReaction{FloorID: floor.ID, UserID: userID, Emoji: emoji}
+	if add {
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&reaction).Error
+	}
+	return tx.Delete(&reaction).Error
+}
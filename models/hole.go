@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"time"
 
@@ -28,9 +29,12 @@ type Hole struct {
 
 	/// base info
 
-	// 浏览量
+	// 浏览量，同一用户在 HoleViewWindowSeconds 内只计一次
 	View int `json:"view" gorm:"not null;default:0"`
 
+	// 独立访客数
+	UniqueView int `json:"unique_view" gorm:"not null;default:0"`
+
 	// 回复量（即该洞下 floor 的数量 - 1）
 	Reply int `json:"reply" gorm:"not null;default:0"`
 
@@ -70,6 +74,9 @@ type Hole struct {
 	FavoriteCount     int `json:"favorite_count" gorm:"not null;default:0"`
 	SubscriptionCount int `json:"subscription_count" gorm:"not null;default:0"`
 
+	// 热度，由后台任务定期刷新，用于 order=hot 排序与分页
+	HotScore float64 `json:"hot_score" gorm:"not null;default:0;index:idx_hole_hot,sort:desc"`
+
 	/// generated field
 
 	// 兼容旧版 id
@@ -90,6 +97,9 @@ type Hole struct {
 
 	// AI 摘要可用性，仅用于序列化
 	AISummaryAvailable bool `json:"ai_summary_available" gorm:"-"`
+
+	// 投票，没有则为 null；创建时由洞主提供
+	Poll *Poll `json:"poll" gorm:"-:all"`
 }
 
 func (hole *Hole) GetID() int {
@@ -345,6 +355,11 @@ func (holes Holes) Preprocess(c *fiber.Ctx) error {
 		return err
 	}
 
+	err = holes.loadPolls(c)
+	if err != nil {
+		return err
+	}
+
 	// Set FrozenFrontend field for admin users only
 	// If there's an error getting user info, silently skip (safe default: don't show frozen field)
 	user, err := GetCurrLoginUser(c)
@@ -427,6 +442,38 @@ func (holes Holes) MakeQuerySet(offset common.CustomTime, size int, order string
 		Order("hole.updated_at desc").Limit(size), nil
 }
 
+// HoleHotCursor is a position in the hot list, holes are keyed on (hot_score, id)
+type HoleHotCursor struct {
+	Score float64
+	ID    int
+}
+
+// MakeHotQuerySet 构建按热度排序的树洞查询集，cursor 为上一页最后一个树洞的位置，nil 表示第一页。
+func (holes Holes) MakeHotQuerySet(cursor *HoleHotCursor, size int, c *fiber.Ctx, tx ...*gorm.DB) (*gorm.DB, error) {
+	querySet, err := MakeHoleQuerySet(c, tx...)
+	if err != nil {
+		return nil, err
+	}
+	if cursor != nil {
+		querySet = querySet.Where("(hole.hot_score, hole.id) < (?, ?)", cursor.Score, cursor.ID)
+	}
+	return querySet.
+		Order("hole.hot_score desc").
+		Order("hole.id desc").Limit(size), nil
+}
+
+// holeHotEpoch is the zero point of the time term in hot scores
+var holeHotEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// HoleHotScore computes the hot score of a hole.
+// The score is log10 of the engagement plus a term growing with the creation time,
+// so scores decay relative to newer holes without changing as time passes,
+// which keeps pagination on (hot_score, id) stable between refreshes.
+func HoleHotScore(view, reply, favoriteCount, likes int, createdAt time.Time) float64 {
+	engagement := float64(view) + 10*float64(reply) + 20*float64(favoriteCount) + 5*float64(likes)
+	return math.Log10(math.Max(engagement, 1)) + createdAt.Sub(holeHotEpoch).Seconds()/config.Config.HoleHotDecaySeconds
+}
+
 /************************
 	create and modify hole methods
  ************************/
@@ -468,14 +515,19 @@ func (hole *Hole) SetHoleFloor() {
 	//hole.HoleFloor.LastFloor.SetDefaults(c)
 }
 
-func (hole *Hole) Create(tx *gorm.DB, user *User, tagNames []string, c *fiber.Ctx) (err error) {
+func (hole *Hole) Create(tx *gorm.DB, user *User, tagNames []string, checkSimilarTags bool, c *fiber.Ctx) (err error) {
+	if hole.Poll != nil && hole.Poll.Deadline != nil && !hole.Poll.Deadline.After(time.Now()) {
+		return common.BadRequest("投票截止时间必须晚于当前时间")
+	}
+
 	// Create hole.Tags, in different sql session
-	hole.Tags, err = FindOrCreateTags(tx, user, tagNames)
+	hole.Tags, err = FindOrCreateTags(tx, user, tagNames, checkSimilarTags)
 	if err != nil {
 		return err
 	}
 
 	var firstFloor = hole.Floors[0]
+	hole.HotScore = HoleHotScore(0, 0, 0, 0, time.Now())
 
 	// Find floor.Mentions, in different sql session
 	firstFloor.Mention, err = LoadFloorMentions(tx, firstFloor.Content)
@@ -506,6 +558,15 @@ func (hole *Hole) Create(tx *gorm.DB, user *User, tagNames []string, c *fiber.Ct
 			return err
 		}
 
+		// Create poll with its options
+		if hole.Poll != nil {
+			hole.Poll.HoleID = hole.ID
+			err = tx.Create(hole.Poll).Error
+			if err != nil {
+				return err
+			}
+		}
+
 		// Create floor, set floor_mention association in AfterCreate hook
 		return tx.Omit(clause.Associations).Create(&firstFloor).Error
 	})
@@ -525,11 +586,7 @@ func (hole *Hole) Create(tx *gorm.DB, user *User, tagNames []string, c *fiber.Ct
 
 	// index
 	if !firstFloor.Sensitive() {
-		go FloorIndex(FloorModel{
-			ID:        firstFloor.ID,
-			UpdatedAt: time.Now(),
-			Content:   firstFloor.Content,
-		})
+		IndexFloors(tx, Floors{firstFloor})
 	} else {
 		firstFloor.SendSensitive(tx)
 		// firstFloor.Content = ""
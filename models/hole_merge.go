@@ -0,0 +1,212 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/opentreehole/go-common"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"treehole_next/utils"
+)
+
+// Merge moves all floors of hole from into hole, it should be called in a transaction.
+//   - floors of from are appended to hole with rankings renumbered after hole.Reply
+//   - a user keeps the anonyname in hole if present, otherwise keeps the one in from
+//     unless it collides, in which case a new one is generated
+//   - favorites and subscriptions of from are carried over without duplications
+//   - from is hidden and left with a notice floor pointing to hole
+//
+// Both holes should have been locked for update. It returns the moved floors.
+func (hole *Hole) Merge(tx *gorm.DB, from *Hole, adminID int) (Floors, error) {
+	if hole.ID == from.ID {
+		return nil, common.BadRequest("不能合并到自身")
+	}
+
+	var floors Floors
+	err := tx.Where("hole_id = ?", from.ID).Order("ranking").Find(&floors).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(floors) == 0 {
+		return nil, common.BadRequest("被合并的帖子没有楼层")
+	}
+
+	/* reconcile anonyname mappings */
+
+	var mappings, fromMappings []AnonynameMapping
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("hole_id = ?", hole.ID).Find(&mappings).Error
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Where("hole_id = ?", from.ID).Find(&fromMappings).Error
+	if err != nil {
+		return nil, err
+	}
+
+	userNames := make(map[int]string, len(mappings))
+	usedNames := make([]string, 0, len(mappings))
+	for _, mapping := range mappings {
+		userNames[mapping.UserID] = mapping.Anonyname
+		usedNames = append(usedNames, mapping.Anonyname)
+	}
+	sort.Strings(usedNames)
+
+	for _, mapping := range fromMappings {
+		name, ok := userNames[mapping.UserID]
+		if !ok {
+			name = mapping.Anonyname
+			if _, found := slices.BinarySearch(usedNames, name); found {
+				name = utils.GenerateName(usedNames)
+			}
+			err = tx.Create(&AnonynameMapping{HoleID: hole.ID, UserID: mapping.UserID, Anonyname: name}).Error
+			if err != nil {
+				return nil, err
+			}
+			userNames[mapping.UserID] = name
+			index, _ := slices.BinarySearch(usedNames, name)
+			usedNames = slices.Insert(usedNames, index, name)
+		}
+		if name != mapping.Anonyname {
+			err = tx.Model(&Floor{}).
+				Where("hole_id = ? AND user_id = ?", from.ID, mapping.UserID).
+				Update("anonyname", name).Error
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	/* move floors */
+
+	offset := hole.Reply + 1 - floors[0].Ranking
+	err = tx.Model(&Floor{}).
+		Where("hole_id = ?", from.ID).
+		UpdateColumns(map[string]any{
+			"hole_id": hole.ID,
+			"ranking": gorm.Expr("ranking + ?", offset),
+		}).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, floor := range floors {
+		floor.HoleID = hole.ID
+		floor.Ranking += offset
+		if name, ok := userNames[floor.UserID]; ok {
+			floor.Anonyname = name
+		}
+	}
+	hole.Reply = floors[len(floors)-1].Ranking
+
+	/* carry over favorites */
+
+	var favorites UserFavorites
+	err = tx.Where("hole_id = ?", from.ID).Find(&favorites).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, favorite := range favorites {
+		var exists int64
+		err = tx.Model(&UserFavorite{}).
+			Where("user_id = ? AND favorite_group_id = ? AND hole_id = ?", favorite.UserID, favorite.FavoriteGroupID, hole.ID).
+			Count(&exists).Error
+		if err != nil {
+			return nil, err
+		}
+		if exists > 0 {
+			err = tx.Where("user_id = ? AND favorite_group_id = ? AND hole_id = ?", favorite.UserID, favorite.FavoriteGroupID, from.ID).
+				Delete(&UserFavorite{}).Error
+			if err == nil {
+				err = tx.Model(&FavoriteGroup{}).
+					Where("user_id = ? AND favorite_group_id = ?", favorite.UserID, favorite.FavoriteGroupID).
+					Update("count", gorm.Expr("count - 1")).Error
+			}
+		} else {
+			err = tx.Model(&UserFavorite{}).
+				Where("user_id = ? AND favorite_group_id = ? AND hole_id = ?", favorite.UserID, favorite.FavoriteGroupID, from.ID).
+				Update("hole_id", hole.ID).Error
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	/* carry over subscriptions */
+
+	var subscribedUserIDs []int
+	err = tx.Model(&UserSubscription{}).Where("hole_id = ?", hole.ID).Pluck("user_id", &subscribedUserIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(subscribedUserIDs) > 0 {
+		err = tx.Where("hole_id = ? AND user_id IN ?", from.ID, subscribedUserIDs).
+			Delete(&UserSubscription{}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = tx.Model(&UserSubscription{}).Where("hole_id = ?", from.ID).Update("hole_id", hole.ID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	/* update counters */
+
+	var favoriteCount, subscriptionCount int64
+	err = tx.Model(&UserFavorite{}).Where("hole_id = ?", hole.ID).Count(&favoriteCount).Error
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Model(&UserSubscription{}).Where("hole_id = ?", hole.ID).Count(&subscriptionCount).Error
+	if err != nil {
+		return nil, err
+	}
+	hole.FavoriteCount = int(favoriteCount)
+	hole.SubscriptionCount = int(subscriptionCount)
+	err = tx.Model(hole).Select("Reply", "FavoriteCount", "SubscriptionCount").Updates(hole).Error
+	if err != nil {
+		return nil, err
+	}
+
+	/* hide from with a notice */
+
+	notice := Floor{
+		HoleID:  from.ID,
+		UserID:  adminID,
+		Content: fmt.Sprintf("该帖子已被合并至 #%d", hole.ID),
+	}
+	notice.Anonyname, err = FindOrGenerateAnonyname(tx, from.ID, adminID)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Omit(clause.Associations).Create(&notice).Error
+	if err != nil {
+		return nil, err
+	}
+
+	from.Reply = 0
+	from.Hidden = true
+	from.FavoriteCount = 0
+	from.SubscriptionCount = 0
+	err = tx.Model(from).Omit("UpdatedAt").
+		Select("Reply", "Hidden", "FavoriteCount", "SubscriptionCount").
+		Updates(from).Error
+	if err != nil {
+		return nil, err
+	}
+
+	CreateAdminLog(tx, AdminLogTypeMergeHole, adminID, struct {
+		HoleID     int   `json:"hole_id"`
+		FromHoleID int   `json:"from_hole_id"`
+		FloorIDs   []int `json:"floor_ids"`
+	}{
+		HoleID:     hole.ID,
+		FromHoleID: from.ID,
+		FloorIDs:   utils.Models2IDSlice(floors),
+	})
+
+	return floors, nil
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/opentreehole/go-common"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Split moves floors of hole into newHole, it should be called in a transaction.
+//   - newHole is created with DivisionID and Tags set by the caller, owned by the author of the first moved floor
+//   - moved floors are renumbered from 0 in their original order and get anonynames of newHole
+//   - remaining floors of hole are renumbered to fill the gaps
+//   - reply_to links crossing the two holes are reset to 0
+//
+// Hole should have been locked for update. It returns the moved floors.
+func (hole *Hole) Split(tx *gorm.DB, floorIDs []int, newHole *Hole, adminID int) (Floors, error) {
+	slices.Sort(floorIDs)
+	floorIDs = slices.Compact(floorIDs)
+
+	var floors Floors
+	err := tx.Where("hole_id = ? AND id IN ?", hole.ID, floorIDs).Order("ranking").Find(&floors).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(floors) != len(floorIDs) {
+		return nil, common.BadRequest("楼层不属于该帖子")
+	}
+	if floors[0].Ranking == 0 {
+		return nil, common.BadRequest("不能拆分帖子的第一层")
+	}
+
+	/* create new hole */
+
+	newHole.UserID = floors[0].UserID
+	newHole.Reply = len(floors) - 1
+	newHole.HotScore = HoleHotScore(0, newHole.Reply, 0, 0, time.Now())
+	err = tx.Omit(clause.Associations).Create(newHole).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(newHole.Tags) > 0 {
+		err = tx.Omit("Tags.*", "UpdatedAt").Select("Tags").Save(newHole).Error
+		if err != nil {
+			return nil, err
+		}
+		err = tx.Model(&newHole.Tags).Update("temperature", gorm.Expr("temperature + 1")).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	/* move floors */
+
+	userNames := make(map[int]string)
+	for i, floor := range floors {
+		name, ok := userNames[floor.UserID]
+		if !ok {
+			name, err = FindOrGenerateAnonyname(tx, newHole.ID, floor.UserID)
+			if err != nil {
+				return nil, err
+			}
+			userNames[floor.UserID] = name
+		}
+		floor.HoleID = newHole.ID
+		floor.Ranking = i
+		floor.Anonyname = name
+		if floor.ReplyTo != 0 && !slices.Contains(floorIDs, floor.ReplyTo) {
+			floor.ReplyTo = 0
+		}
+		err = tx.Model(floor).UpdateColumns(map[string]any{
+			"hole_id":   floor.HoleID,
+			"ranking":   floor.Ranking,
+			"anonyname": floor.Anonyname,
+			"reply_to":  floor.ReplyTo,
+		}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	/* renumber remaining floors */
+
+	var remaining Floors
+	err = tx.Select("id", "ranking", "reply_to").Where("hole_id = ?", hole.ID).Order("ranking").Find(&remaining).Error
+	if err != nil {
+		return nil, err
+	}
+	// in ascending order, the new ranking is always vacant
+	for i, floor := range remaining {
+		if floor.Ranking == i {
+			continue
+		}
+		err = tx.Model(floor).UpdateColumn("ranking", i).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = tx.Model(&Floor{}).
+		Where("hole_id = ? AND reply_to IN ?", hole.ID, floorIDs).
+		UpdateColumn("reply_to", 0).Error
+	if err != nil {
+		return nil, err
+	}
+
+	hole.Reply = len(remaining) - 1
+	err = tx.Model(hole).Update("reply", hole.Reply).Error
+	if err != nil {
+		return nil, err
+	}
+
+	CreateAdminLog(tx, AdminLogTypeSplitHole, adminID, struct {
+		HoleID    int   `json:"hole_id"`
+		NewHoleID int   `json:"new_hole_id"`
+		FloorIDs  []int `json:"floor_ids"`
+	}{
+		HoleID:    hole.ID,
+		NewHoleID: newHole.ID,
+		FloorIDs:  floorIDs,
+	})
+
+	return floors, nil
+}
+
+// SendSplit notifies authors of floors moved into hole
+func (hole *Hole) SendSplit(floors Floors) error {
+	userIDs := make([]int, 0, len(floors))
+	for _, floor := range floors {
+		if !slices.Contains(userIDs, floor.UserID) {
+			userIDs = append(userIDs, floor.UserID)
+		}
+	}
+
+	message := Notification{
+		Data:          hole,
+		Recipients:    userIDs,
+		Description:   fmt.Sprintf("您的回复已被管理员移动至新帖子 #%d", hole.ID),
+		Title:         "您的内容被管理员移动了",
+		Type:          MessageTypeModify,
+		URL:           fmt.Sprintf("/api/holes/%d", hole.ID),
+		RelatedHoleID: &hole.ID,
+	}
+
+	_, err := message.Send()
+	return err
+}
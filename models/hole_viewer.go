@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// HoleViewer records users who have viewed a hole, used to count Hole.UniqueView
+type HoleViewer struct {
+	HoleID    int       `json:"hole_id" gorm:"primaryKey"`
+	UserID    int       `json:"-" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"time_created"`
+}
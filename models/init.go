@@ -153,6 +153,16 @@ func InitDB() {
 		&UserFavorite{},
 		&FavoriteGroup{},
 		&UrlHostnameBlacklist{},
+		&Poll{},
+		&PollOption{},
+		&PollVote{},
+		&FloorReaction{},
+		&HoleViewer{},
+		&SavedSearch{},
+		&SearchEvent{},
+		&NotificationOutbox{},
+		&DigestItem{},
+		&UserMute{},
 	)
 	if err != nil {
 		log.Fatal().Err(err).Send()
@@ -24,7 +24,7 @@ type Message struct {
 	RelatedHoleID  *int        `json:"related_hole_id,omitempty" gorm:"index"`
 	Recipients     []int       `json:"-" gorm:"-:all" `
 	MessageID      int         `json:"message_id" gorm:"-:all"`       // 兼容旧版 id
-	HasRead        bool        `json:"has_read" gorm:"default:false"` // 兼容旧版, 永远为false，以MessageUser的HasRead为准
+	HasRead        bool        `json:"has_read" gorm:"default:false"` // 兼容旧版, 数据库中永远为false，ListMessages 返回 MessageUser 的 HasRead
 	Users          Users       `json:"-" gorm:"many2many:message_user;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 }
 
@@ -46,6 +46,8 @@ const (
 	MessageTypeReportDealt MessageType = "report_dealt"
 	MessageTypeMail        MessageType = "mail"
 	MessageTypeSensitive   MessageType = "sensitive"
+	MessageTypeSavedSearch MessageType = "saved_search"
+	MessageTypeDigest      MessageType = "digest"
 )
 
 func (messages Messages) Preprocess(c *fiber.Ctx) error {
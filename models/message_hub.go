@@ -0,0 +1,163 @@
+package models
+
+import (
+	"context"
+	"sync"
+
+	"github.com/goccy/go-json"
+	"github.com/rs/zerolog/log"
+
+	"treehole_next/utils"
+)
+
+// messageChannel is the redis pub/sub channel to fan out new messages across replicas
+const messageChannel = "treehole:messages"
+
+// subscriberBufferSize is the number of messages a subscriber can fall behind before it is dropped
+const subscriberBufferSize = 16
+
+type messageEvent struct {
+	Recipients []int   `json:"recipients"`
+	Message    Message `json:"message"`
+}
+
+// messageHub keeps subscribers of new messages in this replica
+type messageHub struct {
+	sync.Mutex
+	subscribers map[int]map[chan *Message]bool
+	stopped     bool
+}
+
+func newMessageHub() *messageHub {
+	return &messageHub{subscribers: make(map[int]map[chan *Message]bool)}
+}
+
+var defaultMessageHub = newMessageHub()
+
+// SubscribeMessages receives new messages of the user until unsubscribe is called.
+// The channel is closed if the subscriber falls too far behind or the hub stops,
+// the subscriber should resume from the last message it received.
+func SubscribeMessages(userID int) (messages <-chan *Message, unsubscribe func()) {
+	return defaultMessageHub.subscribe(userID)
+}
+
+func (hub *messageHub) subscribe(userID int) (<-chan *Message, func()) {
+	ch := make(chan *Message, subscriberBufferSize)
+	hub.Lock()
+	if hub.stopped {
+		hub.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	if hub.subscribers[userID] == nil {
+		hub.subscribers[userID] = make(map[chan *Message]bool)
+	}
+	hub.subscribers[userID][ch] = true
+	hub.Unlock()
+
+	return ch, func() {
+		hub.Lock()
+		defer hub.Unlock()
+		hub.removeSubscriber(userID, ch)
+	}
+}
+
+// removeSubscriber closes ch if it is subscribed, hub should be locked
+func (hub *messageHub) removeSubscriber(userID int, ch chan *Message) {
+	if !hub.subscribers[userID][ch] {
+		return
+	}
+	delete(hub.subscribers[userID], ch)
+	if len(hub.subscribers[userID]) == 0 {
+		delete(hub.subscribers, userID)
+	}
+	close(ch)
+}
+
+// StopMessageHub closes all subscribers, and subscribers added later are closed at once.
+// It should be called before shutting down the server, which waits for message streams to end.
+func StopMessageHub() {
+	defaultMessageHub.stop()
+}
+
+func (hub *messageHub) stop() {
+	hub.Lock()
+	defer hub.Unlock()
+	hub.stopped = true
+	for userID, subscribers := range hub.subscribers {
+		for ch := range subscribers {
+			hub.removeSubscriber(userID, ch)
+		}
+	}
+}
+
+// dispatch delivers the event to subscribers of this replica
+func (hub *messageHub) dispatch(event *messageEvent) {
+	hub.Lock()
+	defer hub.Unlock()
+	for _, userID := range event.Recipients {
+		for ch := range hub.subscribers[userID] {
+			message := event.Message
+			select {
+			case ch <- &message:
+			default:
+				log.Warn().Int("user_id", userID).Msg("message subscriber is too slow, dropped")
+				hub.removeSubscriber(userID, ch)
+			}
+		}
+	}
+}
+
+// publishMessage delivers a saved message to subscribers of its recipients on all replicas
+func publishMessage(message *Message) {
+	event := messageEvent{Recipients: message.Recipients, Message: *message}
+	if utils.Redis == nil {
+		defaultMessageHub.dispatch(&event)
+		return
+	}
+
+	data, err := json.Marshal(event)
+	if err == nil {
+		err = utils.Redis.Publish(context.Background(), messageChannel, data).Err()
+	}
+	if err != nil {
+		log.Err(err).Int("message_id", message.ID).Msg("error publishing message, deliver in process")
+		defaultMessageHub.dispatch(&event)
+	}
+}
+
+// RunMessageHub receives messages published by all replicas through redis if in use,
+// and closes all subscribers when ctx is done
+func RunMessageHub(ctx context.Context) {
+	defer func() {
+		StopMessageHub()
+		log.Info().Msg("task RunMessageHub stopped...")
+	}()
+
+	if utils.Redis == nil {
+		<-ctx.Done()
+		return
+	}
+	pubsub := utils.Redis.Subscribe(ctx, messageChannel)
+	defer func() {
+		_ = pubsub.Close()
+	}()
+	channel := pubsub.Channel()
+	for {
+		select {
+		case payload, ok := <-channel:
+			if !ok {
+				return
+			}
+			var event messageEvent
+			err := json.Unmarshal([]byte(payload.Payload), &event)
+			if err != nil {
+				log.Err(err).Msg("error decoding published message")
+				continue
+			}
+			defaultMessageHub.dispatch(&event)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageHubStop(t *testing.T) {
+	hub := newMessageHub()
+	messages, unsubscribe := hub.subscribe(1)
+	defer unsubscribe()
+
+	hub.dispatch(&messageEvent{Recipients: []int{1, 2}, Message: Message{ID: 1}})
+	message, ok := <-messages
+	if assert.True(t, ok) {
+		assert.Equal(t, 1, message.ID)
+	}
+
+	// streams end when the hub stops, so that shutting down the server does not wait for them
+	hub.stop()
+	_, ok = <-messages
+	assert.False(t, ok)
+
+	// subscribers added later are closed at once
+	messages, _ = hub.subscribe(1)
+	_, ok = <-messages
+	assert.False(t, ok)
+}
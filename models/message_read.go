@@ -0,0 +1,82 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	"treehole_next/utils"
+)
+
+// unreadCountExpiration bounds staleness of counters not invalidated, e.g. after purging messages
+const unreadCountExpiration = time.Hour
+
+// UnreadCount is the number of unread messages of a user
+type UnreadCount struct {
+	Total int                 `json:"total"`
+	Types map[MessageType]int `json:"types"`
+}
+
+func unreadCountCacheName(userID int) string {
+	return fmt.Sprintf("unread_count_%d", userID)
+}
+
+// GetUnreadCount counts unread messages of the user by type, backed by the cache
+func GetUnreadCount(tx *gorm.DB, userID int) (*UnreadCount, error) {
+	var count UnreadCount
+	if utils.GetCache(unreadCountCacheName(userID), &count) {
+		return &count, nil
+	}
+
+	var rows []struct {
+		Type  MessageType
+		Count int
+	}
+	err := tx.Table("message_user").
+		Joins("JOIN message ON message.id = message_user.message_id").
+		Where("message_user.user_id = ? AND message_user.has_read = false", userID).
+		Select("message.type AS type, COUNT(*) AS count").Group("message.type").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	count = UnreadCount{Types: make(map[MessageType]int, len(rows))}
+	for _, row := range rows {
+		count.Types[row.Type] = row.Count
+		count.Total += row.Count
+	}
+	err = utils.SetCache(unreadCountCacheName(userID), count, unreadCountExpiration)
+	if err != nil {
+		log.Err(err).Int("user_id", userID).Msg("error caching unread count")
+	}
+	return &count, nil
+}
+
+// InvalidateUnreadCount drops cached unread counters of the users, should be called after messages are added,
+// deleted or marked
+func InvalidateUnreadCount(userIDs ...int) {
+	for _, userID := range userIDs {
+		err := utils.DeleteCache(unreadCountCacheName(userID))
+		if err != nil {
+			log.Err(err).Int("user_id", userID).Msg("error deleting unread count cache")
+		}
+	}
+}
+
+// MarkMessages sets the read state of messages of the user, of all types if messageType is empty.
+// Returns the number of messages changed.
+func MarkMessages(tx *gorm.DB, userID int, messageType MessageType, hasRead bool) (int64, error) {
+	querySet := tx.Model(&MessageUser{}).Where("user_id = ? AND has_read = ?", userID, !hasRead)
+	if messageType != "" {
+		querySet = querySet.Where("message_id IN (?)", tx.Model(&Message{}).Select("id").Where("type = ?", messageType))
+	}
+	result := querySet.Update("has_read", hasRead)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	InvalidateUnreadCount(userID)
+	return result.RowsAffected, nil
+}
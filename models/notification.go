@@ -3,7 +3,6 @@ package models
 import (
 	"bytes"
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"math/rand"
@@ -19,6 +18,7 @@ import (
 	"treehole_next/utils"
 
 	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 
 	"github.com/goccy/go-json"
@@ -105,17 +105,19 @@ func (messages Notifications) Send() error {
 	return nil
 }
 
-// check user.config.Notify contain message.Type
-func (message *Notification) checkConfig() {
+// check user.config.Notify contain message.Type and user.config.NotifyOff not,
+// recipients receiving the type in digests are returned with their digest periods, they are not pushed to
+func (message *Notification) checkConfig() (digests map[int]DigestPeriod) {
 	// generate new recipients
 	var newRecipient []int
+	digests = make(map[int]DigestPeriod)
 
 	// find users
 	var users []User
 	result := DB.Find(&users, "id in ?", message.Recipients)
 	if result.Error != nil {
 		message.Recipients = newRecipient
-		return
+		return digests
 	}
 
 	// filter recipients
@@ -123,18 +125,33 @@ func (message *Notification) checkConfig() {
 		if slices.Contains(defaultUserConfig.Notify, string(message.Type)) && !slices.Contains(user.Config.Notify, string(message.Type)) {
 			continue
 		}
+		if slices.Contains(user.Config.NotifyOff, string(message.Type)) {
+			continue
+		}
+		if period := user.Config.DigestPeriodOf(message.Type); period != DigestImmediate {
+			digests[user.ID] = period
+		}
 		newRecipient = append(newRecipient, user.ID)
 	}
 	message.Recipients = newRecipient
+	return digests
 }
 
+// Send saves the message and, if config.Config.NotificationUrl is set, an outbox entry in the same transaction.
+// The push is delivered by DeliverNotifications in background, so the notification service being down
+// does not fail the caller. Recipients receiving the type in digests have the message listed but not pushed.
 func (message Notification) Send() (Message, error) {
 	// only for test
 	// message["recipients"] = []int{1}
 
-	var err error
-
-	message.checkConfig()
+	digests := message.checkConfig()
+	if len(digests) > 0 {
+		err := message.queueDigest(DB, digests)
+		if err != nil {
+			log.Err(err).Str("model", "Notification").Msg("digest queue failed: " + err.Error())
+			return Message{}, err
+		}
+	}
 	// return if no recipient
 	if len(message.Recipients) == 0 {
 		return Message{}, nil
@@ -151,24 +168,53 @@ func (message Notification) Send() (Message, error) {
 		RelatedFloorID: message.RelatedFloorID,
 		RelatedHoleID:  message.RelatedHoleID,
 	}
-	err = DB.Omit(clause.Associations).Create(&body).Error
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Omit(clause.Associations).Create(&body).Error
+		if err != nil {
+			return err
+		}
+		if config.Config.NotificationUrl == "" {
+			return nil
+		}
+
+		// users receiving digests are pushed to by SendDueDigests
+		message.Recipients = slices.DeleteFunc(slices.Clone(message.Recipients), func(userID int) bool {
+			_, ok := digests[userID]
+			return ok
+		})
+		if len(message.Recipients) == 0 {
+			return nil
+		}
+
+		message.Title = utils.StripContent(message.Title, 32)                                         //varchar(32)
+		message.Description = utils.StripContent(cleanNotificationDescription(message.Description), 64) //varchar(64)
+		body.Title = message.Title
+		body.Description = message.Description
+		return tx.Create(&NotificationOutbox{
+			MessageID:     body.ID,
+			Payload:       message,
+			Status:        OutboxStatusPending,
+			NextAttemptAt: time.Now(),
+		}).Error
+	})
 	if err != nil {
 		log.Err(err).Str("model", "Notification").Msg("message save failed: " + err.Error())
 		return Message{}, err
 	}
-	if config.Config.NotificationUrl == "" {
-		return Message{}, nil
+	InvalidateUnreadCount(body.Recipients...)
+	publishMessage(&body)
+	if config.Config.NotificationUrl != "" {
+		wakeOutbox()
 	}
-	message.Title = utils.StripContent(message.Title, 32)             //varchar(32)
-	message.Description = utils.StripContent(cleanNotificationDescription(message.Description), 64) //varchar(64)
-	body.Title = message.Title
-	body.Description = message.Description
+	return body, nil
+}
 
+// push posts the notification to the notification service once
+func (message *Notification) push() error {
 	// construct form
 	form, err := json.Marshal(message)
 	if err != nil {
-		log.Err(err).Str("model", "Notification").Msg("error encoding notification")
-		return Message{}, err
+		return fmt.Errorf("error encoding notification: %w", err)
 	}
 
 	// construct http request
@@ -178,31 +224,28 @@ func (message Notification) Send() (Message, error) {
 		bytes.NewBuffer(form),
 	)
 	if err != nil {
-		log.Err(err).Str("model", "Notification").Msg("error making request")
-		return Message{}, err
+		return fmt.Errorf("error making request: %w", err)
 	}
 	req.Header.Add("Content-Type", "application/json")
 
 	// bench and simulation
 	if config.Config.Mode == "bench" {
 		time.Sleep(time.Millisecond)
-		return Message{}, nil
+		return nil
 	}
 
 	// get response
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Err(err).Str("model", "Notification").Msg("error sending notification")
-		return Message{}, err
+		return fmt.Errorf("error sending notification: %w", err)
 	}
 
 	response := readRespNotification(resp.Body)
 	if resp.StatusCode != 201 {
 		log.Error().Str("model", "Notification").Any("response", response).Msg("notification response failed")
-		return Message{}, errors.New(fmt.Sprint(response))
+		return fmt.Errorf("notification response %d: %v", resp.StatusCode, response)
 	}
-
-	return body, nil
+	return nil
 }
 
 var adminList struct {
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"treehole_next/config"
+	"treehole_next/utils"
+)
+
+type OutboxStatus string
+
+const (
+	OutboxStatusPending OutboxStatus = "pending"
+	// OutboxStatusDead entries failed config.Config.NotificationMaxAttempts times and are not retried until replayed
+	OutboxStatusDead OutboxStatus = "dead"
+)
+
+// NotificationOutbox is a push of a Message to the notification service, deleted once delivered
+type NotificationOutbox struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"time_created"`
+	UpdatedAt time.Time `json:"time_updated"`
+
+	MessageID int `json:"message_id" gorm:"not null;index"`
+
+	// the body posted to the notification service, longtext in mysql as Data may be a whole floor or hole
+	Payload Notification `json:"payload" gorm:"serializer:json"`
+
+	Status OutboxStatus `json:"status" gorm:"size:16;not null;index:idx_outbox_status_next,priority:1"`
+
+	// number of failed deliveries
+	Attempts int `json:"attempts" gorm:"not null;default:0"`
+
+	// the entry is delivered no earlier than the time
+	NextAttemptAt time.Time `json:"time_next_attempt" gorm:"not null;index:idx_outbox_status_next,priority:2"`
+
+	LastError string `json:"last_error" gorm:"size:256;not null;default:''"`
+}
+
+type NotificationOutboxes []*NotificationOutbox
+
+// outboxBatchSize is the max number of entries delivered in a run of DeliverNotifications
+const outboxBatchSize = 100
+
+// outboxLease is how long a claimed entry is hidden from other workers, should be longer than the http timeout
+const outboxLease = time.Minute
+
+var outboxWakeup = make(chan struct{}, 1)
+
+// wakeOutbox lets the delivering task run without waiting for the next tick
+func wakeOutbox() {
+	select {
+	case outboxWakeup <- struct{}{}:
+	default:
+	}
+}
+
+// OutboxWakeup is notified when new entries are added to the outbox
+func OutboxWakeup() <-chan struct{} {
+	return outboxWakeup
+}
+
+// outboxBackoff is the delay before the next delivery after attempts failures
+func outboxBackoff(attempts int) time.Duration {
+	delay := time.Second * time.Duration(config.Config.NotificationRetrySeconds)
+	for i := 1; i < attempts && delay < time.Hour*6; i++ {
+		delay *= 2
+	}
+	return min(delay, time.Hour*6)
+}
+
+// DeliverNotifications pushes due pending entries of the outbox, returns the number delivered.
+// Entries are claimed by moving NextAttemptAt forward, so that multiple instances do not push the same entry.
+func DeliverNotifications() (int, error) {
+	if config.Config.NotificationUrl == "" {
+		return 0, nil
+	}
+	var entries NotificationOutboxes
+	err := DB.Clauses(dbresolver.Write).Where("status = ? AND next_attempt_at <= ?", OutboxStatusPending, time.Now()).
+		Order("next_attempt_at, id").Limit(outboxBatchSize).Find(&entries).Error
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, entry := range entries {
+		now := time.Now()
+		result := DB.Model(&NotificationOutbox{}).
+			Where("id = ? AND status = ? AND next_attempt_at <= ?", entry.ID, OutboxStatusPending, now).
+			Update("next_attempt_at", now.Add(outboxLease))
+		if result.Error != nil {
+			return delivered, result.Error
+		}
+		if result.RowsAffected == 0 {
+			// claimed by another instance
+			continue
+		}
+
+		if entry.deliver() {
+			delivered++
+		}
+	}
+	return delivered, nil
+}
+
+// deliver pushes the entry once, it is deleted if delivered, otherwise retried later or dead-lettered
+func (entry *NotificationOutbox) deliver() bool {
+	err := entry.Payload.push()
+	if err == nil {
+		err = DB.Delete(entry).Error
+		if err != nil {
+			log.Err(err).Int("outbox_id", entry.ID).Msg("error deleting delivered outbox entry")
+		}
+		return true
+	}
+
+	entry.Attempts++
+	entry.LastError = utils.StripContent(err.Error(), 256)
+	entry.NextAttemptAt = time.Now().Add(outboxBackoff(entry.Attempts))
+	if entry.Attempts >= config.Config.NotificationMaxAttempts {
+		entry.Status = OutboxStatusDead
+		log.Error().Err(err).Int("outbox_id", entry.ID).Int("message_id", entry.MessageID).Msg("notification dead-lettered")
+	} else {
+		log.Warn().Err(err).Int("outbox_id", entry.ID).Int("attempts", entry.Attempts).Msg("error delivering notification")
+	}
+	err = DB.Model(entry).Select("Attempts", "LastError", "NextAttemptAt", "Status").Updates(entry).Error
+	if err != nil {
+		log.Err(err).Int("outbox_id", entry.ID).Msg("error updating outbox entry")
+	}
+	return false
+}
+
+// ReplayNotifications moves dead entries back to pending and delivers them soon, all dead entries if ids is empty.
+// Returns the number of entries replayed.
+func ReplayNotifications(tx *gorm.DB, ids []int) (int64, error) {
+	querySet := tx.Model(&NotificationOutbox{}).Where("status = ?", OutboxStatusDead)
+	if len(ids) > 0 {
+		querySet = querySet.Where("id IN ?", ids)
+	}
+	result := querySet.Updates(map[string]any{
+		"status":          OutboxStatusPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+	})
+	if result.RowsAffected > 0 {
+		wakeOutbox()
+	}
+	return result.RowsAffected, result.Error
+}
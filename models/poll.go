@@ -0,0 +1,233 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opentreehole/go-common"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+
+	"treehole_next/utils"
+)
+
+const (
+	PollTypeSingle   = "single"
+	PollTypeMultiple = "multiple"
+)
+
+// Poll is attached to a hole by its creator, a hole has at most one poll
+type Poll struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"time_created"`
+	UpdatedAt time.Time `json:"time_updated"`
+
+	HoleID int `json:"hole_id" gorm:"not null;uniqueIndex"`
+
+	// single or multiple
+	Type string `json:"type" gorm:"not null;size:16;default:single"`
+
+	// votes are not accepted after deadline, null means no deadline
+	Deadline *time.Time `json:"deadline"`
+
+	// whether users can see the result before voting
+	ShowResultBeforeVote bool `json:"show_result_before_vote" gorm:"not null;default:false"`
+
+	// closed by admin
+	Closed bool `json:"closed" gorm:"not null;default:false"`
+
+	// number of users who have voted
+	VoterCount int `json:"voter_count" gorm:"not null;default:0"`
+
+	Options PollOptions `json:"options" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+
+	/// generated field
+
+	// whether the current user has voted
+	Voted bool `json:"voted" gorm:"-:all"`
+
+	// whether vote counts are returned, if not, voter_count and vote_count are 0
+	ResultVisible bool `json:"result_visible" gorm:"-:all"`
+}
+
+type Polls []*Poll
+
+type PollOption struct {
+	ID      int    `json:"id" gorm:"primaryKey"`
+	PollID  int    `json:"-" gorm:"not null;index"`
+	Ranking int    `json:"ranking" gorm:"not null;default:0"`
+	Content string `json:"content" gorm:"not null;size:64"`
+
+	VoteCount int `json:"vote_count" gorm:"not null;default:0"`
+
+	/// generated field
+
+	// whether the current user has chosen this option
+	Voted bool `json:"voted" gorm:"-:all"`
+}
+
+type PollOptions []*PollOption
+
+// PollVote records which options a user has chosen, users' choices are never exposed
+type PollVote struct {
+	PollID    int       `json:"poll_id" gorm:"primaryKey"`
+	UserID    int       `json:"-" gorm:"primaryKey"`
+	OptionID  int       `json:"option_id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"time_created"`
+}
+
+func (poll *Poll) GetID() int {
+	return poll.ID
+}
+
+// IsOpen returns whether the poll accepts votes
+func (poll *Poll) IsOpen() bool {
+	return !poll.Closed && (poll.Deadline == nil || poll.Deadline.After(time.Now()))
+}
+
+func (poll *Poll) Preprocess(c *fiber.Ctx) error {
+	return Polls{poll}.Preprocess(c)
+}
+
+// Preprocess sets Voted and hides the result if the current user is not allowed to see it
+func (polls Polls) Preprocess(c *fiber.Ctx) error {
+	if len(polls) == 0 {
+		return nil
+	}
+	user, err := GetCurrLoginUser(c)
+	if err != nil {
+		return err
+	}
+
+	var votes []PollVote
+	err = DB.Clauses(dbresolver.Write).
+		Where("poll_id in ? and user_id = ?", utils.Models2IDSlice(polls), user.ID).
+		Find(&votes).Error
+	if err != nil {
+		return err
+	}
+
+	for _, poll := range polls {
+		slices.SortFunc(poll.Options, func(a, b *PollOption) int {
+			return a.Ranking - b.Ranking
+		})
+		for _, option := range poll.Options {
+			option.Voted = slices.ContainsFunc(votes, func(vote PollVote) bool {
+				return vote.PollID == poll.ID && vote.OptionID == option.ID
+			})
+			poll.Voted = poll.Voted || option.Voted
+		}
+
+		poll.ResultVisible = user.IsAdmin || poll.Voted || poll.ShowResultBeforeVote || !poll.IsOpen()
+		if !poll.ResultVisible {
+			poll.VoterCount = 0
+			for _, option := range poll.Options {
+				option.VoteCount = 0
+			}
+		}
+	}
+	return nil
+}
+
+// loadPolls loads polls of holes and preprocesses them for the current user
+func (holes Holes) loadPolls(c *fiber.Ctx) error {
+	if len(holes) == 0 {
+		return nil
+	}
+
+	var polls Polls
+	err := DB.Preload("Options").
+		Where("hole_id in ?", utils.Models2IDSlice(holes)).
+		Find(&polls).Error
+	if err != nil {
+		return err
+	}
+
+	err = polls.Preprocess(c)
+	if err != nil {
+		return err
+	}
+
+	for _, hole := range holes {
+		hole.Poll = nil
+		for _, poll := range polls {
+			if poll.HoleID == hole.ID {
+				hole.Poll = poll
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// Vote records the choices of a user, a user can vote only once
+func (poll *Poll) Vote(tx *gorm.DB, userID int, optionIDs []int) error {
+	// lock for update
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Options").Take(poll).Error
+	if err != nil {
+		return err
+	}
+
+	if !poll.IsOpen() {
+		return common.Forbidden("投票已结束")
+	}
+
+	slices.Sort(optionIDs)
+	optionIDs = slices.Compact(optionIDs)
+	if poll.Type == PollTypeSingle && len(optionIDs) != 1 {
+		return common.BadRequest("单选投票只能选择一个选项")
+	}
+	for _, optionID := range optionIDs {
+		if !slices.ContainsFunc(poll.Options, func(option *PollOption) bool {
+			return option.ID == optionID
+		}) {
+			return common.BadRequest("选项不存在")
+		}
+	}
+
+	var voted int64
+	err = tx.Model(&PollVote{}).Where("poll_id = ? and user_id = ?", poll.ID, userID).Count(&voted).Error
+	if err != nil {
+		return err
+	}
+	if voted > 0 {
+		return common.BadRequest("您已经投过票了")
+	}
+
+	votes := make([]PollVote, 0, len(optionIDs))
+	for _, optionID := range optionIDs {
+		votes = append(votes, PollVote{PollID: poll.ID, UserID: userID, OptionID: optionID})
+	}
+	err = tx.Create(&votes).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&PollOption{}).Where("id in ?", optionIDs).
+		Update("vote_count", gorm.Expr("vote_count + 1")).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(poll).Update("voter_count", gorm.Expr("voter_count + 1")).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Preload("Options").Take(poll).Error
+}
+
+// Delete removes the poll with its options and votes
+func (poll *Poll) Delete(tx *gorm.DB) error {
+	err := tx.Where("poll_id = ?", poll.ID).Delete(&PollVote{}).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Where("poll_id = ?", poll.ID).Delete(&PollOption{}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Delete(poll).Error
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/opentreehole/go-common"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"treehole_next/config"
+)
+
+// SavedSearch is a search query saved by a user, new floors matching it are notified periodically
+type SavedSearch struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"time_created"`
+	UpdatedAt time.Time `json:"time_updated"`
+
+	UserID int `json:"-" gorm:"not null;index"`
+
+	// search syntax of /floors/search
+	Query string `json:"query" gorm:"not null;size:256"`
+
+	// only floors with larger IDs are matched in the next run
+	LastFloorID int `json:"-" gorm:"not null;default:0;index"`
+
+	// when the query last ran, null if never
+	LastRunAt *time.Time `json:"time_last_run"`
+
+	// number of new floors found by the last run
+	LastMatchCount int `json:"last_match_count" gorm:"not null;default:0"`
+}
+
+type SavedSearches []*SavedSearch
+
+// MaxFloorID returns the ID of the latest floor, or 0 if there is none
+func MaxFloorID(tx *gorm.DB) (int, error) {
+	var floorID int
+	err := tx.Model(&Floor{}).Select("COALESCE(MAX(id), 0)").Scan(&floorID).Error
+	return floorID, err
+}
+
+// AddUserSavedSearch saves query for the user, at most config.Config.SavedSearchLimit queries per user.
+// Floors existing now are not matched.
+func AddUserSavedSearch(tx *gorm.DB, userID int, query string) (*SavedSearch, error) {
+	savedSearch := SavedSearch{UserID: userID, Query: query}
+	err := tx.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&SavedSearch{}).Where("user_id = ?", userID).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count >= int64(config.Config.SavedSearchLimit) {
+			return common.Forbidden(fmt.Sprintf("最多保存 %d 条搜索", config.Config.SavedSearchLimit))
+		}
+
+		savedSearch.LastFloorID, err = MaxFloorID(tx)
+		if err != nil {
+			return err
+		}
+		return tx.Create(&savedSearch).Error
+	})
+	return &savedSearch, err
+}
+
+// SendNewMatches notifies the owner of new floors matching the saved search, floors should not be empty
+func (savedSearch *SavedSearch) SendNewMatches(floors Floors, count int) Notification {
+	description := floors[0].Content
+	if count > 1 {
+		description = fmt.Sprintf("共 %d 条新内容：%s", count, description)
+	}
+	return Notification{
+		Data:           savedSearch,
+		Recipients:     []int{savedSearch.UserID},
+		Description:    description,
+		Title:          fmt.Sprintf("您保存的搜索「%s」有新内容", savedSearch.Query),
+		Type:           MessageTypeSavedSearch,
+		URL:            fmt.Sprintf("/api/floors/%d", floors[0].ID),
+		RelatedFloorID: &floors[0].ID,
+		RelatedHoleID:  &floors[0].HoleID,
+	}
+}
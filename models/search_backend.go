@@ -0,0 +1,176 @@
+package models
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+
+	"treehole_next/config"
+)
+
+// SearchBackend stores documents of floors and finds floors by keyword
+type SearchBackend interface {
+	// Index inserts or replaces a document
+	Index(floor FloorModel) error
+	// Delete removes a document, documents not found are ignored
+	Delete(floorID int) error
+	BulkIndex(floors []FloorModel) error
+	BulkDelete(floorIDs []int) error
+	Search(ctx context.Context, request SearchRequest) ([]SearchHit, error)
+	// SearchHoles groups matched floors by hole, Size and Offset of request apply to holes
+	SearchHoles(ctx context.Context, request SearchRequest, floorsPerHole int) ([]HoleSearchHit, error)
+	// SimilarHoles finds IDs of holes whose first floors are similar to the content, holes sharing more tags rank higher
+	SimilarHoles(ctx context.Context, request SimilarRequest) ([]int, error)
+}
+
+// SearchRequest is the query of SearchBackend.Search, documents of hidden holes or sensitive floors are excluded
+type SearchRequest struct {
+	// Keyword is optional if Phrases is not empty
+	Keyword  string
+	Size     int
+	Offset   int
+	Accurate bool
+	// Phrases should appear as a whole and Excludes should not
+	Phrases  []string
+	Excludes []string
+	// Unix timestamps, optional
+	StartTime *int64
+	EndTime   *int64
+	// MinLikes and MaxLikes are inclusive and optional
+	MinLikes *int
+	MaxLikes *int
+	Filter   SearchFilter
+	// AfterFloorID keeps floors with larger IDs only and MaxFloorID keeps floors with IDs not larger,
+	// used to search new floors incrementally, 0 means no limit
+	AfterFloorID int
+	MaxFloorID   int
+}
+
+// SimilarRequest is the query of SearchBackend.SimilarHoles, hidden holes and sensitive floors are excluded
+type SimilarRequest struct {
+	Content string
+	TagIDs  []int
+	// ExcludeHoleID is the hole itself when finding holes related to it, 0 means not set
+	ExcludeHoleID int
+	Size          int
+}
+
+// SearchHit is a matched floor, HighlightedContent is empty if not highlighted
+type SearchHit struct {
+	FloorID            int
+	HighlightedContent string
+}
+
+// HoleSearchHit is a hole with the number of its matched floors and the best floors of them
+type HoleSearchHit struct {
+	HoleID int
+	Count  int
+	Floors []SearchHit
+}
+
+// Searcher is the search backend in use, nil means searching the database by SearchOld
+var Searcher SearchBackend
+
+// InitSearch chooses the search backend by config.Config.SearchBackend, should be called after Init and InitDB.
+// The local backend is per instance, so it is used by default in dev and test mode only.
+func InitSearch() {
+	switch config.Config.SearchBackend {
+	case "database":
+		Searcher = nil
+	case "local":
+		Searcher = newLocalBackend()
+	default:
+		if ES != nil {
+			Searcher = elasticBackend{}
+		} else if config.Config.Mode == "dev" || config.Config.Mode == "test" {
+			Searcher = newLocalBackend()
+		} else {
+			Searcher = nil
+		}
+	}
+}
+
+// SearchBackendName is the name of the search backend in use, same as config.Config.SearchBackend
+func SearchBackendName() string {
+	switch Searcher.(type) {
+	case elasticBackend:
+		return "elasticsearch"
+	case *localBackend:
+		return "local"
+	default:
+		return "database"
+	}
+}
+
+// goSearch sends writes to remote backends in background, the embedded backend is fast enough to write in place
+func goSearch(f func()) {
+	if _, ok := Searcher.(*localBackend); ok {
+		f()
+		return
+	}
+	go f()
+}
+
+// BulkInsert inserts or replaces documents in background
+func BulkInsert(floors []FloorModel) {
+	if Searcher == nil || len(floors) == 0 {
+		return
+	}
+	goSearch(func() {
+		floorIDs := make([]int, len(floors))
+		for i, floorModel := range floors {
+			floorIDs[i] = floorModel.ID
+		}
+		err := Searcher.BulkIndex(floors)
+		if err != nil {
+			log.Err(err).Ints("floor_ids", floorIDs).Msg("error indexing floors")
+			return
+		}
+		log.Info().Ints("floor_ids", floorIDs).Msg("index floors success")
+	})
+}
+
+// BulkDelete deletes documents in background, used when a hole becomes hidden and delete all of its floors
+func BulkDelete(floorIDs []int) {
+	if Searcher == nil || len(floorIDs) == 0 {
+		return
+	}
+	goSearch(func() {
+		err := Searcher.BulkDelete(floorIDs)
+		if err != nil {
+			log.Err(err).Ints("floor_ids", floorIDs).Msg("error deleting floors")
+			return
+		}
+		log.Info().Ints("floor_ids", floorIDs).Msg("delete floors success")
+	})
+}
+
+// FloorIndex inserts or replaces a document in background, used when a floor is created or restored
+func FloorIndex(floorModel FloorModel) {
+	if Searcher == nil {
+		return
+	}
+	goSearch(func() {
+		err := Searcher.Index(floorModel)
+		if err != nil {
+			log.Err(err).Int("floor_id", floorModel.ID).Msg("error index floor")
+			return
+		}
+		log.Info().Int("floor_id", floorModel.ID).Msg("index floor success")
+	})
+}
+
+// FloorDelete deletes a document in background, used when a floor is deleted
+func FloorDelete(floorID int) {
+	if Searcher == nil {
+		return
+	}
+	goSearch(func() {
+		err := Searcher.Delete(floorID)
+		if err != nil {
+			log.Err(err).Int("floor_id", floorID).Msg("error delete floor")
+			return
+		}
+		log.Info().Int("floor_id", floorID).Msg("delete floor success")
+	})
+}
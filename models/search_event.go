@@ -0,0 +1,126 @@
+package models
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SearchEvent is an anonymized record of a search, no user is recorded
+type SearchEvent struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"time_created" gorm:"not null;index"`
+
+	// normalized by search.NormalizeQuery
+	Query string `json:"query" gorm:"not null;size:256"`
+
+	// names of filters in use separated by commas, e.g. "division,tag,time"
+	Filters string `json:"filters" gorm:"not null;size:64"`
+
+	// number of floors returned
+	ResultCount int `json:"result_count" gorm:"not null"`
+
+	// in microseconds
+	Latency int64 `json:"latency" gorm:"not null"`
+
+	// elasticsearch, local or database
+	Backend string `json:"backend" gorm:"not null;size:16"`
+}
+
+// NewSearchEvent records a search by request, request is nil if the query has no syntax
+func NewSearchEvent(query string, request *SearchRequest, resultCount int, latency time.Duration) SearchEvent {
+	var filters []string
+	if request != nil {
+		if request.Filter.HoleID != 0 {
+			filters = append(filters, "hole")
+		}
+		if request.Filter.DivisionID != 0 {
+			filters = append(filters, "division")
+		}
+		if len(request.Filter.TagIDs) > 0 {
+			filters = append(filters, "tag")
+		}
+		if request.StartTime != nil || request.EndTime != nil {
+			filters = append(filters, "time")
+		}
+		if request.MinLikes != nil || request.MaxLikes != nil {
+			filters = append(filters, "likes")
+		}
+		if len(request.Phrases) > 0 {
+			filters = append(filters, "phrase")
+		}
+		if len(request.Excludes) > 0 {
+			filters = append(filters, "exclude")
+		}
+	}
+	return SearchEvent{
+		CreatedAt:   time.Now(),
+		Query:       query,
+		Filters:     strings.Join(filters, ","),
+		ResultCount: resultCount,
+		Latency:     latency.Microseconds(),
+		Backend:     SearchBackendName(),
+	}
+}
+
+// SearchQueryStat is a query with the number of times searched since a time
+type SearchQueryStat struct {
+	Query              string  `json:"query"`
+	Count              int     `json:"count"`
+	AverageResultCount float64 `json:"average_result_count"`
+}
+
+// TopSearchQueries returns the most searched queries since the time, only queries with no results if zeroResult
+func TopSearchQueries(tx *gorm.DB, since time.Time, zeroResult bool, size int) ([]SearchQueryStat, error) {
+	stats := make([]SearchQueryStat, 0, size)
+	querySet := tx.Model(&SearchEvent{}).Where("created_at >= ?", since)
+	if zeroResult {
+		querySet = querySet.Where("result_count = 0")
+	}
+	err := querySet.
+		Select("query, COUNT(*) AS count, AVG(result_count) AS average_result_count").
+		Group("query").Order("count DESC, query").Limit(size).
+		Scan(&stats).Error
+	return stats, err
+}
+
+// SearchLatencyStat is the latency percentiles of a search backend in milliseconds
+type SearchLatencyStat struct {
+	Backend string  `json:"backend"`
+	Count   int     `json:"count"`
+	P50     float64 `json:"p50"`
+	P90     float64 `json:"p90"`
+	P99     float64 `json:"p99"`
+	Max     float64 `json:"max"`
+}
+
+// SearchLatencyStats returns latency percentiles of each backend since the time, by the nearest-rank method
+func SearchLatencyStats(tx *gorm.DB, since time.Time) ([]SearchLatencyStat, error) {
+	stats := make([]SearchLatencyStat, 0)
+	err := tx.Model(&SearchEvent{}).Where("created_at >= ?", since).
+		Select("backend, COUNT(*) AS count").Group("backend").Order("backend").
+		Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range stats {
+		stat := &stats[i]
+		for _, percentile := range []struct {
+			value *float64
+			ratio float64
+		}{{&stat.P50, 0.5}, {&stat.P90, 0.9}, {&stat.P99, 0.99}, {&stat.Max, 1}} {
+			rank := max(int(math.Ceil(float64(stat.Count)*percentile.ratio))-1, 0)
+			var latency int64
+			err = tx.Model(&SearchEvent{}).Where("created_at >= ? AND backend = ?", since, stat.Backend).
+				Select("latency").Order("latency").Offset(rank).Limit(1).Scan(&latency).Error
+			if err != nil {
+				return nil, err
+			}
+			*percentile.value = float64(latency) / 1000
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	stdjson "encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+
+	"treehole_next/utils"
+)
+
+// HoleSearchResult is a hole matched by searching, with the number of its matched floors and the best of them
+type HoleSearchResult struct {
+	*Hole
+	MatchCount    int
+	MatchedFloors HighlightedFloors
+}
+
+func (result HoleSearchResult) MarshalJSON() ([]byte, error) {
+	// workaround: use stdjson to avoid go-json panicking upon flattening structs with recursive fields
+	return stdjson.Marshal(&struct {
+		*Hole
+		MatchCount    int               `json:"match_count"`
+		MatchedFloors HighlightedFloors `json:"matched_floors"`
+	}{
+		Hole:          result.Hole,
+		MatchCount:    result.MatchCount,
+		MatchedFloors: result.MatchedFloors,
+	})
+}
+
+type HoleSearchResults []*HoleSearchResult
+
+func (results HoleSearchResults) Preprocess(_ *fiber.Ctx) error {
+	// no-op intended (preprocessing done for Holes and Floors in SearchByHole)
+	return nil
+}
+
+// SearchByHole searches floors and groups them by hole, Size and Offset of request apply to holes.
+// Each hole keeps at most floorsPerHole matched floors, best first.
+func SearchByHole(c *fiber.Ctx, request SearchRequest, floorsPerHole int) (HoleSearchResults, error) {
+	var hits []HoleSearchHit
+	var err error
+	if Searcher != nil {
+		hits, err = Searcher.SearchHoles(c.Context(), request, floorsPerHole)
+	} else {
+		hits, err = searchHolesOld(request, floorsPerHole)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(hits) == 0 {
+		return HoleSearchResults{}, nil
+	}
+
+	// get holes
+	holeIDs := make([]int, len(hits))
+	floorHits := make([]SearchHit, 0, len(hits)*floorsPerHole)
+	for i, hit := range hits {
+		holeIDs[i] = hit.HoleID
+		floorHits = append(floorHits, hit.Floors...)
+	}
+	holes := make(Holes, 0, len(hits))
+	err = DB.Where("hidden = false").Find(&holes, holeIDs).Error
+	if err != nil {
+		log.Err(err).Msgf("error finding holes by IDs: %v", holeIDs)
+		return nil, err
+	}
+	holes = utils.OrderInGivenOrder(holes, holeIDs)
+	err = holes.Preprocess(c)
+	if err != nil {
+		log.Err(err).Msg("error preprocessing holes")
+		return nil, err
+	}
+
+	// get floors
+	floors, err := loadHighlightedFloors(c, floorHits)
+	if err != nil {
+		return nil, err
+	}
+	floorMap := make(map[int]*HighlightedFloor, len(floors))
+	for _, floor := range floors {
+		floorMap[floor.ID] = floor
+	}
+
+	hitMap := make(map[int]HoleSearchHit, len(hits))
+	for _, hit := range hits {
+		hitMap[hit.HoleID] = hit
+	}
+	results := make(HoleSearchResults, len(holes))
+	for i, hole := range holes {
+		hit := hitMap[hole.ID]
+		matchedFloors := make(HighlightedFloors, 0, len(hit.Floors))
+		for _, floorHit := range hit.Floors {
+			if floor, ok := floorMap[floorHit.FloorID]; ok {
+				matchedFloors = append(matchedFloors, floor)
+			}
+		}
+		results[i] = &HoleSearchResult{
+			Hole:          hole,
+			MatchCount:    hit.Count,
+			MatchedFloors: matchedFloors,
+		}
+	}
+	return results, nil
+}
+
+// searchHolesOld groups floors found by keywords in the database, holes are ordered by their latest matched floors
+func searchHolesOld(request SearchRequest, floorsPerHole int) ([]HoleSearchHit, error) {
+	var holeCounts []struct {
+		HoleID int
+		Count  int
+	}
+	querySet, keywords := searchOldScope(DB.Model(&Floor{}), request)
+	err := querySet.
+		Select("hole_id, count(*) AS count").
+		Group("hole_id").
+		Order("max(id) desc").
+		Offset(request.Offset).Limit(request.Size).
+		Scan(&holeCounts).Error
+	if err != nil {
+		log.Err(err).Msgf("error grouping floors by keywords %v", keywords)
+		return nil, err
+	}
+	if len(holeCounts) == 0 {
+		return nil, nil
+	}
+
+	holeIDs := make([]int, len(holeCounts))
+	for i, holeCount := range holeCounts {
+		holeIDs[i] = holeCount.HoleID
+	}
+	var floors Floors
+	querySet, _ = searchOldScope(DB.Where("hole_id IN ?", holeIDs), request)
+	err = querySet.Order("id desc").Find(&floors).Error
+	if err != nil {
+		log.Err(err).Msgf("error finding floors by keywords %v", keywords)
+		return nil, err
+	}
+
+	pattern := highlightPattern(keywords)
+	holeFloors := make(map[int][]SearchHit, len(holeIDs))
+	for _, floor := range floors {
+		if len(holeFloors[floor.HoleID]) >= floorsPerHole {
+			continue
+		}
+		hit := SearchHit{FloorID: floor.ID}
+		if pattern != nil {
+			hit.HighlightedContent = pattern.ReplaceAllString(floor.Content, HighlightReplace)
+		}
+		holeFloors[floor.HoleID] = append(holeFloors[floor.HoleID], hit)
+	}
+
+	hits := make([]HoleSearchHit, len(holeCounts))
+	for i, holeCount := range holeCounts {
+		hits[i] = HoleSearchHit{
+			HoleID: holeCount.HoleID,
+			Count:  holeCount.Count,
+			Floors: holeFloors[holeCount.HoleID],
+		}
+	}
+	return hits, nil
+}
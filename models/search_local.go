@@ -0,0 +1,272 @@
+package models
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/exp/slices"
+
+	"treehole_next/config"
+	"treehole_next/utils/search"
+)
+
+// localBackend is the SearchBackend of an embedded inverted index, used by development and tests.
+// The index is built from the database at startup, or loaded from config.Config.SearchIndexPath
+// and synced with floors changed after the file is saved.
+type localBackend struct {
+	index *search.Index
+}
+
+func newLocalBackend() *localBackend {
+	backend := &localBackend{index: search.NewIndex()}
+
+	path := config.Config.SearchIndexPath
+	if path != "" {
+		info, err := os.Stat(path)
+		if err == nil {
+			err = backend.index.Load(path)
+		}
+		if err == nil {
+			log.Info().Int("documents", backend.index.Len()).Str("path", path).Msg("local search index loaded")
+			err = backend.sync(info.ModTime())
+			if err == nil {
+				return backend
+			}
+			backend.index = search.NewIndex()
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Err(err).Str("path", path).Msg("error loading local search index, rebuilding")
+		}
+	}
+
+	if DB == nil {
+		return backend
+	}
+	err := eachFloorModelBatch(context.Background(), func(floorModels []FloorModel) error {
+		return backend.BulkIndex(floorModels)
+	})
+	if err != nil {
+		log.Err(err).Msg("error building local search index")
+	}
+	log.Info().Int("documents", backend.index.Len()).Msg("local search index built")
+	return backend
+}
+
+// sync writes floors changed since the time into the index, the index is saved at the time
+func (backend *localBackend) sync(since time.Time) error {
+	if DB == nil {
+		return nil
+	}
+	// floors changed while saving are included
+	since = since.Add(-time.Minute)
+	count := 0
+	err := eachChangedFloorModelBatch(context.Background(), since, func(toIndex []FloorModel, toDelete []int) error {
+		count += len(toIndex) + len(toDelete)
+		err := backend.BulkIndex(toIndex)
+		if err != nil {
+			return err
+		}
+		return backend.BulkDelete(toDelete)
+	})
+	if err != nil {
+		return err
+	}
+	log.Info().Int("floors", count).Time("since", since).Msg("local search index synced")
+	return nil
+}
+
+func newLocalDocument(floor FloorModel) search.Document {
+	keywords := map[string][]int{
+		"hole_id":     {floor.HoleID},
+		"division_id": {floor.DivisionID},
+		"tag_ids":     floor.TagIDs,
+	}
+	if floor.Hidden {
+		keywords["hidden"] = []int{1}
+	}
+	if floor.Sensitive {
+		keywords["sensitive"] = []int{1}
+	}
+	return search.Document{
+		ID:       floor.ID,
+		Content:  floor.Content,
+		Time:     floor.UpdatedAt,
+		Keywords: keywords,
+		Numbers:  map[string]int{"like": floor.Like, "ranking": floor.Ranking},
+	}
+}
+
+func (backend *localBackend) Index(floor FloorModel) error {
+	backend.index.Add(newLocalDocument(floor))
+	return nil
+}
+
+func (backend *localBackend) Delete(floorID int) error {
+	backend.index.Delete(floorID)
+	return nil
+}
+
+func (backend *localBackend) BulkIndex(floors []FloorModel) error {
+	documents := make([]search.Document, len(floors))
+	for i, floor := range floors {
+		documents[i] = newLocalDocument(floor)
+	}
+	backend.index.Add(documents...)
+	return nil
+}
+
+func (backend *localBackend) BulkDelete(floorIDs []int) error {
+	backend.index.Delete(floorIDs...)
+	return nil
+}
+
+func newLocalQuery(request SearchRequest) search.Query {
+	query := search.Query{
+		Text:            request.Keyword,
+		Phrase:          request.Accurate,
+		Phrases:         request.Phrases,
+		ExcludedPhrases: request.Excludes,
+		Filters:         map[string][]int{},
+		Excludes:        map[string]int{"hidden": 1, "sensitive": 1},
+		Ranges:          map[string]search.NumberRange{"like": {Min: request.MinLikes, Max: request.MaxLikes}},
+		AfterID:         request.AfterFloorID,
+		MaxID:           request.MaxFloorID,
+		Offset:          request.Offset,
+		Size:            request.Size,
+	}
+	for keyword, value := range map[string]int{
+		"hole_id":     request.Filter.HoleID,
+		"division_id": request.Filter.DivisionID,
+	} {
+		if value != 0 {
+			query.Filters[keyword] = []int{value}
+		}
+	}
+	if len(request.Filter.TagIDs) > 0 {
+		query.Filters["tag_ids"] = request.Filter.TagIDs
+	}
+	if request.StartTime != nil {
+		after := time.Unix(*request.StartTime, 0)
+		query.After = &after
+	}
+	if request.EndTime != nil {
+		before := time.Unix(*request.EndTime, 0)
+		query.Before = &before
+	}
+	return query
+}
+
+func newLocalHit(hit search.Hit) SearchHit {
+	return SearchHit{
+		FloorID:            hit.ID,
+		HighlightedContent: search.Highlight(hit.Content, hit.Highlights, HighlightBegin, HighlightEnd),
+	}
+}
+
+func (backend *localBackend) Search(_ context.Context, request SearchRequest) ([]SearchHit, error) {
+	hits, _ := backend.index.Search(newLocalQuery(request))
+	results := make([]SearchHit, len(hits))
+	for i, hit := range hits {
+		results[i] = newLocalHit(hit)
+	}
+	return results, nil
+}
+
+// SearchHoles groups all matched documents by hole_id, holes are ordered by their best floors
+func (backend *localBackend) SearchHoles(_ context.Context, request SearchRequest, floorsPerHole int) ([]HoleSearchHit, error) {
+	query := newLocalQuery(request)
+	query.Offset, query.Size = 0, 0
+	hits, _ := backend.index.Search(query)
+
+	var holeHits []*HoleSearchHit
+	holeHitMap := make(map[int]*HoleSearchHit)
+	for _, hit := range hits {
+		holeID := hit.Keywords["hole_id"][0]
+		holeHit, ok := holeHitMap[holeID]
+		if !ok {
+			holeHit = &HoleSearchHit{HoleID: holeID}
+			holeHitMap[holeID] = holeHit
+			holeHits = append(holeHits, holeHit)
+		}
+		holeHit.Count++
+		if len(holeHit.Floors) < floorsPerHole {
+			holeHit.Floors = append(holeHit.Floors, newLocalHit(hit))
+		}
+	}
+
+	start := min(request.Offset, len(holeHits))
+	end := min(start+request.Size, len(holeHits))
+	results := make([]HoleSearchHit, 0, end-start)
+	for _, holeHit := range holeHits[start:end] {
+		results = append(results, *holeHit)
+	}
+	return results, nil
+}
+
+// similarTagBoost is added to the score of a hole for each shared tag, like a should clause of Elasticsearch
+const similarTagBoost = 1.0
+
+// SimilarHoles finds first floors similar to the content, each shared tag adds similarTagBoost to the score
+func (backend *localBackend) SimilarHoles(_ context.Context, request SimilarRequest) ([]int, error) {
+	firstFloor := 0
+	query := search.Query{
+		Excludes: map[string]int{"hidden": 1, "sensitive": 1},
+		Ranges:   map[string]search.NumberRange{"ranking": {Max: &firstFloor}},
+	}
+	hits, _ := backend.index.MoreLikeThis(request.Content, query)
+
+	for i, hit := range hits {
+		for _, tagID := range hit.Keywords["tag_ids"] {
+			if slices.Contains(request.TagIDs, tagID) {
+				hits[i].Score += similarTagBoost
+			}
+		}
+	}
+	slices.SortStableFunc(hits, func(a, b search.Hit) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+
+	holeIDs := make([]int, 0, request.Size)
+	for _, hit := range hits {
+		holeID := hit.Keywords["hole_id"][0]
+		if len(holeIDs) >= request.Size {
+			break
+		}
+		if holeID != request.ExcludeHoleID && !slices.Contains(holeIDs, holeID) {
+			holeIDs = append(holeIDs, holeID)
+		}
+	}
+	return holeIDs, nil
+}
+
+// SaveSearchIndex saves the local search index to config.Config.SearchIndexPath periodically and when ctx is done
+func SaveSearchIndex(ctx context.Context) {
+	backend, ok := Searcher.(*localBackend)
+	path := config.Config.SearchIndexPath
+	if !ok || path == "" {
+		return
+	}
+	save := func() {
+		err := backend.index.Save(path)
+		if err != nil {
+			log.Err(err).Str("path", path).Msg("error saving local search index")
+		}
+	}
+
+	ticker := time.NewTicker(time.Minute * 10)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			save()
+		case <-ctx.Done():
+			save()
+			log.Info().Msg("task SaveSearchIndex stopped...")
+			return
+		}
+	}
+}
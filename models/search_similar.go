@@ -0,0 +1,104 @@
+package models
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+
+	"treehole_next/config"
+	"treehole_next/utils"
+	"treehole_next/utils/search"
+)
+
+// duplicateResemblance is the least resemblance of two first floors to be taken as duplicates
+const duplicateResemblance = 0.8
+
+// SimilarHoles finds visible holes whose first floors are similar to request.Content, holes sharing tags rank higher.
+// Without a search backend, only holes sharing tags are found. Holes are not preprocessed.
+func SimilarHoles(c *fiber.Ctx, request SimilarRequest) (Holes, error) {
+	var holeIDs []int
+	var err error
+	if Searcher != nil {
+		holeIDs, err = Searcher.SimilarHoles(c.Context(), request)
+	} else {
+		holeIDs, err = similarHolesOld(request)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(holeIDs) == 0 {
+		return Holes{}, nil
+	}
+
+	holes := make(Holes, 0, len(holeIDs))
+	err = DB.Where("hidden = false").Find(&holes, holeIDs).Error
+	if err != nil {
+		log.Err(err).Msgf("error finding holes by IDs: %v", holeIDs)
+		return nil, err
+	}
+	return utils.OrderInGivenOrder(holes, holeIDs), nil
+}
+
+// RelatedHoles finds holes similar to the hole by its first floor and tags
+func RelatedHoles(c *fiber.Ctx, hole *Hole, size int) (Holes, error) {
+	var firstFloor Floor
+	err := DB.Where("hole_id = ? AND ranking = 0", hole.ID).Take(&firstFloor).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var tagIDs []int
+	err = DB.Model(&HoleTag{}).Where("hole_id = ?", hole.ID).Pluck("tag_id", &tagIDs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return SimilarHoles(c, SimilarRequest{
+		Content:       firstFloor.Content,
+		TagIDs:        tagIDs,
+		ExcludeHoleID: hole.ID,
+		Size:          size,
+	})
+}
+
+// similarHolesOld finds holes sharing the most tags, the latest first
+func similarHolesOld(request SimilarRequest) ([]int, error) {
+	holeIDs := make([]int, 0, request.Size)
+	if len(request.TagIDs) == 0 {
+		return holeIDs, nil
+	}
+	err := DB.Model(&HoleTag{}).
+		Joins("JOIN hole ON hole.id = hole_tags.hole_id").
+		Where("hole_tags.tag_id IN ? AND hole_tags.hole_id <> ? AND hole.hidden = false", request.TagIDs, request.ExcludeHoleID).
+		Group("hole_tags.hole_id").
+		Order("count(*) desc, hole_tags.hole_id desc").
+		Limit(request.Size).
+		Pluck("hole_tags.hole_id", &holeIDs).Error
+	return holeIDs, err
+}
+
+// FindDuplicateHole returns the ID of a visible hole of the user created in config.Config.DuplicateHoleWindowHours
+// with nearly the same content, or 0 if there is none
+func FindDuplicateHole(userID int, content string) (int, error) {
+	if config.Config.DuplicateHoleWindowHours <= 0 {
+		return 0, nil
+	}
+	var floors Floors
+	err := DB.Model(&Floor{}).
+		Joins("JOIN hole ON hole.id = floor.hole_id").
+		Where("floor.user_id = ? AND floor.ranking = 0 AND floor.deleted = false AND hole.hidden = false", userID).
+		Where("floor.created_at > ?", time.Now().Add(-time.Hour*time.Duration(config.Config.DuplicateHoleWindowHours))).
+		Order("floor.id desc").Limit(config.Config.MaxSize).
+		Select("floor.id", "floor.hole_id", "floor.content").
+		Find(&floors).Error
+	if err != nil {
+		return 0, err
+	}
+	for _, floor := range floors {
+		if search.Resemblance(floor.Content, content) >= duplicateResemblance {
+			return floor.HoleID, nil
+		}
+	}
+	return 0, nil
+}
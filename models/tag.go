@@ -17,6 +17,7 @@ import (
 	"gorm.io/gorm/clause"
 
 	"treehole_next/utils"
+	"treehole_next/utils/search"
 )
 
 type Tag struct {
@@ -67,7 +68,9 @@ func (tag *Tag) AfterCreate(_ *gorm.DB) (err error) {
 	return nil
 }
 
-func FindOrCreateTags(tx *gorm.DB, user *User, names []string) (Tags, error) {
+// FindOrCreateTags finds tags by names and creates the missing ones. If checkSimilar is set,
+// creating a tag similar to an existing one fails with 409, suggesting the existing tag.
+func FindOrCreateTags(tx *gorm.DB, user *User, names []string, checkSimilar bool) (Tags, error) {
 	tags := make(Tags, 0)
 	for i, name := range names {
 		names[i] = strings.TrimSpace(name)
@@ -81,9 +84,7 @@ func FindOrCreateTags(tx *gorm.DB, user *User, names []string) (Tags, error) {
 	for _, tag := range tags {
 		existTagNames = append(existTagNames, tag.Name)
 		if !user.IsAdmin {
-			if slices.ContainsFunc(config.Config.AdminOnlyTagIds, func(i int) bool {
-				return i == tag.ID
-			}) {
+			if isAdminOnlyTag(tag) {
 				return nil, common.Forbidden(fmt.Sprintf("标签 %s 为管理员专用标签", tag.Name))
 			}
 		}
@@ -119,6 +120,13 @@ func FindOrCreateTags(tx *gorm.DB, user *User, names []string) (Tags, error) {
 		}
 	}
 
+	if checkSimilar {
+		err = checkSimilarTags(user, names, newTags)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var wg sync.WaitGroup
 	for _, tag := range newTags {
 		wg.Add(1)
@@ -138,6 +146,7 @@ func FindOrCreateTags(tx *gorm.DB, user *User, names []string) (Tags, error) {
 	wg.Wait()
 
 	err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&newTags).Error
+	invalidateTagCompletions()
 
 	go UpdateTagCache(nil)
 
@@ -145,6 +154,7 @@ func FindOrCreateTags(tx *gorm.DB, user *User, names []string) (Tags, error) {
 }
 
 func UpdateTagCache(tags Tags) {
+	invalidateTagCompletions()
 	var err error
 	if len(tags) == 0 {
 		err := DB.Order("temperature desc").Find(&tags).Error
@@ -184,3 +194,118 @@ func (tag *Tag) Sensitive() bool {
 	}
 	return tag.IsSensitive
 }
+
+func isAdminOnlyTag(tag *Tag) bool {
+	return slices.Contains(config.Config.AdminOnlyTagIds, tag.ID)
+}
+
+// tagCompletions caches all tags ordered by temperature, with their names prepared for autocompletion
+var tagCompletions struct {
+	sync.Mutex
+	tags        Tags
+	completions []search.Completion
+	expireAt    time.Time
+}
+
+func loadTagCompletions() (Tags, []search.Completion, error) {
+	tagCompletions.Lock()
+	defer tagCompletions.Unlock()
+	if time.Now().Before(tagCompletions.expireAt) {
+		return tagCompletions.tags, tagCompletions.completions, nil
+	}
+
+	var tags Tags
+	err := DB.Order("temperature desc").Find(&tags).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	completions := make([]search.Completion, len(tags))
+	for i, tag := range tags {
+		completions[i] = search.NewCompletion(tag.Name)
+	}
+	tagCompletions.tags = tags
+	tagCompletions.completions = completions
+	tagCompletions.expireAt = time.Now().Add(time.Minute)
+	return tags, completions, nil
+}
+
+func invalidateTagCompletions() {
+	tagCompletions.Lock()
+	defer tagCompletions.Unlock()
+	tagCompletions.expireAt = time.Time{}
+}
+
+// SuggestTags finds at most size tags matching query by prefix, pinyin or fuzzily.
+// Better matches come first, then hotter tags. Sensitive and admin-only tags are excluded for non-admins.
+func SuggestTags(user *User, query string, size int) (Tags, error) {
+	tags, completions, err := loadTagCompletions()
+	if err != nil {
+		return nil, err
+	}
+
+	// tags are ordered by temperature, so a stable sort by match kind keeps hotter tags first
+	type suggestion struct {
+		tag  *Tag
+		kind search.MatchKind
+	}
+	var suggestions []suggestion
+	for i, tag := range tags {
+		if !user.IsAdmin && (tag.Sensitive() || isAdminOnlyTag(tag)) {
+			continue
+		}
+		kind := completions[i].Match(query)
+		if kind != search.NoMatch {
+			suggestions = append(suggestions, suggestion{tag: tag, kind: kind})
+		}
+	}
+	slices.SortStableFunc(suggestions, func(a, b suggestion) int {
+		return int(a.kind) - int(b.kind)
+	})
+
+	// copy tags, which are shared by the cache and may be modified by Preprocess
+	result := make(Tags, 0, min(size, len(suggestions)))
+	for _, suggestion := range suggestions[:min(size, len(suggestions))] {
+		tag := *suggestion.tag
+		result = append(result, &tag)
+	}
+	return result, nil
+}
+
+// checkSimilarTags fails with 409 if any of newTags is similar to an existing tag not in names
+func checkSimilarTags(user *User, names []string, newTags Tags) error {
+	tags, completions, err := loadTagCompletions()
+	if err != nil {
+		return err
+	}
+
+	var detail common.ErrorDetail
+	var message string
+	for _, newTag := range newTags {
+		newCompletion := search.NewCompletion(newTag.Name)
+		for i, tag := range tags {
+			if !user.IsAdmin && (tag.Sensitive() || isAdminOnlyTag(tag)) {
+				continue
+			}
+			if slices.ContainsFunc(names, func(name string) bool { return strings.EqualFold(name, tag.Name) }) {
+				continue
+			}
+			if completions[i].Similar(newCompletion) {
+				if message == "" {
+					message = fmt.Sprintf("标签 %s 与已有标签 %s 相似，请使用已有标签，或确认新建标签", newTag.Name, tag.Name)
+				}
+				detail = append(detail, &common.ErrorDetailElement{
+					Tag:     "similar",
+					Field:   "tags",
+					Value:   newTag.Name,
+					Param:   tag.Name,
+					Message: "similar to an existing tag",
+				})
+				break
+			}
+		}
+	}
+	if len(detail) == 0 {
+		return nil
+	}
+	return &common.HttpError{Code: 409, Message: message, Detail: &detail}
+}
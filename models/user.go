@@ -92,9 +92,16 @@ type UserConfig struct {
 	// used when notify
 	Notify []string `json:"notify"`
 
+	// types of notifications turned off, for types sent by default and not in Notify, e.g. saved_search
+	NotifyOff []string `json:"notify_off,omitempty"`
+
 	// 对折叠内容的处理
 	// fold 折叠, hide 隐藏, show 展示
 	ShowFolded string `json:"show_folded"`
+
+	// notifications of the types are pushed in digests, types not set are immediate;
+	// they are still listed in messages as soon as they are sent
+	Digest map[MessageType]DigestPeriod `json:"digest,omitempty"`
 }
 
 var defaultUserConfig = UserConfig{
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/opentreehole/go-common"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+)
+
+// UserMuteLimit is the max number of holes and floors a user can mute
+const UserMuteLimit = 200
+
+// UserMute stops notifications of replies, mentions and subscriptions in a hole, or mentions of a floor, to the user
+type UserMute struct {
+	ID        int       `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"time_created"`
+
+	UserID int `json:"-" gorm:"not null;uniqueIndex:idx_user_mute,priority:1"`
+
+	// exactly one of HoleID and FloorID is set, the other is 0
+	HoleID  int `json:"hole_id" gorm:"not null;default:0;uniqueIndex:idx_user_mute,priority:2"`
+	FloorID int `json:"floor_id" gorm:"not null;default:0;uniqueIndex:idx_user_mute,priority:3"`
+
+	// null means forever
+	ExpiresAt *time.Time `json:"time_expires"`
+}
+
+type UserMutes []*UserMute
+
+// activeMutes are mutes not expired
+func activeMutes(tx *gorm.DB) *gorm.DB {
+	return tx.Model(&UserMute{}).Where("expires_at IS NULL OR expires_at > ?", time.Now())
+}
+
+// ListUserMutes returns mutes of the user not expired, the latest first
+func ListUserMutes(tx *gorm.DB, userID int) (UserMutes, error) {
+	mutes := make(UserMutes, 0)
+	err := activeMutes(tx).Where("user_id = ?", userID).Order("id DESC").Find(&mutes).Error
+	return mutes, err
+}
+
+// AddUserMute mutes the hole or floor for the user, or updates the expiry if it is muted already
+func AddUserMute(tx *gorm.DB, mute *UserMute) error {
+	return tx.Clauses(dbresolver.Write).Transaction(func(tx *gorm.DB) error {
+		// expired mutes are useless
+		err := tx.Where("user_id = ? AND expires_at <= ?", mute.UserID, time.Now()).Delete(&UserMute{}).Error
+		if err != nil {
+			return err
+		}
+
+		// updating the expiry of an existing mute is not limited
+		var exists int64
+		err = tx.Model(&UserMute{}).Where("user_id = ? AND hole_id = ? AND floor_id = ?", mute.UserID, mute.HoleID, mute.FloorID).
+			Count(&exists).Error
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			var count int64
+			err = tx.Model(&UserMute{}).Where("user_id = ?", mute.UserID).Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count >= UserMuteLimit {
+				return common.Forbidden(fmt.Sprintf("最多屏蔽 %d 个帖子或楼层", UserMuteLimit))
+			}
+		}
+
+		err = tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "hole_id"}, {Name: "floor_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"expires_at"}),
+		}).Create(mute).Error
+		if err != nil {
+			return err
+		}
+		// the id is not returned on conflict by some databases
+		var saved UserMute
+		err = tx.Where("user_id = ? AND hole_id = ? AND floor_id = ?", mute.UserID, mute.HoleID, mute.FloorID).Take(&saved).Error
+		*mute = saved
+		return err
+	})
+}
+
+// filterMutedHole removes users who muted the hole
+func filterMutedHole(tx *gorm.DB, userIDs []int, holeID int) []int {
+	if len(userIDs) == 0 {
+		return userIDs
+	}
+	var mutedIDs []int
+	err := activeMutes(tx).Where("user_id IN ? AND hole_id = ?", userIDs, holeID).Pluck("user_id", &mutedIDs).Error
+	if err != nil || len(mutedIDs) == 0 {
+		return userIDs
+	}
+
+	filtered := make([]int, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if !slices.Contains(mutedIDs, userID) {
+			filtered = append(filtered, userID)
+		}
+	}
+	return filtered
+}
+
+// isFloorMuted tells whether the user muted the floor
+func isFloorMuted(tx *gorm.DB, userID int, floorID int) bool {
+	var count int64
+	err := activeMutes(tx).Where("user_id = ? AND floor_id = ?", userID, floorID).Count(&count).Error
+	return err == nil && count > 0
+}
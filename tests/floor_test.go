@@ -1,14 +1,25 @@
 package tests
 
 import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/goccy/go-json"
 
 	. "treehole_next/config"
 	. "treehole_next/models"
+	"treehole_next/utils"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -42,6 +53,57 @@ func TestListFloorsInAHole(t *testing.T) {
 	}
 }
 
+func TestListFloorsInAHoleByCursor(t *testing.T) {
+	var hole Hole
+	DB.Where("division_id = ?", 7).First(&hole)
+	route := "/api/holes/" + strconv.Itoa(hole.ID) + "/floors"
+
+	type cursorResponse struct {
+		Data       Floors  `json:"data"`
+		NextCursor *string `json:"next_cursor"`
+		PrevCursor *string `json:"prev_cursor"`
+	}
+	list := func(data Map) cursorResponse {
+		var response cursorResponse
+		err := json.Unmarshal(testCommonQuery(t, "get", route, 200, data), &response)
+		assert.Nilf(t, err, "unmarshal response")
+		return response
+	}
+
+	// first page
+	size := 20
+	first := list(Map{"cursor": "", "size": size})
+	assert.EqualValues(t, size, len(first.Data))
+	assert.EqualValues(t, "1", first.Data[0].Content)
+	assert.Nil(t, first.PrevCursor)
+	assert.NotNil(t, first.NextCursor)
+
+	// next page
+	second := list(Map{"cursor": *first.NextCursor, "size": size})
+	assert.EqualValues(t, size, len(second.Data))
+	assert.EqualValues(t, strings.Repeat("1", size+1), second.Data[0].Content)
+	assert.NotNil(t, second.PrevCursor)
+
+	// back to the first page
+	back := list(Map{"cursor": *second.PrevCursor, "size": size})
+	assert.EqualValues(t, size, len(back.Data))
+	assert.EqualValues(t, first.Data[0].ID, back.Data[0].ID)
+	assert.EqualValues(t, first.Data[size-1].ID, back.Data[size-1].ID)
+	assert.Nil(t, back.PrevCursor)
+
+	// last page
+	third := list(Map{"cursor": *second.NextCursor, "size": size})
+	assert.EqualValues(t, 10, len(third.Data))
+	assert.Nil(t, third.NextCursor)
+
+	// descending
+	desc := list(Map{"cursor": "", "size": size, "sort": "desc"})
+	assert.EqualValues(t, strings.Repeat("1", 50), desc.Data[0].Content)
+
+	// invalid cursor
+	testCommonQuery(t, "get", route, 400, Map{"cursor": "invalid"})
+}
+
 func TestListFloorsOld(t *testing.T) {
 	var hole Hole
 	DB.Where("division_id = ?", 7).First(&hole)
@@ -66,6 +128,30 @@ func TestGetFloor(t *testing.T) {
 	testAPIModel(t, "get", "/api/floors/"+strconv.Itoa(largeInt), 404, &getFloor)
 }
 
+func TestGetFloorConversation(t *testing.T) {
+	var hole Hole
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &hole, Map{"content": "conversation", "tags": []Map{{"name": "114"}}})
+	route := "/api/holes/" + strconv.Itoa(hole.ID) + "/floors"
+
+	createFloor := func(content string, replyTo int) int {
+		var floor Floor
+		testAPIModel(t, "post", route, 201, &floor, Map{"content": content, "reply_to": replyTo})
+		return floor.ID
+	}
+	first := hole.HoleFloor.FirstFloor.ID
+	second := createFloor("second", first)
+	third := createFloor("third", second)
+	fourth := createFloor("fourth", third)
+	createFloor("sibling", second)
+	createFloor("unrelated", 0)
+
+	var floors Floors
+	testAPIModel(t, "get", "/api/floors/"+strconv.Itoa(third)+"/conversation", 200, &floors)
+	assert.EqualValues(t, []int{first, second, third, fourth}, utils.Models2IDSlice(floors))
+
+	testCommon(t, "get", "/api/floors/"+strconv.Itoa(largeInt)+"/conversation", 404)
+}
+
 func TestCreateFloor(t *testing.T) {
 	var hole Hole
 	DB.Where("division_id = ?", 7).Offset(1).First(&hole)
@@ -172,6 +258,50 @@ func TestModifyFloor(t *testing.T) {
 	assert.EqualValues(t, 0, getFloor.Like)
 }
 
+func TestGetFloorHistoryDiff(t *testing.T) {
+	var hole Hole
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &hole, Map{"content": "line 1\nline 2\n", "tags": []Map{{"name": "114"}}})
+	var floor Floor
+	DB.Where("hole_id = ?", hole.ID).Take(&floor)
+	route := "/api/floors/" + strconv.Itoa(floor.ID)
+	testAPI(t, "put", route, 200, Map{"content": "line 1\nline two\n"})
+	testAPI(t, "put", route, 200, Map{"content": "line 1\nline two\nline 3\n"})
+
+	var histories []FloorHistory
+	DB.Where("floor_id = ?", floor.ID).Order("id").Find(&histories)
+	assert.Len(t, histories, 2)
+
+	type diffResponse struct {
+		Diff    []utils.DiffSegment `json:"diff"`
+		Changes []Map               `json:"changes"`
+	}
+	diff := func(data Map) diffResponse {
+		var response diffResponse
+		err := json.Unmarshal(testCommonQuery(t, "get", route+"/history/_diff", 200, data), &response)
+		assert.Nilf(t, err, "unmarshal response")
+		return response
+	}
+
+	// the earliest version against the current content
+	response := diff(Map{})
+	assert.Equal(t, []utils.DiffSegment{
+		{Type: utils.DiffEqual, Text: "line 1\n"},
+		{Type: utils.DiffDelete, Text: "line 2\n"},
+		{Type: utils.DiffInsert, Text: "line two\nline 3\n"},
+	}, response.Diff)
+	assert.Len(t, response.Changes, 2)
+
+	response = diff(Map{"from": histories[1].ID, "to": 0, "level": "word"})
+	assert.Equal(t, []utils.DiffSegment{
+		{Type: utils.DiffEqual, Text: "line 1\nline two\n"},
+		{Type: utils.DiffInsert, Text: "line 3\n"},
+	}, response.Diff)
+	assert.Len(t, response.Changes, 1)
+
+	testCommonQuery(t, "get", route+"/history/_diff", 404, Map{"from": largeInt})
+	testCommonQuery(t, "get", route+"/history/_diff", 400, Map{"level": "char"})
+}
+
 func TestModifyFloorLike(t *testing.T) {
 	var hole Hole
 	DB.Where("division_id = ?", 7).Offset(4).First(&hole)
@@ -200,6 +330,41 @@ func TestModifyFloorLike(t *testing.T) {
 	assert.EqualValues(t, 0, floor.Like)
 }
 
+func TestFloorReaction(t *testing.T) {
+	var hole Hole
+	DB.Where("division_id = ?", 7).Offset(6).First(&hole)
+	var floor Floor
+	DB.Where("hole_id = ?", hole.ID).First(&floor)
+	route := "/api/floors/" + strconv.Itoa(floor.ID) + "/reactions"
+
+	var getFloor Floor
+	testAPIModel(t, "post", route, 200, &getFloor, Map{"emoji": "😂"})
+	testAPIModel(t, "post", route, 200, &getFloor, Map{"emoji": "😂"}) // idempotent
+	testAPIModel(t, "post", route, 200, &getFloor, Map{"emoji": "👍"})
+	assert.EqualValues(t, []FloorReactionCount{
+		{Emoji: "👍", Count: 1, Reacted: true},
+		{Emoji: "😂", Count: 1, Reacted: true},
+	}, getFloor.Reactions)
+	assert.EqualValues(t, 1, getFloor.Like)
+	assert.True(t, getFloor.LikedFrontend)
+
+	// 👎 replaces 👍
+	testAPIModel(t, "post", route, 200, &getFloor, Map{"emoji": "👎"})
+	assert.EqualValues(t, 0, getFloor.Like)
+	assert.EqualValues(t, 1, getFloor.Dislike)
+
+	// removing 👍 keeps 👎
+	testAPIModel(t, "delete", route, 200, &getFloor, Map{"emoji": "👍"})
+	assert.EqualValues(t, 1, getFloor.Dislike)
+
+	testAPIModel(t, "delete", route, 200, &getFloor, Map{"emoji": "👎"})
+	testAPIModel(t, "delete", route, 200, &getFloor, Map{"emoji": "😂"})
+	assert.EqualValues(t, 0, getFloor.Dislike)
+	assert.Empty(t, getFloor.Reactions)
+
+	testAPI(t, "post", route, 400, Map{"emoji": "🐶"})
+}
+
 func TestDeleteFloor(t *testing.T) {
 	var hole Hole
 	DB.Where("division_id = ?", 7).Offset(5).First(&hole)
@@ -221,3 +386,442 @@ func TestDeleteFloor(t *testing.T) {
 	DB.Where("hole_id = ?", hole.ID).Offset(1).First(&floor)
 	testAPI(t, "delete", "/api/floors/"+strconv.Itoa(floor.ID), 200, data)
 }
+
+func TestBatchModerate(t *testing.T) {
+	var hole, other Hole
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &hole, Map{"content": "spam 1", "tags": []Map{{"name": "114"}}})
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &other, Map{"content": "spam 2", "tags": []Map{{"name": "114"}}})
+	var reply Floor
+	testAPIModel(t, "post", "/api/holes/"+strconv.Itoa(hole.ID)+"/floors", 201, &reply, Map{"content": "spam reply"})
+	var first Floor
+	DB.Where("hole_id = ? AND ranking = 0", hole.ID).Take(&first)
+	DB.Model(&reply).Update("user_id", testNotificationUserID)
+
+	type batchResponse struct {
+		Succeeded int   `json:"succeeded"`
+		Failed    int   `json:"failed"`
+		Results   []Map `json:"results"`
+	}
+	var response batchResponse
+	err := json.Unmarshal(testCommon(t, "post", "/api/moderation/_batch", 200, Map{"actions": []Map{
+		{"action": "fold", "floor_id": first.ID, "reason": "广告"},
+		{"action": "fold", "floor_id": reply.ID}, // no reason
+		{"action": "delete", "floor_id": reply.ID, "reason": "广告"},
+		{"action": "delete", "floor_id": largeInt},
+		{"action": "lock_hole", "hole_id": hole.ID},
+		{"action": "hide_hole", "hole_id": other.ID},
+	}}), &response)
+	assert.Nilf(t, err, "unmarshal response")
+	assert.Equal(t, 4, response.Succeeded)
+	assert.Equal(t, 2, response.Failed)
+	assert.Len(t, response.Results, 6)
+	assert.Equal(t, false, response.Results[1]["success"])
+	assert.Equal(t, false, response.Results[3]["success"])
+
+	DB.Take(&first, first.ID)
+	assert.Equal(t, "广告", first.Fold)
+	DB.Take(&reply, reply.ID)
+	assert.True(t, reply.Deleted)
+	assert.Empty(t, reply.Fold) // the failed fold is rolled back
+	DB.Take(&hole, hole.ID)
+	assert.True(t, hole.Locked)
+	DB.Take(&other, other.ID)
+	assert.True(t, other.Hidden)
+
+	var count int64
+	DB.Model(&FloorHistory{}).Where("floor_id IN ?", []int{first.ID, reply.ID}).Count(&count)
+	assert.EqualValues(t, 2, count)
+
+	// the author of the deleted floor is notified
+	var notified Message
+	err = DB.Where("type = ? AND related_floor_id = ?", MessageTypeModify, reply.ID).Take(&notified).Error
+	if assert.Nil(t, err) {
+		var recipient MessageUser
+		DB.Where("message_id = ?", notified.ID).Take(&recipient)
+		assert.Equal(t, testNotificationUserID, recipient.UserID)
+	}
+
+	testAPI(t, "post", "/api/moderation/_batch", 400, Map{"actions": []Map{{"action": "unknown", "floor_id": first.ID}}})
+}
+
+func TestSearchFloorsWithFilter(t *testing.T) {
+	var hole, other Hole
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &hole, Map{"content": "scoped keyword one", "tags": []Map{{"name": "114"}}})
+	testAPIModel(t, "post", "/api/divisions/2/holes", 201, &other, Map{"content": "scoped keyword two", "tags": []Map{{"name": "114"}}})
+
+	search := func(data Map) Floors {
+		var floors Floors
+		data["search"] = "scoped keyword"
+		err := json.Unmarshal(testCommonQuery(t, "get", "/api/floors/search", 200, data), &floors)
+		assert.Nilf(t, err, "unmarshal response")
+		return floors
+	}
+
+	assert.Len(t, search(Map{}), 2)
+	assert.Len(t, search(Map{"tag": "114"}), 2)
+	assert.Len(t, search(Map{"tag": "not exist"}), 0)
+
+	floors := search(Map{"hole_id": hole.ID})
+	assert.Len(t, floors, 1)
+	assert.Equal(t, hole.ID, floors[0].HoleID)
+
+	floors = search(Map{"division_id": 2})
+	assert.Len(t, floors, 1)
+	assert.Equal(t, other.ID, floors[0].HoleID)
+}
+
+func TestReindexSearch(t *testing.T) {
+	// Elasticsearch is disabled in tests
+	testAPI(t, "post", "/api/config/search/_reindex", 400)
+
+	var status ReindexStatus
+	err := json.Unmarshal(testCommon(t, "get", "/api/config/search/_reindex", 200), &status)
+	assert.Nilf(t, err, "unmarshal response")
+	assert.False(t, status.Running)
+
+	// a fake Elasticsearch recording bulk requests
+	var bulkActions []string
+	var dualWriteIndex string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+		case strings.HasSuffix(r.URL.Path, "/_bulk"):
+			body, _ := io.ReadAll(r.Body)
+			for i, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+				if i%2 == 0 {
+					bulkActions = append(bulkActions, strings.Split(line, `"`)[1])
+				}
+			}
+			utils.GetCache("reindex_dual_write_index", &dualWriteIndex)
+			_, _ = w.Write([]byte(`{"errors":false,"items":[],"took":1}`))
+		case strings.HasSuffix(r.URL.Path, "/_refresh"):
+			_, _ = w.Write([]byte(`{"_shards":{"total":1,"successful":1,"failed":0}}`))
+		default:
+			_, _ = w.Write([]byte(`{"acknowledged":true,"shards_acknowledged":true,"index":"floors"}`))
+		}
+	}))
+	defer server.Close()
+	es := ES
+	ES, err = elasticsearch.NewTypedClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	assert.Nil(t, err)
+	defer func() { ES = es }()
+
+	// copies do not overwrite documents written by other instances, which see the new index through the cache
+	assert.Nil(t, ReindexFloors(context.Background()))
+	if assert.NotEmpty(t, bulkActions) {
+		assert.Equal(t, "create", bulkActions[0])
+	}
+	status = GetReindexStatus()
+	assert.Empty(t, status.Error)
+	assert.Equal(t, status.Index, dualWriteIndex)
+	assert.False(t, utils.GetCache("reindex_dual_write_index", &dualWriteIndex))
+}
+
+func TestAuditSearchIndex(t *testing.T) {
+	// Elasticsearch is disabled in tests
+	testAPI(t, "post", "/api/config/search/_audit", 400, Map{"from_id": 1, "size": 100})
+	testAPI(t, "post", "/api/config/search/_audit", 400, Map{"size": 100000})
+	testAPI(t, "get", "/api/config/search/_audit", 404)
+
+	// floors of deleted holes are not searchable, their documents are extra
+	var hole Hole
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &hole, Map{"content": "audit deleted hole", "tags": []Map{{"name": "search"}}})
+	var floor Floor
+	DB.Where("hole_id = ?", hole.ID).First(&floor)
+	testAPI(t, "delete", "/api/holes/"+strconv.Itoa(hole.ID)+"/_force", 204)
+
+	floorModels, err := NewFloorModels(DB, Floors{&floor})
+	assert.Nil(t, err)
+	if assert.Len(t, floorModels, 1) {
+		assert.True(t, floorModels[0].Hidden)
+	}
+
+	// a fake Elasticsearch with the document indexed before the hole is deleted
+	var source Map
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(Map{"docs": []Map{
+			{"_index": IndexName, "_id": strconv.Itoa(floor.ID), "found": true, "_source": source},
+		}})
+	}))
+	defer server.Close()
+	es := ES
+	ES, err = elasticsearch.NewTypedClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	assert.Nil(t, err)
+	defer func() { ES = es }()
+
+	toSource := func(floorModel FloorModel) Map {
+		data, _ := json.Marshal(floorModel)
+		var source Map
+		_ = json.Unmarshal(data, &source)
+		return source
+	}
+	source = toSource(FloorModel{ID: floor.ID, HoleID: hole.ID, DivisionID: 1, Content: floor.Content, TagIDs: []int{}})
+	report, err := AuditFloorIndex(context.Background(), floor.ID, 1, false)
+	if assert.Nil(t, err) {
+		assert.Equal(t, 1, report.Checked)
+		assert.Equal(t, 0, report.Missing.Count)
+		assert.Equal(t, []int{floor.ID}, report.Extra.FloorIDs)
+	}
+
+	// documents indexed before a field is added are stale
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &hole, Map{"content": "audit missing field", "tags": []Map{{"name": "search"}}})
+	floor = Floor{}
+	DB.Where("hole_id = ?", hole.ID).First(&floor)
+	floorModels, err = NewFloorModels(DB, Floors{&floor})
+	assert.Nil(t, err)
+	source = toSource(floorModels[0])
+	report, err = AuditFloorIndex(context.Background(), floor.ID, 1, false)
+	if assert.Nil(t, err) {
+		assert.Equal(t, 0, report.Stale.Count)
+	}
+	delete(source, "ranking")
+	report, err = AuditFloorIndex(context.Background(), floor.ID, 1, false)
+	if assert.Nil(t, err) {
+		assert.Equal(t, []int{floor.ID}, report.Stale.FloorIDs)
+	}
+
+	// like counts are filtered on
+	source = toSource(floorModels[0])
+	source["like"] = floorModels[0].Like + 1
+	report, err = AuditFloorIndex(context.Background(), floor.ID, 1, false)
+	if assert.Nil(t, err) {
+		assert.Equal(t, []int{floor.ID}, report.Stale.FloorIDs)
+	}
+}
+
+func TestSearchFloors(t *testing.T) {
+	var hole, other Hole
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &hole, Map{"content": "独角兽 很可爱", "tags": []Map{{"name": "search"}}})
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &other, Map{"content": "独角兽 独角兽 独角兽", "tags": []Map{{"name": "search"}}})
+
+	type highlightedFloor struct {
+		HoleID             int    `json:"hole_id"`
+		HighlightedContent string `json:"highlighted_content"`
+	}
+	search := func(data Map) []highlightedFloor {
+		var floors []highlightedFloor
+		err := json.Unmarshal(testCommonQuery(t, "get", "/api/floors/search", 200, data), &floors)
+		assert.Nilf(t, err, "unmarshal response")
+		return floors
+	}
+
+	// ranked by BM25, more occurrences first
+	floors := search(Map{"search": "独角兽"})
+	if assert.Len(t, floors, 2) {
+		assert.Equal(t, other.ID, floors[0].HoleID)
+		assert.Equal(t, hole.ID, floors[1].HoleID)
+		assert.Equal(t, "<em>独角兽</em> 很可爱", floors[1].HighlightedContent)
+	}
+
+	floors = search(Map{"search": "角兽 很", "accurate": true})
+	if assert.Len(t, floors, 1) {
+		assert.Equal(t, "独<em>角兽 很</em>可爱", floors[0].HighlightedContent)
+	}
+	assert.Len(t, search(Map{"search": "兽 很独角", "accurate": true}), 0)
+
+	// deleted floors and hidden holes are removed from the index
+	var floor Floor
+	DB.Where("hole_id = ?", other.ID).First(&floor)
+	testAPI(t, "delete", "/api/floors/"+strconv.Itoa(floor.ID), 200, Map{"delete_reason": "test"})
+	assert.Len(t, search(Map{"search": "独角兽"}), 1)
+	testAPI(t, "delete", "/api/holes/"+strconv.Itoa(hole.ID), 204)
+	assert.Len(t, search(Map{"search": "独角兽"}), 0)
+}
+
+func TestLocalSearchIndex(t *testing.T) {
+	searcher := Searcher
+	defer func() { Searcher = searcher }()
+
+	// the local index is per instance, not used by default in production
+	mode := Config.Mode
+	Config.Mode = "production"
+	InitSearch()
+	assert.Nil(t, Searcher)
+	Config.Mode = mode
+	Searcher = searcher
+
+	var hole Hole
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &hole, Map{"content": "持久化索引 原内容", "tags": []Map{{"name": "search"}}})
+	search := func(keyword string) Floors {
+		var floors Floors
+		err := json.Unmarshal(testCommonQuery(t, "get", "/api/floors/search", 200, Map{"search": keyword}), &floors)
+		assert.Nilf(t, err, "unmarshal response")
+		return floors
+	}
+	assert.Len(t, search("持久化索引 原内容"), 1)
+
+	path := filepath.Join(t.TempDir(), "index.gob")
+	Config.SearchIndexPath = path
+	defer func() { Config.SearchIndexPath = "" }()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	SaveSearchIndex(ctx)
+	savedAt := time.Now().Add(-2 * time.Minute)
+	assert.Nil(t, os.Chtimes(path, savedAt, savedAt))
+
+	// changed by another instance after the index is saved
+	DB.Model(&Floor{}).Where("hole_id = ?", hole.ID).Update("content", "持久化索引 新内容")
+
+	// the loaded index is synced with the database
+	InitSearch()
+	assert.Empty(t, search("持久化索引 原内容"))
+	assert.Len(t, search("持久化索引 新内容"), 1)
+}
+
+func TestSearchFloorsWithSyntax(t *testing.T) {
+	var hole, other Hole
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &hole, Map{"content": "语法测试 苹果 香蕉", "tags": []Map{{"name": "syntax"}}})
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &other, Map{"content": "语法测试 苹果 橘子", "tags": []Map{{"name": "search"}}})
+	var floor Floor
+	DB.Where("hole_id = ?", other.ID).First(&floor)
+	testAPI(t, "post", "/api/floors/"+strconv.Itoa(floor.ID)+"/like/1", 200)
+
+	search := func(keyword string) []int {
+		var floors Floors
+		err := json.Unmarshal(testCommonQuery(t, "get", "/api/floors/search", 200, Map{"search": keyword}), &floors)
+		assert.Nilf(t, err, "unmarshal response")
+		holeIDs := make([]int, len(floors))
+		for i := range floors {
+			holeIDs[i] = floors[i].HoleID
+		}
+		return holeIDs
+	}
+
+	assert.ElementsMatch(t, []int{hole.ID, other.ID}, search("语法测试 苹果"))
+	assert.Equal(t, []int{other.ID}, search("语法测试 -香蕉"))
+	assert.Equal(t, []int{hole.ID}, search(`"苹果 香蕉"`))
+	assert.Equal(t, []int{hole.ID}, search("语法测试 tag:syntax"))
+	assert.Empty(t, search("语法测试 tag:syntax tag:search"))
+	assert.Empty(t, search("语法测试 tag:not_exist"))
+	assert.Equal(t, []int{other.ID}, search("语法测试 #"+strconv.Itoa(other.ID)))
+	assert.Equal(t, []int{other.ID}, search("语法测试 likes>0"))
+	assert.Equal(t, []int{hole.ID}, search("语法测试 likes<=0"))
+	assert.Len(t, search("语法测试 after:2000-01-01"), 2)
+	assert.Empty(t, search("语法测试 before:2000-01-01"))
+
+	// the database fallback matches words, phrases and excludes as substrings
+	searcher := Searcher
+	Searcher = nil
+	assert.Equal(t, []int{other.ID}, search("语法测试 -香蕉 likes>0"))
+	assert.Equal(t, []int{hole.ID}, search(`"苹果 香蕉" tag:syntax`))
+	Searcher = searcher
+
+	// malformed queries
+	data := testAPI(t, "get", "/api/floors/search?search="+url.QueryEscape(`语法测试 "unclosed`), 400)
+	detail, _ := data["detail"].([]any)
+	if assert.Len(t, detail, 1) {
+		assert.Equal(t, "unclosed quote", detail[0].(map[string]any)["message"])
+		assert.Equal(t, "13", detail[0].(map[string]any)["param"])
+	}
+	testAPI(t, "get", "/api/floors/search?search="+url.QueryEscape("语法测试 likes>many"), 400)
+}
+
+func TestSearchHoles(t *testing.T) {
+	var hole, other Hole
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &hole, Map{"content": "分组搜索 第一个洞", "tags": []Map{{"name": "search"}}})
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &other, Map{"content": "分组搜索 第二个洞", "tags": []Map{{"name": "search"}}})
+	testAPI(t, "post", "/api/holes/"+strconv.Itoa(hole.ID)+"/floors", 201, Map{"content": "回复分组搜索"})
+	testAPI(t, "post", "/api/holes/"+strconv.Itoa(hole.ID)+"/floors", 201, Map{"content": "再次回复分组搜索"})
+	testAPI(t, "post", "/api/holes/"+strconv.Itoa(hole.ID)+"/floors", 201, Map{"content": "无关的回复"})
+
+	type result struct {
+		ID            int `json:"id"`
+		MatchCount    int `json:"match_count"`
+		MatchedFloors []struct {
+			ID                 int    `json:"id"`
+			HighlightedContent string `json:"highlighted_content"`
+		} `json:"matched_floors"`
+		Tags   Tags `json:"tags"`
+		Floors struct {
+			FirstFloor *Floor `json:"first_floor"`
+		} `json:"floors"`
+	}
+	search := func(query Map) []result {
+		var results []result
+		err := json.Unmarshal(testCommonQuery(t, "get", "/api/holes/search", 200, query), &results)
+		assert.Nilf(t, err, "unmarshal response")
+		return results
+	}
+
+	check := func() {
+		results := search(Map{"search": "分组搜索", "floor_size": 2})
+		if !assert.Len(t, results, 2) {
+			return
+		}
+		counts := map[int]int{}
+		for _, result := range results {
+			counts[result.ID] = result.MatchCount
+			assert.LessOrEqual(t, len(result.MatchedFloors), 2)
+			for _, floor := range result.MatchedFloors {
+				assert.Contains(t, floor.HighlightedContent, "<em>")
+			}
+			if assert.NotNil(t, result.Floors.FirstFloor) {
+				assert.Equal(t, result.ID, result.Floors.FirstFloor.HoleID)
+			}
+			assert.NotEmpty(t, result.Tags)
+		}
+		assert.Equal(t, map[int]int{hole.ID: 3, other.ID: 1}, counts)
+
+		// pagination applies to holes
+		first := search(Map{"search": "分组搜索", "size": 1})
+		second := search(Map{"search": "分组搜索", "size": 1, "offset": 1})
+		if assert.Len(t, first, 1) && assert.Len(t, second, 1) {
+			assert.ElementsMatch(t, []int{hole.ID, other.ID}, []int{first[0].ID, second[0].ID})
+		}
+		assert.Empty(t, search(Map{"search": "分组搜索", "offset": 2}))
+	}
+	check()
+
+	searcher := Searcher
+	Searcher = nil
+	check()
+	Searcher = searcher
+
+	testAPI(t, "get", "/api/holes/search?search=分组搜索&floor_size=11", 400)
+}
+
+func TestSearchEvents(t *testing.T) {
+	testAPI(t, "post", "/api/divisions/1/holes", 201, Map{"content": "统计搜索 事件", "tags": []Map{{"name": "search"}}})
+	for i := 0; i < 3; i++ {
+		testCommonQuery(t, "get", "/api/floors/search", 200, Map{"search": "  统计搜索   事件 "})
+	}
+	testCommonQuery(t, "get", "/api/floors/search", 200, Map{"search": "统计搜索 不存在的内容"})
+	testCommonQuery(t, "get", "/api/floors/search", 200, Map{"search": "统计搜索 13812345678"})
+
+	var event SearchEvent
+	DB.Last(&event)
+	assert.Equal(t, "统计搜索 *", event.Query)
+	assert.Equal(t, "local", event.Backend)
+
+	type queryStat struct {
+		Query              string  `json:"query"`
+		Count              int     `json:"count"`
+		AverageResultCount float64 `json:"average_result_count"`
+	}
+	var stats []queryStat
+	err := json.Unmarshal(testCommonQuery(t, "get", "/api/config/search/_top_queries", 200, Map{"size": 100}), &stats)
+	assert.Nil(t, err)
+	assert.Contains(t, stats, queryStat{Query: "统计搜索 事件", Count: 3, AverageResultCount: 1})
+
+	err = json.Unmarshal(testCommonQuery(t, "get", "/api/config/search/_zero_result_queries", 200, Map{"size": 100}), &stats)
+	assert.Nil(t, err)
+	assert.Contains(t, stats, queryStat{Query: "统计搜索 不存在的内容", Count: 1})
+	for _, stat := range stats {
+		assert.NotEqual(t, "统计搜索 事件", stat.Query)
+	}
+
+	var latencies []SearchLatencyStat
+	err = json.Unmarshal(testCommon(t, "get", "/api/config/search/_latency", 200), &latencies)
+	assert.Nil(t, err)
+	index := slices.IndexFunc(latencies, func(stat SearchLatencyStat) bool { return stat.Backend == "local" })
+	if assert.GreaterOrEqual(t, index, 0) {
+		assert.GreaterOrEqual(t, latencies[index].Count, 5)
+		assert.LessOrEqual(t, latencies[index].P50, latencies[index].P99)
+		assert.LessOrEqual(t, latencies[index].P99, latencies[index].Max)
+	}
+}
@@ -1,10 +1,12 @@
 package tests
 
 import (
+	"net/http"
 	"strconv"
 	"strings"
 	"testing"
 
+	holeapi "treehole_next/apis/hole"
 	. "treehole_next/config"
 	. "treehole_next/models"
 	"treehole_next/utils"
@@ -43,6 +45,30 @@ func TestListHolesByTag(t *testing.T) {
 	assert.EqualValues(t, Holes{}, getHoles)
 }
 
+func TestListHotHoles(t *testing.T) {
+	var ids []int
+	DB.Raw("SELECT id FROM hole WHERE division_id = 6 AND hidden = 0 ORDER BY id").Scan(&ids)
+	for i, id := range ids {
+		DB.Model(&Hole{}).Where("id = ?", id).Update("hot_score", float64(i%3)+0.5)
+	}
+	// hot_score desc, id desc
+	var expected []int
+	DB.Raw("SELECT id FROM hole WHERE division_id = 6 AND hidden = 0 ORDER BY hot_score DESC, id DESC").Scan(&expected)
+
+	var holes Holes
+	testAPIModelWithQuery(t, "get", "/api/divisions/6/holes", 200, &holes, Map{"order": "hot", "size": 4})
+	assert.Equal(t, expected[:4], utils.Models2IDSlice(holes))
+
+	last := holes[len(holes)-1]
+	testAPIModelWithQuery(t, "get", "/api/divisions/6/holes", 200, &holes, Map{
+		"order":        "hot",
+		"size":         4,
+		"score_offset": last.HotScore,
+		"id_offset":    last.ID,
+	})
+	assert.Equal(t, expected[4:8], utils.Models2IDSlice(holes))
+}
+
 func TestCreateHole(t *testing.T) {
 	content := "abcdef"
 	data := Map{"content": content, "tags": []Map{{"name": "a"}, {"name": "ab"}, {"name": "abc"}}}
@@ -140,3 +166,143 @@ func TestHoleStats(t *testing.T) {
 	}
 
 }
+
+func TestMergeHole(t *testing.T) {
+	var target, from Hole
+	data := Map{"content": "merge target", "tags": []Map{{"name": "114"}}}
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &target, data)
+	data = Map{"content": "merge source", "tags": []Map{{"name": "114"}}}
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &from, data)
+	testAPI(t, "post", "/api/holes/"+strconv.Itoa(target.ID)+"/floors", 201, Map{"content": "target reply"})
+	testAPI(t, "post", "/api/holes/"+strconv.Itoa(from.ID)+"/floors", 201, Map{"content": "source reply"})
+
+	url := "/api/holes/" + strconv.Itoa(target.ID) + "/_merge"
+	testAPI(t, "post", url, 400, Map{"from_hole_id": target.ID}) // merge into itself
+	testAPI(t, "post", url, 404, Map{"from_hole_id": largeInt})
+
+	var hole Hole
+	testAPIModel(t, "post", url, 200, &hole, Map{"from_hole_id": from.ID})
+	assert.EqualValues(t, 3, hole.Reply)
+
+	var floors Floors
+	DB.Where("hole_id = ?", target.ID).Order("ranking").Find(&floors)
+	assert.Len(t, floors, 4)
+	for i, floor := range floors {
+		assert.EqualValues(t, i, floor.Ranking)
+	}
+	assert.Equal(t, "source reply", floors[3].Content)
+	// the same user keeps the anonyname in the target hole
+	assert.Equal(t, floors[0].Anonyname, floors[3].Anonyname)
+
+	DB.Take(&from, from.ID)
+	assert.True(t, from.Hidden)
+	floors = nil
+	DB.Where("hole_id = ?", from.ID).Find(&floors)
+	assert.Len(t, floors, 1)
+	assert.Contains(t, floors[0].Content, strconv.Itoa(target.ID))
+}
+
+func TestSplitHole(t *testing.T) {
+	var hole Hole
+	data := Map{"content": "split source", "tags": []Map{{"name": "114"}}}
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &hole, data)
+	floorIDs := make([]int, 4)
+	for i := range floorIDs {
+		var floor Floor
+		testAPIModel(t, "post", "/api/holes/"+strconv.Itoa(hole.ID)+"/floors", 201, &floor, Map{"content": "reply " + strconv.Itoa(i+1)})
+		floorIDs[i] = floor.ID
+	}
+	// floor 3 replies to floor 1, which stays in the hole
+	DB.Model(&Floor{}).Where("id = ?", floorIDs[2]).Update("reply_to", floorIDs[0])
+
+	url := "/api/holes/" + strconv.Itoa(hole.ID) + "/_split"
+	var first Floor
+	DB.Where("hole_id = ? AND ranking = 0", hole.ID).Take(&first)
+	testAPI(t, "post", url, 400, Map{"floor_ids": []int{first.ID}, "division_id": 1}) // first floor
+	testAPI(t, "post", url, 404, Map{"floor_ids": []int{floorIDs[1]}, "division_id": largeInt})
+
+	var newHole Hole
+	testAPIModel(t, "post", url, 201, &newHole, Map{"floor_ids": []int{floorIDs[1], floorIDs[2]}, "division_id": 2})
+	assert.EqualValues(t, 2, newHole.DivisionID)
+	assert.EqualValues(t, 1, newHole.Reply)
+
+	var floors Floors
+	DB.Where("hole_id = ?", newHole.ID).Order("ranking").Find(&floors)
+	assert.Equal(t, []int{floorIDs[1], floorIDs[2]}, utils.Models2IDSlice(floors))
+	assert.EqualValues(t, 0, floors[0].Ranking)
+	assert.EqualValues(t, 0, floors[1].ReplyTo)
+
+	floors = nil
+	DB.Where("hole_id = ?", hole.ID).Order("ranking").Find(&floors)
+	assert.Equal(t, []int{first.ID, floorIDs[0], floorIDs[3]}, utils.Models2IDSlice(floors))
+	for i, floor := range floors {
+		assert.EqualValues(t, i, floor.Ranking)
+	}
+	DB.Take(&hole, hole.ID)
+	assert.EqualValues(t, 2, hole.Reply)
+}
+
+func TestPatchHole(t *testing.T) {
+	var hole Hole
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &hole, Map{"content": "view counting", "tags": []Map{{"name": "view"}}})
+	view := func(userID int) {
+		req, err := http.NewRequest("PATCH", "/api/holes/"+strconv.Itoa(hole.ID), nil)
+		assert.Nil(t, err)
+		req.Header.Add("X-Consumer-Username", strconv.Itoa(userID))
+		res, err := App.Test(req, -1)
+		if assert.Nil(t, err) {
+			assert.Equal(t, 204, res.StatusCode)
+		}
+	}
+
+	// repeat views of a user within the window are counted once
+	view(1)
+	view(1)
+	view(2)
+	holeapi.FlushHoleViews()
+	DB.Take(&hole, hole.ID)
+	assert.Equal(t, 2, hole.View)
+	assert.Equal(t, 2, hole.UniqueView)
+
+	view(1)
+	view(2)
+	holeapi.FlushHoleViews()
+	DB.Take(&hole, hole.ID)
+	assert.Equal(t, 2, hole.View)
+	assert.Equal(t, 2, hole.UniqueView)
+}
+
+func TestSimilarHoles(t *testing.T) {
+	var hole, similar, unrelated Hole
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &hole, Map{"content": "出售二手显示器 九成新 价格可议", "tags": []Map{{"name": "similar"}}})
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &similar, Map{"content": "二手显示器出售 几乎全新", "tags": []Map{{"name": "similar"}}})
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &unrelated, Map{"content": "今天食堂的红烧肉很好吃", "tags": []Map{{"name": "similar"}}})
+
+	var holes Holes
+	testAPIModelWithQuery(t, "get", "/api/holes/"+strconv.Itoa(hole.ID)+"/related", 200, &holes, Map{"size": 5})
+	ids := utils.Models2IDSlice(holes)
+	assert.Contains(t, ids, similar.ID)
+	assert.NotContains(t, ids, hole.ID)
+	assert.NotContains(t, ids, unrelated.ID)
+
+	testAPIModel(t, "post", "/api/holes/_similar", 200, &holes, Map{"content": "有人出二手显示器吗", "tags": []string{"similar"}})
+	ids = utils.Models2IDSlice(holes)
+	assert.Contains(t, ids, hole.ID)
+	assert.Contains(t, ids, similar.ID)
+	assert.NotContains(t, ids, unrelated.ID)
+
+	// hidden holes are not similar
+	DB.Model(&similar).Update("hidden", true)
+	testAPIModel(t, "post", "/api/holes/_similar", 200, &holes, Map{"content": "有人出二手显示器吗"})
+	assert.NotContains(t, utils.Models2IDSlice(holes), similar.ID)
+	DB.Model(&similar).Update("hidden", false)
+
+	// duplicate check
+	data := Map{"content": "出售二手显示器 九成新 价格可议!", "tags": []Map{{"name": "similar"}}, "check_duplicate": true}
+	testAPI(t, "post", "/api/divisions/1/holes", 409, data)
+	data["content"] = "求购二手键盘"
+	testAPI(t, "post", "/api/divisions/1/holes", 201, data)
+	data["content"] = "出售二手显示器 九成新 价格可议!"
+	data["check_duplicate"] = false
+	testAPI(t, "post", "/api/divisions/1/holes", 201, data)
+}
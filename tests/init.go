@@ -91,6 +91,7 @@ func initTestFloors() {
 	holes[3].Floors = Floors{{Content: "123456789"}}                                                       // for TestModify
 	holes[4].Floors = Floors{{Content: "123456789"}}                                                       // for TestModify like
 	holes[5].Floors = Floors{{Content: "123456789", UserID: 1}, {Content: "23333", UserID: 5, Ranking: 1}} // for TestDelete
+	holes[6].Floors = Floors{{Content: "123456789"}}                                                       // for TestFloorReaction
 	err := DB.Create(&holes).Error
 	if err != nil {
 		log.Fatal().Err(err).Send()
@@ -1,9 +1,20 @@
 package tests
 
 import (
+	"bufio"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+
+	"treehole_next/config"
 
 	. "treehole_next/models"
 
@@ -33,8 +44,7 @@ func createTestNotification(t *testing.T, relatedFloorID *int, relatedHoleID *in
 	_, err := notification.Send()
 	assert.NoError(t, err)
 
-	// Send() returns empty Message when NotificationUrl is unset,
-	// so query the last inserted message from DB.
+	// query the last inserted message from DB.
 	var msg Message
 	DB.Last(&msg)
 	assert.NotZero(t, msg.ID)
@@ -135,8 +145,7 @@ func TestSendSensitiveRelatedFloorID(t *testing.T) {
 	_, err := notification.Send()
 	assert.NoError(t, err)
 
-	// Send() returns empty Message when NotificationUrl is unset,
-	// so query the last inserted message from DB.
+	// query the last inserted message from DB.
 	var savedMsg Message
 	DB.Last(&savedMsg)
 	assert.NotZero(t, savedMsg.ID)
@@ -157,3 +166,304 @@ func TestNotificationRelatedFieldsPersisted(t *testing.T) {
 	assert.EqualValues(t, floorID, *savedMsg.RelatedFloorID)
 	assert.EqualValues(t, holeID, *savedMsg.RelatedHoleID)
 }
+
+func TestNotificationOutbox(t *testing.T) {
+	var status, received atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		w.WriteHeader(int(status.Load()))
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	url, retry, maxAttempts := config.Config.NotificationUrl, config.Config.NotificationRetrySeconds, config.Config.NotificationMaxAttempts
+	config.Config.NotificationUrl, config.Config.NotificationRetrySeconds, config.Config.NotificationMaxAttempts = server.URL, 0, 2
+	defer func() {
+		config.Config.NotificationUrl, config.Config.NotificationRetrySeconds, config.Config.NotificationMaxAttempts = url, retry, maxAttempts
+	}()
+
+	// the notification service being down does not fail sending
+	message, err := Notification{
+		Title:       "outbox",
+		Description: "outbox test",
+		Type:        MessageTypeMail,
+		URL:         "/api/messages",
+		Recipients:  []int{testNotificationUserID},
+	}.Send()
+	assert.NoError(t, err)
+	assert.NotZero(t, message.ID)
+
+	var entry NotificationOutbox
+	err = DB.Where("message_id = ?", message.ID).Take(&entry).Error
+	assert.NoError(t, err)
+	assert.Equal(t, "outbox", entry.Payload.Title)
+
+	// dead-lettered after max attempts
+	assert.Eventually(t, func() bool {
+		_, _ = DeliverNotifications()
+		DB.Take(&entry, entry.ID)
+		return entry.Status == OutboxStatusDead
+	}, time.Second*5, time.Millisecond*10)
+	assert.Equal(t, 2, entry.Attempts)
+	assert.NotEmpty(t, entry.LastError)
+	assert.EqualValues(t, 2, received.Load())
+
+	var entries NotificationOutboxes
+	testAPIModelWithQuery(t, "get", "/api/messages/_outbox", 200, &entries, Map{"status": "dead"})
+	if assert.NotEmpty(t, entries) {
+		assert.Equal(t, entry.ID, entries[0].ID)
+	}
+
+	// replay, delivered entries are removed
+	status.Store(http.StatusCreated)
+	testAPI(t, "post", "/api/messages/_outbox/_replay", 200, Map{"ids": []int{entry.ID}})
+	assert.Eventually(t, func() bool {
+		_, _ = DeliverNotifications()
+		var count int64
+		DB.Model(&NotificationOutbox{}).Where("id = ?", entry.ID).Count(&count)
+		return count == 0
+	}, time.Second*5, time.Millisecond*10)
+	assert.EqualValues(t, 3, received.Load())
+}
+
+func TestMessageReadState(t *testing.T) {
+	setNotify(t, []string{"reply"})
+	defer setNotify(t, nil)
+
+	unreadCount := func() UnreadCount {
+		var count UnreadCount
+		err := json.Unmarshal(testCommon(t, "get", "/api/messages/_unread_count", 200), &count)
+		assert.NoError(t, err)
+		return count
+	}
+	testAPI(t, "post", "/api/messages/_mark", 200, Map{"has_read": true})
+	assert.Equal(t, 0, unreadCount().Total)
+
+	send := func(messageType MessageType) Message {
+		message, err := Notification{
+			Title:       "read state",
+			Description: "read state test",
+			Type:        messageType,
+			URL:         "/api/messages",
+			Recipients:  []int{1},
+		}.Send()
+		assert.NoError(t, err)
+		return message
+	}
+	mail := send(MessageTypeMail)
+	send(MessageTypeMail)
+	send(MessageTypeReply)
+
+	count := unreadCount()
+	assert.Equal(t, 3, count.Total)
+	assert.Equal(t, 2, count.Types[MessageTypeMail])
+	assert.Equal(t, 1, count.Types[MessageTypeReply])
+
+	var messages Messages
+	testAPIModelWithQuery(t, "get", "/api/messages", 200, &messages, Map{"not_read": true, "type": "mail"})
+	assert.Len(t, messages, 2)
+
+	// single message
+	testAPI(t, "patch", "/api/messages/"+strconv.Itoa(mail.ID), 204, Map{"has_read": true})
+	// marking again changes nothing but the message exists
+	testAPI(t, "patch", "/api/messages/"+strconv.Itoa(mail.ID), 204, Map{"has_read": true})
+	testAPI(t, "patch", "/api/messages/"+strconv.Itoa(mail.ID+100000), 404, Map{"has_read": true})
+	testAPI(t, "patch", "/api/messages/"+strconv.Itoa(mail.ID), 400, Map{})
+	assert.Equal(t, 1, unreadCount().Types[MessageTypeMail])
+	testAPIModelWithQuery(t, "get", "/api/messages", 200, &messages, Map{"type": "mail"})
+	for _, message := range messages {
+		if message.ID == mail.ID {
+			assert.True(t, message.HasRead)
+		}
+	}
+	testAPI(t, "patch", "/api/messages/"+strconv.Itoa(mail.ID), 204, Map{"has_read": false})
+	assert.Equal(t, 2, unreadCount().Types[MessageTypeMail])
+
+	// by type
+	testAPI(t, "post", "/api/messages/_mark", 200, Map{"type": "mail", "has_read": true})
+	count = unreadCount()
+	assert.Equal(t, 1, count.Total)
+	assert.Zero(t, count.Types[MessageTypeMail])
+
+	testAPI(t, "post", "/api/messages/clear", 204)
+	assert.Equal(t, 0, unreadCount().Total)
+}
+
+func TestStreamMessages(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	go func() {
+		_ = App.Listener(listener)
+	}()
+	defer listener.Close()
+
+	user := User{ID: 1}
+	DB.FirstOrCreate(&user, user)
+	send := func(description string) Message {
+		message, err := Notification{
+			Title:       "stream",
+			Description: description,
+			Type:        MessageTypeMail,
+			URL:         "/api/messages",
+			Recipients:  []int{1},
+		}.Send()
+		assert.NoError(t, err)
+		return message
+	}
+	missed := send("missed")
+
+	// resume from the message before the missed one
+	req, err := http.NewRequest("GET", "http://"+listener.Addr().String()+"/api/messages/_stream", nil)
+	assert.NoError(t, err)
+	req.Header.Add("X-Consumer-Username", "1")
+	req.Header.Add("Last-Event-ID", strconv.Itoa(missed.ID-1))
+	res, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer res.Body.Close()
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	events := make(chan Message)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			data, found := strings.CutPrefix(scanner.Text(), "data: ")
+			if !found {
+				continue
+			}
+			var message Message
+			if json.Unmarshal([]byte(data), &message) == nil {
+				events <- message
+			}
+		}
+	}()
+	receive := func() Message {
+		select {
+		case message, ok := <-events:
+			assert.True(t, ok, "stream closed")
+			return message
+		case <-time.After(time.Second * 5):
+			t.Error("no message received")
+			return Message{}
+		}
+	}
+
+	assert.Equal(t, missed.ID, receive().ID)
+	live := send("live")
+	message := receive()
+	assert.Equal(t, live.ID, message.ID)
+	assert.Equal(t, "live", message.Description)
+	assert.Equal(t, live.ID, message.MessageID)
+
+	// messages of other users are not streamed
+	_, err = Notification{
+		Title:       "stream",
+		Description: "other",
+		Type:        MessageTypeMail,
+		Recipients:  []int{testNotificationUserID},
+	}.Send()
+	assert.NoError(t, err)
+	live = send("live again")
+	assert.Equal(t, live.ID, receive().ID)
+}
+
+func TestDigest(t *testing.T) {
+	setNotify(t, []string{"reply", "favorite"})
+	defer setNotify(t, nil)
+
+	testAPI(t, "put", "/api/users/me", 400, Map{"config": Map{"digest": Map{"mail": "daily"}}})
+	testAPI(t, "put", "/api/users/me", 400, Map{"config": Map{"digest": Map{"reply": "monthly"}}})
+	var user User
+	testAPIModel(t, "put", "/api/users/me", 200, &user, Map{"config": Map{"digest": Map{"reply": "daily", "favorite": "hourly"}}})
+	assert.Equal(t, map[MessageType]DigestPeriod{MessageTypeReply: DigestDaily, MessageTypeFavorite: DigestHourly}, user.Config.Digest)
+	defer testAPI(t, "put", "/api/users/me", 200, Map{"config": Map{"digest": Map{"reply": "immediate", "favorite": "immediate"}}})
+
+	var hole, other Hole
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &hole, Map{"content": "摘要测试", "tags": []Map{{"name": "digest"}}})
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &other, Map{"content": "摘要测试 另一个", "tags": []Map{{"name": "digest"}}})
+	var floor, otherFloor Floor
+	DB.Where("hole_id = ?", hole.ID).First(&floor)
+	DB.Where("hole_id = ?", other.ID).First(&otherFloor)
+
+	countMessages := func(messageType MessageType) int64 {
+		var count int64
+		DB.Model(&MessageUser{}).Joins("JOIN message ON message.id = message_user.message_id").
+			Where("message_user.user_id = 1 AND message.type = ?", messageType).Count(&count)
+		return count
+	}
+	replies, digests := countMessages(MessageTypeReply), countMessages(MessageTypeDigest)
+	DB.Where("user_id = 1").Delete(&DigestItem{})
+
+	// listed but queued instead of pushed
+	url := config.Config.NotificationUrl
+	config.Config.NotificationUrl = "http://notification.invalid"
+	for _, notification := range []Notification{
+		{Title: "回复", Description: "第一条回复", Type: MessageTypeReply, Recipients: []int{1}, RelatedFloorID: &floor.ID},
+		{Title: "回复", Description: "第二条回复", Type: MessageTypeReply, Recipients: []int{1}, RelatedFloorID: &floor.ID},
+		{Title: "关注", Description: "关注的帖子有新回复", Type: MessageTypeFavorite, Recipients: []int{1}, RelatedFloorID: &otherFloor.ID},
+	} {
+		message, err := notification.Send()
+		assert.NoError(t, err)
+		var outboxes int64
+		DB.Model(&NotificationOutbox{}).Where("message_id = ?", message.ID).Count(&outboxes)
+		assert.Zero(t, outboxes)
+	}
+	config.Config.NotificationUrl = url
+	assert.Equal(t, replies+2, countMessages(MessageTypeReply))
+	var items []DigestItem
+	DB.Where("user_id = 1").Order("id").Find(&items)
+	if assert.Len(t, items, 3) {
+		assert.Equal(t, hole.ID, items[0].HoleID)
+		assert.Equal(t, NextDigestTime(DigestDaily, items[0].CreatedAt).Unix(), items[0].DueAt.Unix())
+		assert.Equal(t, DigestHourly, items[2].Period)
+	}
+
+	// not due yet
+	assert.NoError(t, SendDueDigests(time.Now()))
+	assert.Equal(t, digests, countMessages(MessageTypeDigest))
+
+	// one digest grouped by hole, the latest first
+	assert.NoError(t, SendDueDigests(time.Now().AddDate(0, 0, 8)))
+	assert.Equal(t, digests+1, countMessages(MessageTypeDigest))
+	var message Message
+	DB.Where("type = ?", MessageTypeDigest).Last(&message)
+	assert.Contains(t, message.Title, "3 条新通知")
+	var groups []DigestGroup
+	data, _ := json.Marshal(message.Data)
+	assert.NoError(t, json.Unmarshal(data, &groups))
+	if assert.Len(t, groups, 2) {
+		assert.Equal(t, other.ID, groups[0].HoleID)
+		assert.Equal(t, hole.ID, groups[1].HoleID)
+		assert.Equal(t, 2, groups[1].Types[MessageTypeReply])
+		assert.Equal(t, "第二条回复", groups[1].Description)
+	}
+	var count int64
+	DB.Model(&DigestItem{}).Where("user_id = 1").Count(&count)
+	assert.Zero(t, count)
+
+	// queued items of deleted floors are not sent
+	_, err := Notification{Title: "回复", Description: "将被删除的回复", Type: MessageTypeReply, Recipients: []int{1}, RelatedFloorID: &floor.ID}.Send()
+	assert.NoError(t, err)
+	DB.Model(&DigestItem{}).Where("user_id = 1").Count(&count)
+	assert.EqualValues(t, 1, count)
+	testAPI(t, "delete", "/api/floors/"+strconv.Itoa(floor.ID), 200, Map{"delete_reason": "test"})
+	DB.Model(&DigestItem{}).Where("user_id = 1").Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestNextDigestTime(t *testing.T) {
+	// Wednesday
+	now := time.Date(2026, 10, 14, 9, 30, 0, 0, time.Local)
+	assert.Equal(t, time.Date(2026, 10, 14, 10, 0, 0, 0, time.Local), NextDigestTime(DigestHourly, now))
+	assert.Equal(t, time.Date(2026, 10, 15, 8, 0, 0, 0, time.Local), NextDigestTime(DigestDaily, now))
+	assert.Equal(t, time.Date(2026, 10, 19, 8, 0, 0, 0, time.Local), NextDigestTime(DigestWeekly, now))
+	early := time.Date(2026, 10, 19, 7, 0, 0, 0, time.Local)
+	assert.Equal(t, time.Date(2026, 10, 19, 8, 0, 0, 0, time.Local), NextDigestTime(DigestDaily, early))
+	assert.Equal(t, time.Date(2026, 10, 19, 8, 0, 0, 0, time.Local), NextDigestTime(DigestWeekly, early))
+	assert.Equal(t, now, NextDigestTime(DigestImmediate, now))
+}
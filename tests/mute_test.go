@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	. "treehole_next/models"
+)
+
+func TestMute(t *testing.T) {
+	var hole Hole
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &hole, Map{"content": "屏蔽通知", "tags": []Map{{"name": "mute"}}})
+	var mentioned Floor
+	DB.Where("hole_id = ?", hole.ID).First(&mentioned)
+	DB.Exec("INSERT INTO user_subscription (user_id, hole_id) VALUES (?, ?)", 1, hole.ID)
+
+	// a floor of another user replying to, mentioning and in the subscription of user 1
+	floor := Floor{HoleID: hole.ID, UserID: testNotificationUserID, Mention: Floors{&mentioned}}
+	recipients := func() (reply, mention, subscription []int) {
+		return floor.SendReply(DB).Recipients, floor.SendMention(DB).Recipients, floor.SendSubscription(DB).Recipients
+	}
+	reply, mention, subscription := recipients()
+	assert.Equal(t, []int{1}, reply)
+	assert.Equal(t, []int{1}, mention)
+	assert.Contains(t, subscription, 1)
+
+	testAPI(t, "post", "/api/users/me/mutes", 400, Map{})
+	testAPI(t, "post", "/api/users/me/mutes", 400, Map{"hole_id": hole.ID, "floor_id": mentioned.ID})
+	testAPI(t, "post", "/api/users/me/mutes", 400, Map{"hole_id": hole.ID, "time_expires": time.Now().Add(-time.Hour)})
+	testAPI(t, "post", "/api/users/me/mutes", 404, Map{"hole_id": 1 << 30})
+
+	// muting the floor stops mentions only
+	var floorMute UserMute
+	testAPIModel(t, "post", "/api/users/me/mutes", 201, &floorMute, Map{"floor_id": mentioned.ID})
+	assert.Equal(t, mentioned.ID, floorMute.FloorID)
+	assert.Nil(t, floorMute.ExpiresAt)
+	reply, mention, _ = recipients()
+	assert.Equal(t, []int{1}, reply)
+	assert.Empty(t, mention)
+	testAPI(t, "delete", "/api/users/me/mutes/"+strconv.Itoa(floorMute.ID), 204)
+	testAPI(t, "delete", "/api/users/me/mutes/"+strconv.Itoa(floorMute.ID), 404)
+
+	// muting the hole stops all of them
+	var holeMute UserMute
+	testAPIModel(t, "post", "/api/users/me/mutes", 201, &holeMute, Map{"hole_id": hole.ID})
+	reply, mention, subscription = recipients()
+	assert.Empty(t, reply)
+	assert.Empty(t, mention)
+	assert.NotContains(t, subscription, 1)
+
+	var mutes UserMutes
+	testAPIModel(t, "get", "/api/users/me/mutes", 200, &mutes)
+	if assert.Len(t, mutes, 1) {
+		assert.Equal(t, holeMute.ID, mutes[0].ID)
+	}
+
+	// muting again updates the expiry, expired mutes are ignored and not listed
+	var updated UserMute
+	testAPIModel(t, "post", "/api/users/me/mutes", 201, &updated, Map{"hole_id": hole.ID, "time_expires": time.Now().Add(time.Hour)})
+	assert.Equal(t, holeMute.ID, updated.ID)
+	assert.NotNil(t, updated.ExpiresAt)
+
+	// at the limit, existing mutes can still be updated
+	fillers := make([]UserMute, 0, UserMuteLimit-1)
+	for i := 1; i < UserMuteLimit; i++ {
+		fillers = append(fillers, UserMute{UserID: 1, HoleID: 1<<30 + i})
+	}
+	DB.Create(&fillers)
+	testAPI(t, "post", "/api/users/me/mutes", 201, Map{"hole_id": hole.ID, "time_expires": time.Now().Add(2 * time.Hour)})
+	testAPI(t, "post", "/api/users/me/mutes", 403, Map{"floor_id": mentioned.ID})
+	DB.Where("user_id = ? AND hole_id > ?", 1, 1<<30).Delete(&UserMute{})
+	DB.Model(&UserMute{}).Where("id = ?", holeMute.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	reply, mention, subscription = recipients()
+	assert.Equal(t, []int{1}, reply)
+	assert.Equal(t, []int{1}, mention)
+	assert.Contains(t, subscription, 1)
+	testAPIModel(t, "get", "/api/users/me/mutes", 200, &mutes)
+	assert.Empty(t, mutes)
+
+	DB.Where("user_id = ?", 1).Delete(&UserMute{})
+	DB.Exec("DELETE FROM user_subscription WHERE user_id = ? AND hole_id = ?", 1, hole.ID)
+}
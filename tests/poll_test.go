@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+
+	. "treehole_next/models"
+)
+
+func createPollHole(t *testing.T, poll Map) Hole {
+	data := Map{"content": "which canteen is better", "tags": []Map{{"name": "114"}}, "poll": poll}
+	var hole Hole
+	err := json.Unmarshal(testCommon(t, "post", "/api/divisions/1/holes", 201, data), &hole)
+	assert.Nil(t, err)
+	return hole
+}
+
+func TestCreatePoll(t *testing.T) {
+	hole := createPollHole(t, Map{"options": []string{"A", "B", "C"}})
+	if assert.NotNil(t, hole.Poll) {
+		assert.EqualValues(t, PollTypeSingle, hole.Poll.Type)
+		assert.EqualValues(t, 3, len(hole.Poll.Options))
+		assert.EqualValues(t, "A", hole.Poll.Options[0].Content)
+		assert.False(t, hole.Poll.Voted)
+	}
+
+	// at least two options
+	data := Map{"content": "poll", "tags": []Map{{"name": "114"}}, "poll": Map{"options": []string{"A"}}}
+	testAPI(t, "post", "/api/divisions/1/holes", 400, data)
+
+	// deadline in the past
+	data["poll"] = Map{"options": []string{"A", "B"}, "deadline": "2000-01-01T00:00:00Z"}
+	testAPI(t, "post", "/api/divisions/1/holes", 400, data)
+}
+
+func TestVotePoll(t *testing.T) {
+	hole := createPollHole(t, Map{"options": []string{"A", "B", "C"}, "type": "multiple"})
+	route := "/api/holes/" + strconv.Itoa(hole.ID) + "/poll"
+	options := hole.Poll.Options
+
+	var poll Poll
+	testAPIModel(t, "post", route+"/votes", 201, &poll, Map{"option_ids": []int{options[0].ID, options[2].ID}})
+	assert.True(t, poll.Voted)
+	assert.EqualValues(t, 1, poll.VoterCount)
+	assert.EqualValues(t, 1, poll.Options[0].VoteCount)
+	assert.EqualValues(t, 0, poll.Options[1].VoteCount)
+	assert.True(t, poll.Options[2].Voted)
+
+	// vote only once
+	testAPI(t, "post", route+"/votes", 400, Map{"option_ids": []int{options[1].ID}})
+
+	// poll is returned with the hole
+	var getHole Hole
+	testAPIModel(t, "get", "/api/holes/"+strconv.Itoa(hole.ID), 200, &getHole)
+	if assert.NotNil(t, getHole.Poll) {
+		assert.EqualValues(t, 1, getHole.Poll.VoterCount)
+	}
+
+	// single choice accepts exactly one option
+	single := createPollHole(t, Map{"options": []string{"A", "B"}})
+	singleRoute := "/api/holes/" + strconv.Itoa(single.ID) + "/poll/votes"
+	testAPI(t, "post", singleRoute, 400, Map{"option_ids": []int{single.Poll.Options[0].ID, single.Poll.Options[1].ID}})
+	testAPI(t, "post", singleRoute, 400, Map{"option_ids": []int{options[0].ID}}) // option of another poll
+}
+
+func TestModifyPoll(t *testing.T) {
+	hole := createPollHole(t, Map{"options": []string{"A", "B"}})
+	route := "/api/holes/" + strconv.Itoa(hole.ID)
+
+	// close
+	testAPI(t, "put", route, 200, Map{"close_poll": true})
+	var poll Poll
+	testAPIModel(t, "get", route+"/poll", 200, &poll)
+	assert.True(t, poll.Closed)
+	testAPI(t, "post", route+"/poll/votes", 403, Map{"option_ids": []int{poll.Options[0].ID}})
+
+	// delete
+	testAPI(t, "put", route, 200, Map{"delete_poll": true})
+	testAPI(t, "get", route+"/poll", 404)
+	var count int64
+	DB.Model(&PollOption{}).Where("poll_id = ?", poll.ID).Count(&count)
+	assert.EqualValues(t, 0, count)
+}
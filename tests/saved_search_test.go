@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"treehole_next/apis/savedsearch"
+	"treehole_next/config"
+	. "treehole_next/models"
+)
+
+func setNotify(t *testing.T, notify []string) {
+	user := User{ID: 1}
+	DB.FirstOrCreate(&user, user)
+	err := DB.Model(&user).Select("Config").Updates(User{Config: UserConfig{Notify: notify}}).Error
+	assert.Nil(t, err)
+}
+
+func TestSavedSearch(t *testing.T) {
+	// the default config of existing users, saved_search is not listed but sent
+	setNotify(t, []string{"mention", "favorite", "report"})
+	defer setNotify(t, nil)
+
+	var savedSearch SavedSearch
+	testAPIModel(t, "post", "/api/users/me/saved_searches", 201, &savedSearch, Map{"query": "保存搜索 显示器"})
+	assert.Equal(t, "保存搜索 显示器", savedSearch.Query)
+	testAPI(t, "post", "/api/users/me/saved_searches", 400, Map{"query": `保存搜索 "unclosed`})
+
+	// floors of the owner are not notified, nor floors not matched
+	var own, other, unmatched Hole
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &own, Map{"content": "保存搜索 自己的显示器", "tags": []Map{{"name": "search"}}})
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &other, Map{"content": "保存搜索 出二手显示器", "tags": []Map{{"name": "search"}}})
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &unmatched, Map{"content": "保存搜索 出二手键盘", "tags": []Map{{"name": "search"}}})
+	var floor Floor
+	DB.Where("hole_id = ?", other.ID).First(&floor)
+	DB.Model(&floor).Update("user_id", testNotificationUserID)
+
+	countMessages := func() int64 {
+		var count int64
+		DB.Model(&Message{}).Where("type = ?", MessageTypeSavedSearch).Count(&count)
+		return count
+	}
+	before := countMessages()
+	maxFloorID, err := MaxFloorID(DB)
+	assert.Nil(t, err)
+	assert.Nil(t, savedsearch.RunSavedSearches(context.Background(), maxFloorID))
+
+	if assert.EqualValues(t, before+1, countMessages()) {
+		var message Message
+		DB.Where("type = ?", MessageTypeSavedSearch).Last(&message)
+		if assert.NotNil(t, message.RelatedFloorID) {
+			assert.Equal(t, floor.ID, *message.RelatedFloorID)
+		}
+		var recipient MessageUser
+		DB.Where("message_id = ?", message.ID).First(&recipient)
+		assert.Equal(t, 1, recipient.UserID)
+	}
+	DB.First(&savedSearch, savedSearch.ID)
+	assert.Equal(t, maxFloorID, savedSearch.LastFloorID)
+	assert.Equal(t, 1, savedSearch.LastMatchCount)
+	assert.NotNil(t, savedSearch.LastRunAt)
+
+	// matched floors are not notified again
+	assert.Nil(t, savedsearch.RunSavedSearches(context.Background(), maxFloorID))
+	assert.EqualValues(t, before+1, countMessages())
+
+	// all floors in the window are found, more than a page of hits
+	var many Hole
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &many, Map{"content": "保存搜索 很多显示器", "tags": []Map{{"name": "search"}}})
+	for i := 0; i < 55; i++ {
+		testAPI(t, "post", "/api/holes/"+strconv.Itoa(many.ID)+"/floors", 201, Map{"content": "保存搜索 第" + strconv.Itoa(i) + "个显示器"})
+	}
+	DB.Model(&Floor{}).Where("hole_id = ?", many.ID).Update("user_id", testNotificationUserID)
+	maxFloorID, _ = MaxFloorID(DB)
+	// floors after maxFloorID are left to the next run
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &other, Map{"content": "保存搜索 下次的显示器", "tags": []Map{{"name": "search"}}})
+	DB.Model(&Floor{}).Where("hole_id = ?", other.ID).Update("user_id", testNotificationUserID)
+	assert.Nil(t, savedsearch.RunSavedSearches(context.Background(), maxFloorID))
+	assert.EqualValues(t, before+2, countMessages())
+	DB.First(&savedSearch, savedSearch.ID)
+	assert.Equal(t, 56, savedSearch.LastMatchCount)
+	assert.Equal(t, maxFloorID, savedSearch.LastFloorID)
+
+	// respect config.notify_off
+	testAPI(t, "put", "/api/users/me", 200, Map{"config": Map{"notify_off": []string{"saved_search"}}})
+	testAPIModel(t, "post", "/api/divisions/1/holes", 201, &other, Map{"content": "保存搜索 再出一个显示器", "tags": []Map{{"name": "search"}}})
+	DB.Model(&Floor{}).Where("hole_id = ?", other.ID).Update("user_id", testNotificationUserID)
+	maxFloorID, _ = MaxFloorID(DB)
+	assert.Nil(t, savedsearch.RunSavedSearches(context.Background(), maxFloorID))
+	assert.EqualValues(t, before+2, countMessages())
+	DB.First(&savedSearch, savedSearch.ID)
+	assert.Equal(t, 2, savedSearch.LastMatchCount)
+
+	// limit
+	limit := config.Config.SavedSearchLimit
+	config.Config.SavedSearchLimit = 2
+	testAPI(t, "post", "/api/users/me/saved_searches", 201, Map{"query": "tag:search 显示器"})
+	testAPI(t, "post", "/api/users/me/saved_searches", 403, Map{"query": "键盘"})
+	config.Config.SavedSearchLimit = limit
+
+	var savedSearches SavedSearches
+	testAPIModel(t, "get", "/api/users/me/saved_searches", 200, &savedSearches)
+	assert.Len(t, savedSearches, 2)
+
+	testAPI(t, "delete", "/api/users/me/saved_searches/"+strconv.Itoa(savedSearch.ID), 204)
+	testAPI(t, "delete", "/api/users/me/saved_searches/"+strconv.Itoa(savedSearch.ID), 404)
+}
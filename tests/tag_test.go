@@ -4,6 +4,9 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/goccy/go-json"
+
+	"treehole_next/config"
 	. "treehole_next/models"
 
 	"github.com/stretchr/testify/assert"
@@ -79,3 +82,54 @@ func TestDeleteTag(t *testing.T) {
 	data["to"] = "iii555"
 	testAPI(t, "delete", "/api/tags/"+strconv.Itoa(id), 404, data)
 }
+
+func TestAutocompleteTags(t *testing.T) {
+	sensitive := true
+	tags := Tags{
+		{Name: "自动补全", Temperature: 100},
+		{Name: "自动驾驶", Temperature: 200},
+		{Name: "补全测试", Temperature: 5},
+		{Name: "自动敏感", Temperature: 300, IsActualSensitive: &sensitive},
+	}
+	DB.Create(&tags)
+	UpdateTagCache(nil)
+
+	autocomplete := func(search string) []string {
+		var result Tags
+		err := json.Unmarshal(testCommonQuery(t, "get", "/api/tags/_autocomplete", 200, Map{"s": search}), &result)
+		assert.Nil(t, err)
+		names := make([]string, len(result))
+		for i, tag := range result {
+			names[i] = tag.Name
+		}
+		return names
+	}
+
+	// hotter tags first, sensitive names are hidden from everyone
+	assert.Equal(t, []string{"", "自动驾驶", "自动补全"}, autocomplete("自动"))
+	assert.Equal(t, []string{"补全测试", "自动补全"}, autocomplete("补全"))
+	assert.Equal(t, []string{"自动补全"}, autocomplete("zidongbu"))
+	assert.Equal(t, []string{"自动补全"}, autocomplete("zdbq"))
+	assert.Equal(t, []string{"自动补全"}, autocomplete("自东补全"))
+	testAPI(t, "get", "/api/tags/_autocomplete", 400)
+
+	// sensitive and admin-only tags are excluded for non-admins
+	adminOnlyTagIDs := config.Config.AdminOnlyTagIds
+	config.Config.AdminOnlyTagIds = []int{tags[1].ID}
+	result, err := SuggestTags(&User{}, "自动", 10)
+	config.Config.AdminOnlyTagIds = adminOnlyTagIDs
+	if assert.Nil(t, err) && assert.Len(t, result, 1) {
+		assert.Equal(t, "自动补全", result[0].Name)
+	}
+
+	// similar tags are suggested before creating if asked
+	data := Map{"content": "similar tag", "tags": []Map{{"name": "自动布全"}}, "check_similar_tags": true}
+	response := testAPI(t, "post", "/api/divisions/1/holes", 409, data)
+	detail, _ := response["detail"].([]any)
+	if assert.Len(t, detail, 1) {
+		assert.Equal(t, "自动补全", detail[0].(map[string]any)["param"])
+	}
+	// existing clients are not affected
+	delete(data, "check_similar_tags")
+	testAPI(t, "post", "/api/divisions/1/holes", 201, data)
+}
@@ -20,6 +20,12 @@ import (
 
 var Cache *cache.Cache[any]
 
+// Redis is the client of config.Config.RedisURL, nil if redis is not in use
+var Redis *redis.Client
+
+// goCache is the in-memory store of Cache if redis is not in use
+var goCache *gocache.Cache
+
 func InitCache() {
 	if config.Config.RedisURL == "" {
 		useGoCache()
@@ -37,6 +43,7 @@ func InitCache() {
 		useGoCache()
 		return
 	}
+	Redis = redisClient
 	Cache = cache.New[any](redis_store.NewRedis(redisClient))
 }
 
@@ -52,8 +59,8 @@ func newRedisClient(redisURL string) (*redis.Client, error) {
 }
 
 func useGoCache() {
-	gocacheStore := gocache_store.NewGoCache(gocache.New(5*time.Minute, 10*time.Minute))
-	Cache = cache.New[any](gocacheStore)
+	goCache = gocache.New(5*time.Minute, 10*time.Minute)
+	Cache = cache.New[any](gocache_store.NewGoCache(goCache))
 }
 
 const maxDuration time.Duration = 1<<63 - 1
@@ -69,6 +76,21 @@ func SetCache(key string, value any, expiration time.Duration) error {
 	return Cache.Set(context.Background(), key, data, store.WithExpiration(expiration))
 }
 
+// SetCacheIfAbsent sets the value atomically only if the key does not exist, returns whether it is set
+func SetCacheIfAbsent(key string, value any, expiration time.Duration) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	if expiration == 0 {
+		expiration = maxDuration
+	}
+	if Redis != nil {
+		return Redis.SetNX(context.Background(), key, data, expiration).Result()
+	}
+	return goCache.Add(key, data, expiration) == nil, nil
+}
+
 // GetCache gets a value from cache by key and unmarshals it into value (must be a pointer).
 // It supports both Redis store (returns string) and go-cache store (returns []byte).
 // Returns true if the key exists and JSON unmarshal succeeds, false otherwise.
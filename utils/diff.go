@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"treehole_next/utils/search"
+)
+
+type DiffType string
+
+const (
+	DiffEqual  DiffType = "equal"
+	DiffInsert DiffType = "insert"
+	DiffDelete DiffType = "delete"
+)
+
+// DiffSegment is a piece of text that is kept, inserted or deleted
+type DiffSegment struct {
+	Type DiffType `json:"type"`
+	Text string   `json:"text"`
+}
+
+// maxDiffEdits bounds the work of diffTokens,
+// texts with more edits are treated as entirely replaced
+const maxDiffEdits = 2000
+
+// DiffLines returns the line level diff from a to b, line breaks are kept in segments
+func DiffLines(a, b string) []DiffSegment {
+	return diffTokens(splitLines(a), splitLines(b))
+}
+
+// DiffWords returns the word level diff from a to b,
+// a CJK character is a word, so is a run of other letters or digits
+func DiffWords(a, b string) []DiffSegment {
+	return diffTokens(splitWords(a), splitWords(b))
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func splitWords(s string) []string {
+	var tokens []string
+	runes := []rune(s)
+	for start := 0; start < len(runes); {
+		end := start + 1
+		switch r := runes[start]; {
+		case unicode.IsSpace(r):
+			for end < len(runes) && unicode.IsSpace(runes[end]) {
+				end++
+			}
+		case search.IsWordRune(r):
+			for end < len(runes) && search.IsWordRune(runes[end]) {
+				end++
+			}
+		}
+		tokens = append(tokens, string(runes[start:end]))
+		start = end
+	}
+	return tokens
+}
+
+// diffTokens finds the shortest edit script with the Myers algorithm
+func diffTokens(a, b []string) []DiffSegment {
+	segments := make([]DiffSegment, 0)
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	segments = appendSegment(segments, DiffEqual, a[:prefix]...)
+	segments = append(segments, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	return appendSegment(segments, DiffEqual, a[len(a)-suffix:]...)
+}
+
+func myers(a, b []string) []DiffSegment {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return appendSegment(appendSegment(nil, DiffDelete, a...), DiffInsert, b...)
+	}
+
+	// v[offset+k] is the furthest x on diagonal k, trace[d] keeps v[-d..d] before step d
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	var trace [][]int
+	found := false
+	for d := 0; d <= n+m && d <= maxDiffEdits && !found; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return appendSegment(appendSegment(nil, DiffDelete, a...), DiffInsert, b...)
+	}
+
+	// backtrack from (n, m), collecting edits in reverse
+	type edit struct {
+		Type  DiffType
+		Token string
+	}
+	var edits []edit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		if d == 0 {
+			for x > 0 && y > 0 {
+				edits = append(edits, edit{DiffEqual, a[x-1]})
+				x--
+				y--
+			}
+			break
+		}
+
+		prev := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && prev[k-1+d] < prev[k+1+d]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := prev[prevK+d]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			edits = append(edits, edit{DiffEqual, a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			edits = append(edits, edit{DiffInsert, b[y-1]})
+		} else {
+			edits = append(edits, edit{DiffDelete, a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+
+	var segments []DiffSegment
+	for i := len(edits) - 1; i >= 0; i-- {
+		segments = appendSegment(segments, edits[i].Type, edits[i].Token)
+	}
+	return segments
+}
+
+// appendSegment appends tokens to segments, merging into the last segment of the same type
+func appendSegment(segments []DiffSegment, diffType DiffType, tokens ...string) []DiffSegment {
+	if len(tokens) == 0 {
+		return segments
+	}
+	text := strings.Join(tokens, "")
+	if len(segments) > 0 && segments[len(segments)-1].Type == diffType {
+		segments[len(segments)-1].Text += text
+		return segments
+	}
+	return append(segments, DiffSegment{Type: diffType, Text: text})
+}
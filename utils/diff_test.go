@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// applyDiff rebuilds both sides of a diff
+func applyDiff(segments []DiffSegment) (from, to string) {
+	var a, b strings.Builder
+	for _, segment := range segments {
+		if segment.Type != DiffInsert {
+			a.WriteString(segment.Text)
+		}
+		if segment.Type != DiffDelete {
+			b.WriteString(segment.Text)
+		}
+	}
+	return a.String(), b.String()
+}
+
+func TestDiffLines(t *testing.T) {
+	a := "first\nsecond\nthird\n"
+	b := "first\n2nd\nthird\nfourth\n"
+	assert.Equal(t, []DiffSegment{
+		{DiffEqual, "first\n"},
+		{DiffDelete, "second\n"},
+		{DiffInsert, "2nd\n"},
+		{DiffEqual, "third\n"},
+		{DiffInsert, "fourth\n"},
+	}, DiffLines(a, b))
+
+	assert.Equal(t, []DiffSegment{{DiffEqual, a}}, DiffLines(a, a))
+	assert.Equal(t, []DiffSegment{{DiffInsert, b}}, DiffLines("", b))
+	assert.Equal(t, []DiffSegment{}, DiffLines("", ""))
+}
+
+func TestDiffWords(t *testing.T) {
+	assert.Equal(t, []string{"hello", ",", " ", "world", " ", "你", "好", "123"}, splitWords("hello, world 你好123"))
+
+	segments := DiffWords("the quick brown fox", "the slow brown dog")
+	assert.Equal(t, []DiffSegment{
+		{DiffEqual, "the "},
+		{DiffDelete, "quick"},
+		{DiffInsert, "slow"},
+		{DiffEqual, " brown "},
+		{DiffDelete, "fox"},
+		{DiffInsert, "dog"},
+	}, segments)
+
+	a := "愿中国青年都摆脱冷气，只是向上走"
+	b := "愿中国青年摆脱冷气，只是向上走，不必听自暴自弃者流的话"
+	from, to := applyDiff(DiffWords(a, b))
+	assert.Equal(t, a, from)
+	assert.Equal(t, b, to)
+}
+
+func TestDiffTooManyEdits(t *testing.T) {
+	a := strings.Repeat("a\n", maxDiffEdits+1)
+	b := strings.Repeat("b\n", maxDiffEdits+1)
+	segments := DiffLines(a, b)
+	assert.Len(t, segments, 2)
+	assert.Equal(t, DiffSegment{DiffDelete, a}, segments[0])
+	assert.Equal(t, DiffSegment{DiffInsert, b}, segments[1])
+}
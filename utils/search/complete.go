@@ -0,0 +1,143 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mozillazg/go-pinyin"
+)
+
+// MatchKind is how a query matches a name, smaller is better
+type MatchKind int
+
+const (
+	MatchExact MatchKind = iota
+	MatchPrefix
+	MatchPinyinPrefix
+	MatchInitialsPrefix
+	MatchContains
+	MatchFuzzy
+	NoMatch
+)
+
+// Completion is a name prepared for autocompletion
+type Completion struct {
+	// Name is lowercase without spaces
+	Name string
+	// Pinyin of Chinese characters without tones, other characters are kept, e.g. "kaoyan2026" for "考研2026"
+	Pinyin string
+	// Initials are the first letters of Pinyin syllables, e.g. "ky2026"
+	Initials string
+}
+
+var pinyinArgs = pinyin.Args{
+	Style: pinyin.Normal,
+	Fallback: func(r rune, _ pinyin.Args) []string {
+		return []string{string(r)}
+	},
+}
+
+func normalize(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, text)
+}
+
+func NewCompletion(name string) Completion {
+	completion := Completion{Name: normalize(name)}
+	var full, initials strings.Builder
+	for _, syllables := range pinyin.Pinyin(completion.Name, pinyinArgs) {
+		if len(syllables) == 0 {
+			continue
+		}
+		full.WriteString(syllables[0])
+		initial := []rune(syllables[0])[0]
+		initials.WriteRune(initial)
+	}
+	completion.Pinyin = full.String()
+	completion.Initials = initials.String()
+	return completion
+}
+
+// Match tells how query matches the name. Besides prefixes of the name or its pinyin,
+// a query of at least 3 characters also matches a name or a prefix of it with one typo.
+func (completion Completion) Match(query string) MatchKind {
+	query = normalize(query)
+	switch {
+	case query == "":
+		return NoMatch
+	case query == completion.Name:
+		return MatchExact
+	case strings.HasPrefix(completion.Name, query):
+		return MatchPrefix
+	case strings.HasPrefix(completion.Pinyin, query):
+		return MatchPinyinPrefix
+	case strings.HasPrefix(completion.Initials, query):
+		return MatchInitialsPrefix
+	case strings.Contains(completion.Name, query):
+		return MatchContains
+	}
+
+	queryRunes, nameRunes := []rune(query), []rune(completion.Name)
+	if len(queryRunes) >= 3 {
+		prefix := nameRunes[:min(len(nameRunes), len(queryRunes))]
+		if editDistance(queryRunes, nameRunes) <= 1 || editDistance(queryRunes, prefix) <= 1 {
+			return MatchFuzzy
+		}
+	}
+	return NoMatch
+}
+
+// Similar tells whether two different names probably mean the same, i.e. they differ only in case or spaces,
+// sound the same, or have one typo. Names with different digits are not similar.
+func (completion Completion) Similar(other Completion) bool {
+	if completion.Name == other.Name {
+		return true
+	}
+	if digits(completion.Name) != digits(other.Name) {
+		return false
+	}
+	chinese := completion.Pinyin != completion.Name || other.Pinyin != other.Name
+	if chinese && completion.Pinyin == other.Pinyin {
+		return true
+	}
+	// a typo replaces a character, or adds or drops one in a long name
+	a, b := []rune(completion.Name), []rune(other.Name)
+	if len(a) == len(b) {
+		return len(a) >= 3 && editDistance(a, b) <= 1
+	}
+	return min(len(a), len(b)) >= 5 && editDistance(a, b) <= 1
+}
+
+func digits(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, text)
+}
+
+// editDistance is the Levenshtein distance
+func editDistance(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
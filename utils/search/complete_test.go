@@ -0,0 +1,47 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompletion(t *testing.T) {
+	completion := NewCompletion("考研 2026")
+	assert.Equal(t, Completion{Name: "考研2026", Pinyin: "kaoyan2026", Initials: "ky2026"}, completion)
+
+	for query, expected := range map[string]MatchKind{
+		"考研2026": MatchExact,
+		"考研 ":    MatchPrefix,
+		"KaoY":   MatchPinyinPrefix,
+		"ky":     MatchInitialsPrefix,
+		"2026":   MatchContains,
+		"考妍20":   MatchFuzzy,
+		"考妍":     NoMatch,
+		"保研":     NoMatch,
+		" ":      NoMatch,
+	} {
+		assert.Equal(t, expected, completion.Match(query), query)
+	}
+}
+
+func TestCompletionSimilar(t *testing.T) {
+	for _, names := range [][2]string{
+		{"考研", "烤研"},
+		{"kaoyan", "考研"},
+		{"Java", "java "},
+		{"显示器", "显示气"},
+		{"python", "pyton"},
+	} {
+		assert.True(t, NewCompletion(names[0]).Similar(NewCompletion(names[1])), names)
+	}
+	for _, names := range [][2]string{
+		{"考研", "保研"},
+		{"考研2025", "考研2026"},
+		{"abc", "abcde"},
+		{"def", "defg"},
+		{"ab", "ac"},
+	} {
+		assert.False(t, NewCompletion(names[0]).Similar(NewCompletion(names[1])), names)
+	}
+}
@@ -0,0 +1,407 @@
+package search
+
+import (
+	"encoding/gob"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// BM25 parameters, same as the defaults of Elasticsearch
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Document is a piece of text to be searched
+type Document struct {
+	ID      int
+	Content string
+	Time    time.Time
+	// Keywords are exact values to filter documents with, e.g. {"tag_ids": [1, 2]}
+	Keywords map[string][]int
+	// Numbers are values to limit documents with Query.Ranges, e.g. {"like": 3}
+	Numbers map[string]int
+}
+
+// Query matches documents that contain all terms of Text and Phrases
+type Query struct {
+	Text string
+	// Phrase requires Text to appear as a whole, case-insensitively
+	Phrase bool
+	// Phrases should appear as a whole and ExcludedPhrases should not, case-insensitively
+	Phrases         []string
+	ExcludedPhrases []string
+	// Ranges limits Document.Numbers
+	Ranges map[string]NumberRange
+	// Filters requires documents to have all of these keyword values
+	Filters map[string][]int
+	// Excludes rejects documents that have any of these keyword values
+	Excludes map[string]int
+	// After and Before limit Document.Time, both inclusive and optional
+	After  *time.Time
+	Before *time.Time
+	// AfterID keeps documents with larger IDs only and MaxID keeps documents with IDs not larger, 0 means no limit
+	AfterID int
+	MaxID   int
+	Offset  int
+	Size    int
+}
+
+// NumberRange has inclusive bounds, nil means unbounded
+type NumberRange struct {
+	Min *int
+	Max *int
+}
+
+// Range is a byte range of the content
+type Range struct {
+	Start int
+	End   int
+}
+
+// Hit is a matched document, ordered by Score and then by the time of the document
+type Hit struct {
+	ID    int
+	Score float64
+	// Content is the indexed content that Highlights refer to
+	Content    string
+	Highlights []Range
+	Keywords   map[string][]int
+}
+
+type indexedDocument struct {
+	Document
+	length int
+	terms  map[string]int
+}
+
+// Index is an in-memory inverted index ranking documents by BM25, safe for concurrent use
+type Index struct {
+	lock        sync.RWMutex
+	documents   map[int]*indexedDocument
+	postings    map[string]map[int]int // term -> document id -> term frequency
+	totalLength int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		documents: make(map[int]*indexedDocument),
+		postings:  make(map[string]map[int]int),
+	}
+}
+
+// Len returns the number of documents
+func (index *Index) Len() int {
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+	return len(index.documents)
+}
+
+// Add inserts or replaces documents
+func (index *Index) Add(documents ...Document) {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+	for _, document := range documents {
+		index.delete(document.ID)
+
+		tokens := Tokenize(document.Content)
+		indexed := &indexedDocument{Document: document, length: len(tokens), terms: make(map[string]int)}
+		for _, token := range tokens {
+			indexed.terms[token.Term]++
+		}
+		for term, frequency := range indexed.terms {
+			if index.postings[term] == nil {
+				index.postings[term] = make(map[int]int)
+			}
+			index.postings[term][document.ID] = frequency
+		}
+		index.documents[document.ID] = indexed
+		index.totalLength += indexed.length
+	}
+}
+
+// Delete removes documents, ids not in the index are ignored
+func (index *Index) Delete(ids ...int) {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+	for _, id := range ids {
+		index.delete(id)
+	}
+}
+
+func (index *Index) delete(id int) {
+	document, ok := index.documents[id]
+	if !ok {
+		return
+	}
+	for term := range document.terms {
+		delete(index.postings[term], id)
+		if len(index.postings[term]) == 0 {
+			delete(index.postings, term)
+		}
+	}
+	index.totalLength -= document.length
+	delete(index.documents, id)
+}
+
+// Search returns a page of hits and the number of all matched documents
+func (index *Index) Search(query Query) ([]Hit, int) {
+	phrases := slices.Clone(query.Phrases)
+	if query.Phrase {
+		phrases = append(phrases, query.Text)
+	}
+	var terms []string
+	for _, text := range append([]string{query.Text}, phrases...) {
+		for _, term := range QueryTerms(text) {
+			if !slices.Contains(terms, term) {
+				terms = append(terms, term)
+			}
+		}
+	}
+	if len(terms) == 0 {
+		return []Hit{}, 0
+	}
+
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+
+	// iterate the shortest posting list, every term is required
+	var candidates map[int]int
+	for _, term := range terms {
+		posting := index.postings[term]
+		if len(posting) == 0 {
+			return []Hit{}, 0
+		}
+		if candidates == nil || len(posting) < len(candidates) {
+			candidates = posting
+		}
+	}
+
+	phrasePatterns := phraseRegexps(phrases)
+	excludedPatterns := phraseRegexps(query.ExcludedPhrases)
+
+	averageLength := float64(index.totalLength) / float64(len(index.documents))
+	var matched []*indexedDocument
+	scores := make(map[int]float64)
+	for id := range candidates {
+		document := index.documents[id]
+		if !document.match(&query, terms) || !matchPhrases(document.Content, phrasePatterns, excludedPatterns) {
+			continue
+		}
+
+		var score float64
+		for _, term := range terms {
+			score += index.termScore(document, term, averageLength)
+		}
+		scores[id] = score
+		matched = append(matched, document)
+	}
+	sortDocuments(matched, scores)
+
+	total := len(matched)
+	start := min(max(query.Offset, 0), total)
+	end := total
+	if query.Size > 0 {
+		end = min(start+query.Size, total)
+	}
+	var textTerms []string
+	if !query.Phrase {
+		textTerms = QueryTerms(query.Text)
+	}
+	hits := make([]Hit, 0, end-start)
+	for _, document := range matched[start:end] {
+		highlights := termRanges(document.Content, textTerms)
+		for _, pattern := range phrasePatterns {
+			for _, location := range pattern.FindAllStringIndex(document.Content, -1) {
+				highlights = append(highlights, Range{Start: location[0], End: location[1]})
+			}
+		}
+		hits = append(hits, Hit{
+			ID:         document.ID,
+			Score:      scores[document.ID],
+			Content:    document.Content,
+			Highlights: mergeRanges(highlights),
+			Keywords:   document.Keywords,
+		})
+	}
+	return hits, total
+}
+
+// idf is the inverse document frequency of term, the index should be locked
+func (index *Index) idf(term string) float64 {
+	count := float64(len(index.postings[term]))
+	return math.Log(1 + (float64(len(index.documents))-count+0.5)/(count+0.5))
+}
+
+// termScore is the BM25 score of term in document, the index should be locked
+func (index *Index) termScore(document *indexedDocument, term string, averageLength float64) float64 {
+	frequency := float64(document.terms[term])
+	return index.idf(term) * frequency * (bm25K1 + 1) /
+		(frequency + bm25K1*(1-bm25B+bm25B*float64(document.length)/averageLength))
+}
+
+// sortDocuments sorts by score, then by time and id descending
+func sortDocuments(documents []*indexedDocument, scores map[int]float64) {
+	sort.Slice(documents, func(i, j int) bool {
+		a, b := documents[i], documents[j]
+		if scores[a.ID] != scores[b.ID] {
+			return scores[a.ID] > scores[b.ID]
+		}
+		if !a.Time.Equal(b.Time) {
+			return a.Time.After(b.Time)
+		}
+		return a.ID > b.ID
+	})
+}
+
+func phraseRegexps(phrases []string) []*regexp.Regexp {
+	patterns := make([]*regexp.Regexp, 0, len(phrases))
+	for _, phrase := range phrases {
+		if phrase = strings.TrimSpace(phrase); phrase != "" {
+			patterns = append(patterns, regexp.MustCompile("(?i)"+regexp.QuoteMeta(phrase)))
+		}
+	}
+	return patterns
+}
+
+func matchPhrases(content string, phrases, excludedPhrases []*regexp.Regexp) bool {
+	for _, pattern := range phrases {
+		if !pattern.MatchString(content) {
+			return false
+		}
+	}
+	for _, pattern := range excludedPhrases {
+		if pattern.MatchString(content) {
+			return false
+		}
+	}
+	return true
+}
+
+func (document *indexedDocument) match(query *Query, terms []string) bool {
+	for _, term := range terms {
+		if document.terms[term] == 0 {
+			return false
+		}
+	}
+	for keyword, values := range query.Filters {
+		for _, value := range values {
+			if !slices.Contains(document.Keywords[keyword], value) {
+				return false
+			}
+		}
+	}
+	for keyword, value := range query.Excludes {
+		if slices.Contains(document.Keywords[keyword], value) {
+			return false
+		}
+	}
+	for field, r := range query.Ranges {
+		value := document.Numbers[field]
+		if (r.Min != nil && value < *r.Min) || (r.Max != nil && value > *r.Max) {
+			return false
+		}
+	}
+	if document.ID <= query.AfterID {
+		return false
+	}
+	if query.MaxID > 0 && document.ID > query.MaxID {
+		return false
+	}
+	if query.After != nil && document.Time.Before(*query.After) {
+		return false
+	}
+	if query.Before != nil && document.Time.After(*query.Before) {
+		return false
+	}
+	return true
+}
+
+// termRanges returns ranges of the tokens of content that are in terms
+func termRanges(content string, terms []string) []Range {
+	var ranges []Range
+	for _, token := range Tokenize(content) {
+		if slices.Contains(terms, token.Term) {
+			ranges = append(ranges, Range{Start: token.Start, End: token.End})
+		}
+	}
+	return ranges
+}
+
+// mergeRanges sorts ranges and merges the overlapping or adjacent ones
+func mergeRanges(ranges []Range) []Range {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	var merged []Range
+	for _, r := range ranges {
+		if len(merged) > 0 && r.Start <= merged[len(merged)-1].End {
+			merged[len(merged)-1].End = max(merged[len(merged)-1].End, r.End)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// Highlight wraps ranges of content with begin and end, ranges should be ordered and not overlap
+func Highlight(content string, ranges []Range, begin, end string) string {
+	var builder strings.Builder
+	last := 0
+	for _, r := range ranges {
+		builder.WriteString(content[last:r.Start])
+		builder.WriteString(begin)
+		builder.WriteString(content[r.Start:r.End])
+		builder.WriteString(end)
+		last = r.End
+	}
+	builder.WriteString(content[last:])
+	return builder.String()
+}
+
+// Save writes all documents to the file, the index is rebuilt by Load
+func (index *Index) Save(path string) error {
+	index.lock.RLock()
+	documents := make([]Document, 0, len(index.documents))
+	for _, document := range index.documents {
+		documents = append(documents, document.Document)
+	}
+	index.lock.RUnlock()
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".search-index-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	err = gob.NewEncoder(file).Encode(documents)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// Load adds documents saved in the file
+func (index *Index) Load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var documents []Document
+	err = gob.NewDecoder(file).Decode(&documents)
+	if err != nil {
+		return err
+	}
+	index.Add(documents...)
+	return nil
+}
@@ -0,0 +1,117 @@
+package search
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func terms(tokens []Token) []string {
+	result := make([]string, len(tokens))
+	for i, token := range tokens {
+		result[i] = token.Term
+	}
+	return result
+}
+
+func hitIDs(hits []Hit) []int {
+	ids := make([]int, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	return ids
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize("Go语言, hello!")
+	assert.Equal(t, []string{"go", "语", "语言", "言", "hello"}, terms(tokens))
+	assert.Equal(t, Token{Term: "语言", Start: 2, End: 8}, tokens[2])
+	assert.Equal(t, Token{Term: "hello", Start: 10, End: 15}, tokens[4])
+
+	assert.Equal(t, []string{"go", "语言"}, QueryTerms("Go 语言 go"))
+	assert.Equal(t, []string{"中文", "文分", "分词"}, QueryTerms("中文分词"))
+	assert.Equal(t, []string{"中", "a", "文"}, QueryTerms("中a文"))
+	assert.Empty(t, QueryTerms(" ,.!"))
+}
+
+func TestIndexSearch(t *testing.T) {
+	now := time.Now()
+	index := NewIndex()
+	index.Add(
+		Document{ID: 1, Content: "今天食堂的饭很好吃", Time: now, Keywords: map[string][]int{"tag_ids": {1}}},
+		Document{ID: 2, Content: "食堂 食堂 食堂，还是食堂", Time: now.Add(-time.Hour), Keywords: map[string][]int{"tag_ids": {1, 2}}},
+		Document{ID: 3, Content: "图书馆的座位", Time: now.Add(-2 * time.Hour), Keywords: map[string][]int{"hidden": {1}}},
+		Document{ID: 4, Content: "Elasticsearch is down, search the database", Time: now},
+	)
+	assert.Equal(t, 4, index.Len())
+
+	hits, total := index.Search(Query{Text: "食堂"})
+	assert.Equal(t, 2, total)
+	// more occurrences rank higher
+	assert.Equal(t, []int{2, 1}, hitIDs(hits))
+	assert.Equal(t, "今天<em>食堂</em>的饭很好吃", Highlight(hits[1].Content, hits[1].Highlights, "<em>", "</em>"))
+
+	// all terms are required
+	_, total = index.Search(Query{Text: "食堂 图书馆"})
+	assert.Equal(t, 0, total)
+	_, total = index.Search(Query{Text: "堂食"})
+	assert.Equal(t, 0, total)
+
+	hits, _ = index.Search(Query{Text: "食堂", Filters: map[string][]int{"tag_ids": {1, 2}}})
+	assert.Equal(t, []int{2}, hitIDs(hits))
+	hits, _ = index.Search(Query{Text: "的", Excludes: map[string]int{"hidden": 1}})
+	assert.Equal(t, []int{1}, hitIDs(hits))
+	after := now.Add(-30 * time.Minute)
+	hits, _ = index.Search(Query{Text: "食堂", After: &after})
+	assert.Equal(t, []int{1}, hitIDs(hits))
+	hits, _ = index.Search(Query{Text: "食堂", AfterID: 1})
+	assert.Equal(t, []int{2}, hitIDs(hits))
+	hits, _ = index.Search(Query{Text: "食堂", MaxID: 1})
+	assert.Equal(t, []int{1}, hitIDs(hits))
+
+	hits, total = index.Search(Query{Text: "食堂", Offset: 1, Size: 1})
+	assert.Equal(t, 2, total)
+	assert.Equal(t, []int{1}, hitIDs(hits))
+
+	// phrase
+	_, total = index.Search(Query{Text: "search elasticsearch", Phrase: true})
+	assert.Equal(t, 0, total)
+	hits, _ = index.Search(Query{Text: "SEARCH the", Phrase: true})
+	assert.Equal(t, []int{4}, hitIDs(hits))
+	assert.Equal(t, []Range{{Start: 23, End: 33}}, hits[0].Highlights)
+
+	// phrases, excluded phrases and ranges
+	index.Add(Document{ID: 5, Content: "食堂的饭不好吃", Time: now, Numbers: map[string]int{"like": 10}})
+	hits, _ = index.Search(Query{Text: "食堂", Phrases: []string{"好吃"}, ExcludedPhrases: []string{"不好吃"}})
+	assert.Equal(t, []int{1}, hitIDs(hits))
+	hits, _ = index.Search(Query{Text: "食堂", Phrases: []string{"好吃"}})
+	assert.ElementsMatch(t, []int{1, 5}, hitIDs(hits))
+	assert.Equal(t, "<em>食堂</em>的饭不<em>好吃</em>", Highlight(hits[0].Content, hits[0].Highlights, "<em>", "</em>"))
+	minLikes := 5
+	hits, _ = index.Search(Query{Phrases: []string{"食堂"}, Ranges: map[string]NumberRange{"like": {Min: &minLikes}}})
+	assert.Equal(t, []int{5}, hitIDs(hits))
+	index.Delete(5)
+
+	// replace and delete
+	index.Add(Document{ID: 1, Content: "图书馆", Time: now})
+	hits, _ = index.Search(Query{Text: "食堂"})
+	assert.Equal(t, []int{2}, hitIDs(hits))
+	index.Delete(2, 100)
+	_, total = index.Search(Query{Text: "食堂"})
+	assert.Equal(t, 0, total)
+	assert.Equal(t, 3, index.Len())
+}
+
+func TestIndexSaveLoad(t *testing.T) {
+	index := NewIndex()
+	index.Add(Document{ID: 1, Content: "持久化的索引", Time: time.Now(), Keywords: map[string][]int{"hole_id": {1}}})
+	path := filepath.Join(t.TempDir(), "index")
+	assert.Nil(t, index.Save(path))
+
+	loaded := NewIndex()
+	assert.Nil(t, loaded.Load(path))
+	hits, _ := loaded.Search(Query{Text: "索引", Filters: map[string][]int{"hole_id": {1}}})
+	assert.Equal(t, []int{1}, hitIDs(hits))
+}
@@ -0,0 +1,246 @@
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ParsedQuery is the result of ParseQuery
+type ParsedQuery struct {
+	// Terms are plain words, matched the same as a keyword without syntax
+	Terms []string
+	// Phrases must appear as a whole
+	Phrases []string
+	// Excludes must not appear
+	Excludes []string
+	// HoleID limits floors to a hole, 0 means not set
+	HoleID int
+	// Tags are names of tags that the hole should have
+	Tags []string
+	// After is inclusive and Before is exclusive, both are the start of a day
+	After  *time.Time
+	Before *time.Time
+	// MinLikes and MaxLikes are inclusive
+	MinLikes *int
+	MaxLikes *int
+}
+
+// Keyword joins Terms with spaces
+func (query *ParsedQuery) Keyword() string {
+	return strings.Join(query.Terms, " ")
+}
+
+// QueryError is a syntax error of the query at Position, which is a byte offset
+type QueryError struct {
+	Position int
+	Token    string
+	Message  string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s: %q at position %d", e.Message, e.Token, e.Position)
+}
+
+// ParseQuery parses the search syntax, tokens are separated by whitespaces:
+//
+//	"exact phrase"    the phrase should appear as a whole
+//	-word, -"phrase"  the word or phrase should not appear
+//	#1234             floors in hole 1234
+//	tag:name          the hole has the tag, the name can be quoted
+//	after:2006-01-02  floors updated on or after the day
+//	before:2006-01-02 floors updated before the day
+//	likes>10          likes compared with >, >=, < or <=
+//
+// Other tokens are plain terms. At least one term or phrase is required.
+func ParseQuery(input string) (*ParsedQuery, error) {
+	query := &ParsedQuery{}
+	for position := 0; ; {
+		for position < len(input) {
+			r, size := utf8.DecodeRuneInString(input[position:])
+			if !unicode.IsSpace(r) {
+				break
+			}
+			position += size
+		}
+		if position >= len(input) {
+			break
+		}
+
+		start := position
+		exclude := false
+		if input[position] == '-' && position+1 < len(input) && (input[position+1] == '"' || !isSpaceAt(input, position+1)) {
+			exclude = true
+			position++
+		}
+
+		var token string
+		var quoted bool
+		var err error
+		token, quoted, position, err = readToken(input, position)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case exclude:
+			query.Excludes = append(query.Excludes, token)
+		case quoted:
+			query.Phrases = append(query.Phrases, token)
+		default:
+			err = query.parseToken(input, start, token, &position)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(query.Terms) == 0 && len(query.Phrases) == 0 {
+		return nil, &QueryError{Position: 0, Token: input, Message: "query has no keyword"}
+	}
+	return query, nil
+}
+
+func isSpaceAt(input string, position int) bool {
+	r, _ := utf8.DecodeRuneInString(input[position:])
+	return unicode.IsSpace(r)
+}
+
+// readToken reads a quoted phrase or a run of non-space characters from position
+func readToken(input string, position int) (token string, quoted bool, end int, err error) {
+	if input[position] == '"' {
+		closing := strings.IndexByte(input[position+1:], '"')
+		if closing < 0 {
+			return "", false, 0, &QueryError{Position: position, Token: input[position:], Message: "unclosed quote"}
+		}
+		token = strings.TrimSpace(input[position+1 : position+1+closing])
+		if token == "" {
+			return "", false, 0, &QueryError{Position: position, Token: `""`, Message: "empty phrase"}
+		}
+		return token, true, position + closing + 2, nil
+	}
+
+	end = position
+	for end < len(input) {
+		r, size := utf8.DecodeRuneInString(input[end:])
+		if unicode.IsSpace(r) {
+			break
+		}
+		end += size
+	}
+	return input[position:end], false, end, nil
+}
+
+func (query *ParsedQuery) parseToken(input string, start int, token string, position *int) error {
+	fail := func(message string) error {
+		return &QueryError{Position: start, Token: token, Message: message}
+	}
+
+	switch {
+	case strings.HasPrefix(token, "#") && len(token) > 1:
+		holeID, err := strconv.Atoi(token[1:])
+		if err != nil || holeID <= 0 {
+			return fail("invalid hole id")
+		}
+		if query.HoleID != 0 && query.HoleID != holeID {
+			return fail("more than one hole")
+		}
+		query.HoleID = holeID
+
+	case strings.HasPrefix(token, "tag:"):
+		name := token[len("tag:"):]
+		if strings.HasPrefix(name, `"`) {
+			// tag:"name with spaces"
+			var err error
+			name, _, *position, err = readToken(input, start+len("tag:"))
+			if err != nil {
+				return err
+			}
+		}
+		if name == "" {
+			return fail("empty tag")
+		}
+		query.Tags = append(query.Tags, name)
+
+	case strings.HasPrefix(token, "after:") || strings.HasPrefix(token, "before:"):
+		field, value, _ := strings.Cut(token, ":")
+		day, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+		if err != nil {
+			return fail("invalid date, expected YYYY-MM-DD")
+		}
+		if field == "after" {
+			query.After = &day
+		} else {
+			query.Before = &day
+		}
+
+	case strings.HasPrefix(token, "likes<") || strings.HasPrefix(token, "likes>"):
+		operator := token[len("likes") : len("likes")+1]
+		value := token[len("likes")+1:]
+		inclusive := strings.HasPrefix(value, "=")
+		value = strings.TrimPrefix(value, "=")
+		likes, err := strconv.Atoi(value)
+		if err != nil || likes < 0 {
+			return fail("invalid number of likes")
+		}
+		if operator == ">" {
+			if !inclusive {
+				likes++
+			}
+			query.MinLikes = &likes
+		} else {
+			if !inclusive {
+				likes--
+			}
+			query.MaxLikes = &likes
+		}
+
+	default:
+		query.Terms = append(query.Terms, token)
+	}
+	return nil
+}
+
+// maxNormalizedQueryLength is the max number of runes kept by NormalizeQuery
+const maxNormalizedQueryLength = 256
+
+// NormalizeQuery lowercases the query, collapses whitespaces and masks runs of at least 6 digits with "*",
+// so that the same query typed differently is counted once and phone or student numbers are not recorded
+func NormalizeQuery(input string) string {
+	fields := strings.Fields(strings.ToLower(input))
+	for i, field := range fields {
+		var builder strings.Builder
+		digits := 0
+		flush := func(text string) {
+			if digits >= 6 {
+				builder.WriteByte('*')
+			} else {
+				builder.WriteString(text)
+			}
+			digits = 0
+		}
+		start := 0
+		for j, r := range field {
+			if unicode.IsDigit(r) {
+				if digits == 0 {
+					start = j
+				}
+				digits++
+				continue
+			}
+			if digits > 0 {
+				flush(field[start:j])
+			}
+			builder.WriteRune(r)
+		}
+		if digits > 0 {
+			flush(field[start:])
+		}
+		fields[i] = builder.String()
+	}
+	normalized := []rune(strings.Join(fields, " "))
+	return string(normalized[:min(len(normalized), maxNormalizedQueryLength)])
+}
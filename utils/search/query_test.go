@@ -0,0 +1,70 @@
+package search
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuery(t *testing.T) {
+	query, err := ParseQuery(`考研 "exact phrase"  -excluded -"not this" #1234 tag:考研 tag:"two words" after:2026-01-01 before:2026-02-01 likes>10`)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"考研"}, query.Terms)
+	assert.Equal(t, "考研", query.Keyword())
+	assert.Equal(t, []string{"exact phrase"}, query.Phrases)
+	assert.Equal(t, []string{"excluded", "not this"}, query.Excludes)
+	assert.Equal(t, 1234, query.HoleID)
+	assert.Equal(t, []string{"考研", "two words"}, query.Tags)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local), *query.After)
+	assert.Equal(t, time.Date(2026, 2, 1, 0, 0, 0, 0, time.Local), *query.Before)
+	assert.Equal(t, 11, *query.MinLikes)
+	assert.Nil(t, query.MaxLikes)
+
+	query, err = ParseQuery("likes>=3 likes<5 a-b - #")
+	if assert.Nil(t, err) {
+		assert.Equal(t, 3, *query.MinLikes)
+		assert.Equal(t, 4, *query.MaxLikes)
+		assert.Equal(t, []string{"a-b", "-", "#"}, query.Terms)
+	}
+
+	query, err = ParseQuery(`"only a phrase"`)
+	if assert.Nil(t, err) {
+		assert.Empty(t, query.Terms)
+		assert.Equal(t, []string{"only a phrase"}, query.Phrases)
+	}
+}
+
+func TestParseQueryError(t *testing.T) {
+	for input, expected := range map[string]QueryError{
+		`keyword "unclosed`:          {Position: 8, Token: `"unclosed`, Message: "unclosed quote"},
+		`keyword ""`:                 {Position: 8, Token: `""`, Message: "empty phrase"},
+		`keyword #abc`:               {Position: 8, Token: "#abc", Message: "invalid hole id"},
+		`keyword #1 #2`:              {Position: 11, Token: "#2", Message: "more than one hole"},
+		`keyword tag:`:               {Position: 8, Token: "tag:", Message: "empty tag"},
+		`keyword after:2026/01/01`:   {Position: 8, Token: "after:2026/01/01", Message: "invalid date, expected YYYY-MM-DD"},
+		`keyword likes>many`:         {Position: 8, Token: "likes>many", Message: "invalid number of likes"},
+		`-excluded tag:114 likes>10`: {Position: 0, Token: "-excluded tag:114 likes>10", Message: "query has no keyword"},
+	} {
+		_, err := ParseQuery(input)
+		var queryError *QueryError
+		if assert.ErrorAs(t, err, &queryError, input) {
+			assert.Equal(t, expected, *queryError, input)
+		}
+	}
+}
+
+func TestNormalizeQuery(t *testing.T) {
+	for input, expected := range map[string]string{
+		"  Hello   World ":        "hello world",
+		"#1234 tag:考研\t数学":        "#1234 tag:考研 数学",
+		"电话 13812345678 学号20300":  "电话 * 学号20300",
+		"id:123456abc 2026-01-01": "id:*abc 2026-01-01",
+	} {
+		assert.Equal(t, expected, NormalizeQuery(input), input)
+	}
+	assert.Len(t, []rune(NormalizeQuery(strings.Repeat("长", 300))), maxNormalizedQueryLength)
+}
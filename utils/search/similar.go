@@ -0,0 +1,112 @@
+package search
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// maxLikeTerms is the number of the most distinctive terms picked from the text by MoreLikeThis
+	maxLikeTerms = 25
+	// minLikeTermsRatio is the ratio of picked terms that a similar document should contain
+	minLikeTermsRatio = 0.3
+)
+
+// MoreLikeThis finds documents similar to text, i.e. containing enough of its most distinctive terms,
+// like the more_like_this query of Elasticsearch. Text, Phrase and Phrases of query are ignored.
+func (index *Index) MoreLikeThis(text string, query Query) ([]Hit, int) {
+	index.lock.RLock()
+	defer index.lock.RUnlock()
+	if len(index.documents) == 0 {
+		return []Hit{}, 0
+	}
+
+	// pick terms by tf-idf, terms not in the index match nothing but count in the ratio
+	textTerms := make(map[string]bool)
+	for _, term := range QueryTerms(text) {
+		textTerms[term] = true
+	}
+	frequencies := make(map[string]int)
+	for _, token := range Tokenize(text) {
+		if textTerms[token.Term] && len(index.postings[token.Term]) > 0 {
+			frequencies[token.Term]++
+		}
+	}
+	terms := make([]string, 0, len(frequencies))
+	weights := make(map[string]float64, len(frequencies))
+	for term, frequency := range frequencies {
+		terms = append(terms, term)
+		weights[term] = float64(frequency) * index.idf(term)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if weights[terms[i]] != weights[terms[j]] {
+			return weights[terms[i]] > weights[terms[j]]
+		}
+		return terms[i] < terms[j]
+	})
+	terms = terms[:min(len(terms), maxLikeTerms)]
+	if len(terms) == 0 {
+		return []Hit{}, 0
+	}
+	minMatched := int(math.Ceil(float64(min(len(textTerms), maxLikeTerms)) * minLikeTermsRatio))
+
+	averageLength := float64(index.totalLength) / float64(len(index.documents))
+	matchedTerms := make(map[int]int)
+	scores := make(map[int]float64)
+	for _, term := range terms {
+		for id := range index.postings[term] {
+			matchedTerms[id]++
+			scores[id] += index.termScore(index.documents[id], term, averageLength)
+		}
+	}
+
+	excludedPatterns := phraseRegexps(query.ExcludedPhrases)
+	var matched []*indexedDocument
+	for id, count := range matchedTerms {
+		document := index.documents[id]
+		if count < minMatched || !document.match(&query, nil) || !matchPhrases(document.Content, nil, excludedPatterns) {
+			continue
+		}
+		matched = append(matched, document)
+	}
+	sortDocuments(matched, scores)
+
+	total := len(matched)
+	start := min(max(query.Offset, 0), total)
+	end := total
+	if query.Size > 0 {
+		end = min(start+query.Size, total)
+	}
+	hits := make([]Hit, 0, end-start)
+	for _, document := range matched[start:end] {
+		hits = append(hits, Hit{
+			ID:       document.ID,
+			Score:    scores[document.ID],
+			Content:  document.Content,
+			Keywords: document.Keywords,
+		})
+	}
+	return hits, total
+}
+
+// Resemblance is the Jaccard similarity of the terms of two texts, from 0 to 1
+func Resemblance(a, b string) float64 {
+	termsA, termsB := make(map[string]bool), make(map[string]bool)
+	for _, token := range Tokenize(a) {
+		termsA[token.Term] = true
+	}
+	for _, token := range Tokenize(b) {
+		termsB[token.Term] = true
+	}
+	if len(termsA) == 0 && len(termsB) == 0 {
+		return 1
+	}
+
+	var intersection int
+	for term := range termsA {
+		if termsB[term] {
+			intersection++
+		}
+	}
+	return float64(intersection) / float64(len(termsA)+len(termsB)-intersection)
+}
@@ -0,0 +1,45 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoreLikeThis(t *testing.T) {
+	now := time.Now()
+	index := NewIndex()
+	index.Add(
+		Document{ID: 1, Content: "请问高等数学期末考试的范围是什么", Time: now, Numbers: map[string]int{"ranking": 0}},
+		Document{ID: 2, Content: "高等数学期末考试范围有人知道吗", Time: now, Numbers: map[string]int{"ranking": 0}},
+		Document{ID: 3, Content: "食堂今天的饭很好吃", Time: now, Numbers: map[string]int{"ranking": 0}},
+		Document{ID: 4, Content: "高等数学期末考试的范围见教学日历", Time: now, Numbers: map[string]int{"ranking": 1}},
+		Document{ID: 5, Content: "线性代数期末考试的时间", Time: now.Add(-time.Hour), Keywords: map[string][]int{"hidden": {1}}},
+	)
+
+	hits, _ := index.MoreLikeThis("高等数学的期末考试考什么范围", Query{})
+	assert.Subset(t, hitIDs(hits), []int{1, 2, 4})
+	assert.NotContains(t, hitIDs(hits), 3)
+
+	zero := 0
+	hits, _ = index.MoreLikeThis("高等数学的期末考试考什么范围", Query{
+		Ranges:   map[string]NumberRange{"ranking": {Max: &zero}},
+		Excludes: map[string]int{"hidden": 1},
+		Size:     1,
+	})
+	if assert.Len(t, hits, 1) {
+		assert.Contains(t, []int{1, 2}, hits[0].ID)
+	}
+
+	hits, total := index.MoreLikeThis("完全无关的内容", Query{})
+	assert.Equal(t, 0, total)
+	assert.Empty(t, hits)
+}
+
+func TestResemblance(t *testing.T) {
+	assert.Equal(t, 1.0, Resemblance("一模一样的内容", "一模一样的内容"))
+	assert.Greater(t, Resemblance("出一台二手显示器，九成新", "出一台二手显示器，九成新！"), 0.8)
+	assert.Less(t, Resemblance("出一台二手显示器", "收一台二手键盘"), 0.5)
+	assert.Equal(t, 0.0, Resemblance("abc", "def"))
+}
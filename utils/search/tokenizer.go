@@ -0,0 +1,85 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token is a term with its byte range in the text
+type Token struct {
+	Term  string
+	Start int
+	End   int
+}
+
+// Tokenize splits text into lowercase terms.
+// A run of letters or digits is a term, while a run of CJK characters
+// is split into unigrams and bigrams, so that words can be matched without a dictionary.
+func Tokenize(text string) []Token {
+	var tokens []Token
+	for start := 0; start < len(text); {
+		r, size := utf8.DecodeRuneInString(text[start:])
+		switch {
+		case isCJK(r):
+			end := start + size
+			next, nextSize := utf8.DecodeRuneInString(text[end:])
+			tokens = append(tokens, Token{Term: text[start:end], Start: start, End: end})
+			if end < len(text) && isCJK(next) {
+				tokens = append(tokens, Token{Term: text[start : end+nextSize], Start: start, End: end + nextSize})
+			}
+			start = end
+		case IsWordRune(r):
+			end := start + size
+			for end < len(text) {
+				next, nextSize := utf8.DecodeRuneInString(text[end:])
+				if !IsWordRune(next) {
+					break
+				}
+				end += nextSize
+			}
+			tokens = append(tokens, Token{Term: strings.ToLower(text[start:end]), Start: start, End: end})
+			start = end
+		default:
+			start += size
+		}
+	}
+	return tokens
+}
+
+// QueryTerms returns the distinct terms that a document should contain to match text.
+// A run of CJK characters longer than one contributes its bigrams only.
+func QueryTerms(text string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	add := func(term string) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+
+	tokens := Tokenize(text)
+	for i, token := range tokens {
+		if utf8.RuneCountInString(token.Term) != 1 || !isCJK([]rune(token.Term)[0]) {
+			add(token.Term)
+			continue
+		}
+		// a unigram followed by its bigram, or a unigram that ends a run which has bigrams
+		hasBigram := i+1 < len(tokens) && tokens[i+1].Start == token.Start
+		endsRun := i > 0 && tokens[i-1].End == token.End
+		if !hasBigram && !endsRun {
+			add(token.Term)
+		}
+	}
+	return terms
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// IsWordRune tells whether r is part of a word of letters, digits and underscores, CJK characters are not
+func IsWordRune(r rune) bool {
+	return (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_') && !isCJK(r)
+}